@@ -9,7 +9,7 @@ import (
 type zoneAddr struct {
 	Zone      string
 	Port      string
-	Transport string // dns, tls or grpc
+	Transport string // dns, tls, grpc, https or quic
 	Address   string // used for bound zoneAddr - validation of overlapping
 }
 
@@ -29,7 +29,7 @@ type Config struct {
 	Debug bool
 
 	// The transport we implement, normally just "dns" over TCP/UDP, but could be
-	// DNS-over-TLS or DNS-over-gRPC.
+	// DNS-over-TLS, DNS-over-gRPC, DNS-over-HTTPS or DNS-over-QUIC.
 	Transport string
 
 	// If this function is not nil it will be used to inspect and validate
@@ -37,9 +37,25 @@ type Config struct {
 	// may depend on it.
 	HTTPRequestValidateFunc func(*http.Request) bool
 
-	// TLSConfig when listening for encrypted connections (gRPC, DNS-over-TLS).
+	// TLSConfig when listening for encrypted connections (gRPC, DNS-over-TLS, DNS-over-QUIC).
 	TLSConfig *tls.Config
 
+	// MaxQUICStreams is the maximum number of concurrent streams (and thus queries) a
+	// DNS-over-QUIC client may have open on one connection. Zero means use the default.
+	MaxQUICStreams int
+
+	// QUICReject0RTT makes a DNS-over-QUIC server refuse 0-RTT data, so every query is
+	// only processed after the TLS handshake has completed.
+	QUICReject0RTT bool
+
+	// TsigSecret holds the TSIG secrets, keyed by key name, used to verify signed requests
+	// and sign the replies to them.
+	TsigSecret map[string]string
+
+	// DynamicUpdates makes the server accept RFC 2136 dynamic updates, by default these are
+	// rejected with NOTIMP before reaching the plugins.
+	DynamicUpdates bool
+
 	// Plugin stack.
 	Plugin []plugin.Plugin
 
@@ -52,6 +68,19 @@ type Config struct {
 	registry map[string]plugin.Handler
 }
 
+// AddTsigSecret adds the TSIG secret for key name to the config. It is an error to add a different
+// secret under a name that is already in use.
+func (c *Config) AddTsigSecret(name, secret string) error {
+	if c.TsigSecret == nil {
+		c.TsigSecret = make(map[string]string)
+	}
+	if s, ok := c.TsigSecret[name]; ok && s != secret {
+		return fmt.Errorf("conflicting secrets for TSIG key %q", name)
+	}
+	c.TsigSecret[name] = secret
+	return nil
+}
+
 // keyForConfig builds a key for identifying the configs during setup time
 func keyForConfig(blocIndex int, blocKeyIndex int) string {
 	return fmt.Sprintf("%d:%d", blocIndex, blocKeyIndex)
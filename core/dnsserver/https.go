@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+
+	"github.com/miekg/dns"
 )
 
 // DoHWriter is a nonwriter.Writer that adds more specific LocalAddr and RemoteAddr methods.
@@ -18,6 +20,9 @@ type DoHWriter struct {
 
 	// request is the HTTP request we're currently handling.
 	request *http.Request
+
+	// tsigStatus is the result of verifying the TSIG signature of the request.
+	tsigStatus error
 }
 
 // RemoteAddr returns the remote address.
@@ -26,5 +31,18 @@ func (d *DoHWriter) RemoteAddr() net.Addr { return d.raddr }
 // LocalAddr returns the local address.
 func (d *DoHWriter) LocalAddr() net.Addr { return d.laddr }
 
+// Write implements dns.ResponseWriter. It unpacks b, so it is written like a message written with WriteMsg.
+func (d *DoHWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	d.Msg = m
+	return len(b), nil
+}
+
+// TsigStatus implements dns.ResponseWriter.
+func (d *DoHWriter) TsigStatus() error { return d.tsigStatus }
+
 // Request returns the HTTP request
 func (d *DoHWriter) Request() *http.Request { return d.request }
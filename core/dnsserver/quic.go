@@ -0,0 +1,62 @@
+package dnsserver
+
+import (
+	"net"
+
+	"github.com/coredns/coredns/plugin/pkg/doq"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQWriter is a dns.ResponseWriter that writes the reply to a single DNS-over-QUIC stream.
+type DoQWriter struct {
+	// raddr is the remote's address.
+	raddr net.Addr
+	// laddr is our address.
+	laddr net.Addr
+
+	stream quic.Stream
+
+	// tsigStatus is the result of verifying the TSIG signature of the request.
+	tsigStatus error
+}
+
+// WriteMsg packs m, writes it to the stream and closes the stream, as there
+// is only one response per stream in DoQ.
+func (w *DoQWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// Write writes b, with the length prefix added, to the stream and closes it.
+func (w *DoQWriter) Write(b []byte) (int, error) {
+	if _, err := w.stream.Write(doq.AddPrefix(b)); err != nil {
+		return 0, err
+	}
+	// The server MUST indicate through the STREAM FIN mechanism that no further
+	// data will be sent on that stream, see section 4.2 of RFC 9250.
+	return len(b), w.stream.Close()
+}
+
+// Close closes the stream.
+func (w *DoQWriter) Close() error { return w.stream.Close() }
+
+// TsigStatus implements dns.ResponseWriter.
+func (w *DoQWriter) TsigStatus() error { return w.tsigStatus }
+
+// TsigTimersOnly implements dns.ResponseWriter.
+func (w *DoQWriter) TsigTimersOnly(bool) {}
+
+// Hijack implements dns.ResponseWriter.
+func (w *DoQWriter) Hijack() {}
+
+// RemoteAddr returns the remote address.
+func (w *DoQWriter) RemoteAddr() net.Addr { return w.raddr }
+
+// LocalAddr returns the local address.
+func (w *DoQWriter) LocalAddr() net.Addr { return w.laddr }
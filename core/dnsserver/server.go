@@ -3,6 +3,7 @@ package dnsserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"runtime"
@@ -42,6 +43,8 @@ type Server struct {
 	trace        trace.Trace        // the trace plugin for the server
 	debug        bool               // disable recover()
 	classChaos   bool               // allow non-INET class queries
+	tsigSecret   map[string]string  // TSIG secrets of all zones
+	msgAccept    dns.MsgAcceptFunc  // accept function for the dns.Servers
 }
 
 // NewServer returns a new CoreDNS server and compiles all plugins in to it. By default CH class
@@ -52,6 +55,7 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 		Addr:         addr,
 		zones:        make(map[string]*Config),
 		graceTimeout: 5 * time.Second,
+		msgAccept:    dns.DefaultMsgAcceptFunc,
 	}
 
 	// We have to bound our wg with one increment
@@ -70,6 +74,16 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 		// set the config per zone
 		s.zones[site.Zone] = site
 
+		if site.DynamicUpdates {
+			s.msgAccept = acceptUpdates
+		}
+		for name, secret := range site.TsigSecret {
+			if s.tsigSecret == nil {
+				s.tsigSecret = make(map[string]string)
+			}
+			s.tsigSecret[name] = secret
+		}
+
 		// compile custom plugin for everything
 		var stack plugin.Handler
 		for i := len(site.Plugin) - 1; i >= 0; i-- {
@@ -101,6 +115,19 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 	return s, nil
 }
 
+// acceptUpdates is a dns.MsgAcceptFunc that accepts dynamic updates, which can have any number of
+// records in their sections, and otherwise defers to dns.DefaultMsgAcceptFunc.
+func acceptUpdates(dh dns.Header) dns.MsgAcceptAction {
+	const qr = 1 << 15
+	if opcode := int(dh.Bits>>11) & 0xF; opcode == dns.OpcodeUpdate && dh.Bits&qr == 0 {
+		if dh.Qdcount != 1 {
+			return dns.MsgReject
+		}
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
 // Compile-time check to ensure Server implements the caddy.GracefulServer interface
 var _ caddy.GracefulServer = &Server{}
 
@@ -108,7 +135,7 @@ var _ caddy.GracefulServer = &Server{}
 // This implements caddy.TCPServer interface.
 func (s *Server) Serve(l net.Listener) error {
 	s.m.Lock()
-	s.server[tcp] = &dns.Server{Listener: l, Net: "tcp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	s.server[tcp] = &dns.Server{Listener: l, Net: "tcp", TsigSecret: s.tsigSecret, MsgAcceptFunc: s.msgAccept, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		ctx = context.WithValue(ctx, LoopKey{}, 0)
 		s.ServeDNS(ctx, w, r)
@@ -122,7 +149,7 @@ func (s *Server) Serve(l net.Listener) error {
 // This implements caddy.UDPServer interface.
 func (s *Server) ServePacket(p net.PacketConn) error {
 	s.m.Lock()
-	s.server[udp] = &dns.Server{PacketConn: p, Net: "udp", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+	s.server[udp] = &dns.Server{PacketConn: p, Net: "udp", TsigSecret: s.tsigSecret, MsgAcceptFunc: s.msgAccept, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		ctx = context.WithValue(ctx, LoopKey{}, 0)
 		s.ServeDNS(ctx, w, r)
@@ -247,9 +274,9 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 				return
 			}
 			if r.Question[0].Qtype != dns.TypeDS {
-				rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
+				rcode, err := h.pluginChain.ServeDNS(ctx, w, r)
 				if !plugin.ClientWrite(rcode) {
-					errorFunc(s.Addr, w, r, rcode)
+					errorFunc(s.Addr, w, r, rcode, err)
 				}
 				return
 			}
@@ -268,18 +295,18 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 	if r.Question[0].Qtype == dns.TypeDS && dshandler != nil && dshandler.pluginChain != nil {
 		// DS request, and we found a zone, use the handler for the query.
-		rcode, _ := dshandler.pluginChain.ServeDNS(ctx, w, r)
+		rcode, err := dshandler.pluginChain.ServeDNS(ctx, w, r)
 		if !plugin.ClientWrite(rcode) {
-			errorFunc(s.Addr, w, r, rcode)
+			errorFunc(s.Addr, w, r, rcode, err)
 		}
 		return
 	}
 
 	// Wildcard match, if we have found nothing try the root zone as a last resort.
 	if h, ok := s.zones["."]; ok && h.pluginChain != nil {
-		rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
+		rcode, err := h.pluginChain.ServeDNS(ctx, w, r)
 		if !plugin.ClientWrite(rcode) {
-			errorFunc(s.Addr, w, r, rcode)
+			errorFunc(s.Addr, w, r, rcode, err)
 		}
 		return
 	}
@@ -310,14 +337,34 @@ func (s *Server) Tracer() ot.Tracer {
 	return s.trace.Tracer()
 }
 
-// errorFunc responds to an DNS request with an error.
-func errorFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int) {
+// verifyTsig verifies the TSIG signature of the request r, read from the wire as buf, just as dns.Server
+// does for UDP, TCP and TLS. The result is returned by TsigStatus of the response writer.
+func (s *Server) verifyTsig(buf []byte, r *dns.Msg) error {
+	t := r.IsTsig()
+	if t == nil {
+		return nil
+	}
+	secret, ok := s.tsigSecret[t.Hdr.Name]
+	if !ok {
+		return dns.ErrSecret
+	}
+	return dns.TsigVerify(buf, secret, "", false)
+}
+
+// errorFunc responds to an DNS request with an error. When err carries an Extended DNS Error, it is added
+// to the reply.
+func errorFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int, err error) {
 	state := request.Request{W: w, Req: r}
 
 	answer := new(dns.Msg)
 	answer.SetRcode(r, rc)
 	state.SizeAndDo(answer)
 
+	var ede *edns.Error
+	if errors.As(err, &ede) {
+		edns.SetExtendedError(r, answer, ede.Code, ede.Text)
+	}
+
 	w.WriteMsg(answer)
 }
 
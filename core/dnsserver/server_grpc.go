@@ -131,7 +131,7 @@ func (s *ServergRPC) Query(ctx context.Context, in *pb.DnsPacket) (*pb.DnsPacket
 		return nil, fmt.Errorf("no TCP peer in gRPC context: %v", p.Addr)
 	}
 
-	w := &gRPCresponse{localAddr: s.listenAddr, remoteAddr: a, Msg: msg}
+	w := &gRPCresponse{localAddr: s.listenAddr, remoteAddr: a, Msg: msg, tsigStatus: s.verifyTsig(in.Msg, msg)}
 
 	dnsCtx := context.WithValue(ctx, Key{}, s.Server)
 	dnsCtx = context.WithValue(dnsCtx, LoopKey{}, 0)
@@ -157,6 +157,7 @@ type gRPCresponse struct {
 	localAddr  net.Addr
 	remoteAddr net.Addr
 	Msg        *dns.Msg
+	tsigStatus error // the result of verifying the TSIG signature of the request
 }
 
 // Write is the hack that makes this work. It does not actually write the message
@@ -169,7 +170,7 @@ func (r *gRPCresponse) Write(b []byte) (int, error) {
 
 // These methods implement the dns.ResponseWriter interface from Go DNS.
 func (r *gRPCresponse) Close() error              { return nil }
-func (r *gRPCresponse) TsigStatus() error         { return nil }
+func (r *gRPCresponse) TsigStatus() error         { return r.tsigStatus }
 func (r *gRPCresponse) TsigTimersOnly(b bool)     {}
 func (r *gRPCresponse) Hijack()                   {}
 func (r *gRPCresponse) LocalAddr() net.Addr       { return r.localAddr }
@@ -15,6 +15,8 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/plugin/pkg/reuseport"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
 )
 
 // ServerHTTPS represents an instance of a DNS-over-HTTPS server.
@@ -131,19 +133,25 @@ func (s *ServerHTTPS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg, err := doh.RequestToMsg(r)
+	buf, err := doh.RequestToBuf(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(buf); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Create a DoHWriter with the correct addresses in it.
 	h, p, _ := net.SplitHostPort(r.RemoteAddr)
 	port, _ := strconv.Atoi(p)
 	dw := &DoHWriter{
-		laddr:   s.listenAddr,
-		raddr:   &net.TCPAddr{IP: net.ParseIP(h), Port: port},
-		request: r,
+		laddr:      s.listenAddr,
+		raddr:      &net.TCPAddr{IP: net.ParseIP(h), Port: port},
+		request:    r,
+		tsigStatus: s.verifyTsig(buf, msg),
 	}
 
 	// We just call the normal chain handler - all error handling is done there.
@@ -160,7 +168,7 @@ func (s *ServerHTTPS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	buf, _ := dw.Msg.Pack()
+	buf, _ = dw.Msg.Pack()
 
 	mt, _ := response.Typify(dw.Msg, time.Now().UTC())
 	age := dnsutil.MinimalTTL(dw.Msg, mt)
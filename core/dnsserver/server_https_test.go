@@ -2,12 +2,17 @@ package dnsserver
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"testing"
 
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/doh"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
 	"github.com/miekg/dns"
 )
 
@@ -64,3 +69,63 @@ func TestCustomHTTPRequestValidator(t *testing.T) {
 		})
 	}
 }
+
+type tsigPlugin struct{ key *tsig.Key }
+
+func (tp tsigPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if err := tp.key.Verify(w, r); err != nil {
+		return dns.RcodeNotAuth, tsig.Refuse(w, r, err)
+	}
+	m := new(dns.Msg)
+	m.SetReply(r)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+func (tp tsigPlugin) Name() string { return "tsigplugin" }
+
+func TestServeHTTPTsig(t *testing.T) {
+	key, _ := tsig.NewKey("key.", "c2VjcmV0", "")
+	c := Config{
+		Zone:        "example.com.",
+		Transport:   "https",
+		TLSConfig:   &tls.Config{},
+		ListenHosts: []string{"127.0.0.1"},
+		Port:        "443",
+	}
+	c.AddTsigSecret(key.Name, key.Secret)
+	c.AddPlugin(func(next plugin.Handler) plugin.Handler { return tsigPlugin{key: key} })
+	s, err := NewServerHTTPS("127.0.0.1:443", []*Config{&c})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServerHTTPS, got %s", err)
+	}
+
+	tests := []struct {
+		secret   string
+		expected int
+	}{
+		{key.Secret, dns.RcodeSuccess},
+		{"b3RoZXI=", dns.RcodeNotAuth},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeSOA)
+		key.Sign(m)
+		buf, _, err := dns.TsigGenerate(m, tc.secret, "", false)
+		if err != nil {
+			t.Fatalf("Test %d: failed to sign the query: %s", i, err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(buf))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		res, err := doh.ResponseToMsg(w.Result())
+		if err != nil {
+			t.Fatalf("Test %d: expected a reply, got %s", i, err)
+		}
+		if res.Rcode != tc.expected {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.expected], dns.RcodeToString[res.Rcode])
+		}
+	}
+}
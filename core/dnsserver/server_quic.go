@@ -0,0 +1,220 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/doq"
+	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/reuseport"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// ServerQUIC represents an instance of a DNS-over-QUIC server.
+type ServerQUIC struct {
+	*Server
+	listener   *quic.EarlyListener
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+}
+
+// NewServerQUIC returns a new CoreDNS QUIC server and compiles all plugins in to it.
+func NewServerQUIC(addr string, group []*Config) (*ServerQUIC, error) {
+	s, err := NewServer(addr, group)
+	if err != nil {
+		return nil, err
+	}
+	// The *tls* plugin must make sure that multiple conflicting
+	// TLS configuration returns an error: it can only be specified once.
+	var tlsConfig *tls.Config
+	for _, conf := range s.zones {
+		// Should we error if some configs *don't* have TLS?
+		tlsConfig = conf.TLSConfig
+	}
+	if tlsConfig == nil {
+		return nil, fmt.Errorf("DoQ requires TLS to be configured, see the tls plugin")
+	}
+	// The TLS config is shared with other servers, so make a copy before setting the ALPN token.
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{doq.NextProto}
+
+	quicConfig := &quic.Config{
+		MaxIdleTimeout:        quicIdleTimeout,
+		MaxIncomingStreams:    quicMaxStreams,
+		MaxIncomingUniStreams: -1, // DoQ only uses bidirectional streams.
+		Allow0RTT:             true,
+	}
+	for _, conf := range s.zones {
+		if conf.MaxQUICStreams > 0 {
+			quicConfig.MaxIncomingStreams = int64(conf.MaxQUICStreams)
+		}
+		if conf.QUICReject0RTT {
+			quicConfig.Allow0RTT = false
+		}
+	}
+
+	return &ServerQUIC{Server: s, tlsConfig: tlsConfig, quicConfig: quicConfig}, nil
+}
+
+// Compile-time check to ensure Server implements the caddy.GracefulServer interface
+var _ caddy.GracefulServer = &Server{}
+
+// Serve implements caddy.TCPServer interface.
+func (s *ServerQUIC) Serve(l net.Listener) error { return nil }
+
+// ServePacket implements caddy.UDPServer interface.
+func (s *ServerQUIC) ServePacket(p net.PacketConn) error {
+	l, err := quic.ListenEarly(p, s.tlsConfig, s.quicConfig)
+	if err != nil {
+		return err
+	}
+	s.m.Lock()
+	s.listener = l
+	s.m.Unlock()
+
+	for {
+		conn, err := l.Accept(context.Background())
+		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Listen implements caddy.TCPServer interface.
+func (s *ServerQUIC) Listen() (net.Listener, error) { return nil, nil }
+
+// ListenPacket implements caddy.UDPServer interface.
+func (s *ServerQUIC) ListenPacket() (net.PacketConn, error) {
+	p, err := reuseport.ListenPacket("udp", s.Addr[len(transport.QUIC+"://"):])
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// OnStartupComplete lists the sites served by this server
+// and any relevant information, assuming Quiet is false.
+func (s *ServerQUIC) OnStartupComplete() {
+	if Quiet {
+		return
+	}
+
+	out := startUpZones(transport.QUIC+"://", s.Addr, s.zones)
+	if out != "" {
+		fmt.Print(out)
+	}
+}
+
+// Stop stops the server. It blocks until the server is totally stopped.
+func (s *ServerQUIC) Stop() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// serveConn handles all streams on a single QUIC connection. Each stream carries exactly one query.
+func (s *ServerQUIC) serveConn(conn quic.EarlyConnection) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			// The client closed the connection or it timed out.
+			return
+		}
+		go s.serveStream(conn, stream)
+	}
+}
+
+// serveStream reads the query from stream, calls the plugin chain and writes the reply back on the
+// same stream.
+func (s *ServerQUIC) serveStream(conn quic.EarlyConnection, stream quic.Stream) {
+	stream.SetReadDeadline(time.Now().Add(quicReadTimeout))
+	buf, err := doq.ReadBuf(stream)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			log.Debugf("Failed to read DoQ query from %s: %s", conn.RemoteAddr(), err)
+		}
+		conn.CloseWithError(doq.CodeProtocolError, "")
+		return
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(buf); err != nil {
+		log.Debugf("Failed to unpack DoQ query from %s: %s", conn.RemoteAddr(), err)
+		conn.CloseWithError(doq.CodeProtocolError, "")
+		return
+	}
+
+	// A message ID other than zero and the edns-tcp-keepalive option are protocol errors,
+	// see sections 4.2.1 and 5.5.2 of RFC 9250.
+	if !validQUICQuery(r) {
+		conn.CloseWithError(doq.CodeProtocolError, "")
+		return
+	}
+
+	// Queries received as 0-RTT data may be replayed by an attacker; only standard
+	// queries are safe to answer before the handshake is complete, see section 4.5 of RFC 9250.
+	if r.Opcode != dns.OpcodeQuery {
+		select {
+		case <-conn.HandshakeComplete():
+		case <-conn.Context().Done():
+			return
+		}
+	}
+
+	w := &DoQWriter{
+		laddr:      quicToTCPAddr(conn.LocalAddr()),
+		raddr:      quicToTCPAddr(conn.RemoteAddr()),
+		stream:     stream,
+		tsigStatus: s.verifyTsig(buf, r),
+	}
+
+	ctx := context.WithValue(context.Background(), Key{}, s.Server)
+	ctx = context.WithValue(ctx, LoopKey{}, 0)
+	s.ServeDNS(ctx, w, r)
+}
+
+// validQUICQuery returns true if r is a valid DoQ query.
+func validQUICQuery(r *dns.Msg) bool {
+	if r.Id != 0 {
+		return false
+	}
+	if o := r.IsEdns0(); o != nil {
+		for _, e := range o.Option {
+			if e.Option() == dns.EDNS0TCPKEEPALIVE {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// quicToTCPAddr converts the UDP address of a QUIC connection into a TCP address. DoQ
+// is a stream based transport, and for the rest of the plugin chain it behaves like TCP:
+// responses must not be truncated to fit in a datagram.
+func quicToTCPAddr(a net.Addr) net.Addr {
+	if u, ok := a.(*net.UDPAddr); ok {
+		return &net.TCPAddr{IP: u.IP, Port: u.Port, Zone: u.Zone}
+	}
+	return a
+}
+
+const (
+	quicIdleTimeout = 30 * time.Second
+	quicReadTimeout = 5 * time.Second
+	quicMaxStreams  = 256
+)
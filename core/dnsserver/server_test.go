@@ -2,9 +2,13 @@ package dnsserver
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/test"
 
@@ -76,6 +80,35 @@ func TestDebug(t *testing.T) {
 	}
 }
 
+type errorPlugin struct{ err error }
+
+func (ep errorPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	return dns.RcodeServerFailure, ep.err
+}
+
+func (ep errorPlugin) Name() string { return "errorplugin" }
+
+func TestServeDNSExtendedError(t *testing.T) {
+	err := &edns.Error{Err: errors.New("broken"), Code: dns.ExtendedErrorCodeNetworkError}
+	s, err1 := NewServer("127.0.0.1:53", []*Config{testConfig("dns", errorPlugin{err: fmt.Errorf("wrapped: %w", err)})})
+	if err1 != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err1)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("aaa.example.com.", dns.TypeTXT)
+	m.SetEdns0(4096, false)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	s.ServeDNS(context.TODO(), rec, m)
+
+	if rec.Msg == nil || rec.Msg.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("Expected SERVFAIL, got %v", rec.Msg)
+	}
+	if ede := edns.ExtendedError(rec.Msg); ede == nil || ede.InfoCode != dns.ExtendedErrorCodeNetworkError {
+		t.Errorf("Expected a network error extended error, got %v", ede)
+	}
+}
+
 func BenchmarkCoreServeDNS(b *testing.B) {
 	s, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", testPlugin{})})
 	if err != nil {
@@ -13,6 +13,7 @@ var Directives = []string{
 	"metadata",
 	"cancel",
 	"tls",
+	"quic",
 	"reload",
 	"nsid",
 	"bufsize",
@@ -29,6 +30,9 @@ var Directives = []string{
 	"dnstap",
 	"local",
 	"dns64",
+	"cookie",
+	"ratelimit",
+	"rrl",
 	"acl",
 	"any",
 	"chaos",
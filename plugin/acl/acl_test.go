@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/test"
 
 	"github.com/miekg/dns"
@@ -420,3 +422,39 @@ func TestACLServeDNS(t *testing.T) {
 		})
 	}
 }
+
+func TestACLExtendedError(t *testing.T) {
+	tests := []struct {
+		config string
+		code   uint16
+	}{
+		{`acl {
+			block net 192.168.0.0/16
+		}`, dns.ExtendedErrorCodeProhibited},
+		{`acl {
+			filter net 192.168.0.0/16
+		}`, dns.ExtendedErrorCodeBlocked},
+	}
+
+	for i, tc := range tests {
+		a, err := parse(NewTestControllerWithZones(tc.config, []string{"example.org."}))
+		if err != nil {
+			t.Fatalf("Test %d: cannot parse acl from config: %v", i, err)
+		}
+		a.Next = test.NextHandler(dns.RcodeSuccess, nil)
+
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.org.", dns.TypeA)
+		m.SetEdns0(4096, false)
+		w := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "192.168.0.2"})
+		a.ServeDNS(context.Background(), w, m)
+
+		ede := edns.ExtendedError(w.Msg)
+		if ede == nil {
+			t.Fatalf("Test %d: expected an extended error, got none", i)
+		}
+		if ede.InfoCode != tc.code {
+			t.Errorf("Test %d: expected extended error %d, got %d", i, tc.code, ede.InfoCode)
+		}
+	}
+}
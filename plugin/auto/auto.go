@@ -33,6 +33,7 @@ type (
 		re        *regexp.Regexp
 
 		ReloadInterval time.Duration
+		JournalSize    int
 		upstream       *upstream.Upstream // Upstream for looking up names during the resolution process.
 	}
 )
@@ -4,11 +4,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
 	"github.com/coredns/coredns/plugin/metrics"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
@@ -79,6 +81,7 @@ func autoParse(c *caddy.Controller) (Auto, error) {
 			template:       "${1}",
 			re:             regexp.MustCompile(`db\.(.*)`),
 			ReloadInterval: nilInterval,
+			JournalSize:    file.DefaultJournalSize,
 		},
 		Zones: &Zones{},
 	}
@@ -137,6 +140,17 @@ func autoParse(c *caddy.Controller) (Auto, error) {
 				}
 				a.loader.ReloadInterval = d
 
+			case "journal":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return Auto{}, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return Auto{}, c.Errf("invalid journal size %q", args[0])
+				}
+				a.loader.JournalSize = n
+
 			case "upstream":
 				// remove soon
 				c.RemainingArgs() // eat remaining args
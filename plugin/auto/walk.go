@@ -52,6 +52,7 @@ func (a Auto) Walk() error {
 		}
 
 		zo.ReloadInterval = a.loader.ReloadInterval
+		zo.JournalSize = a.loader.JournalSize
 		zo.Upstream = a.loader.upstream
 
 		a.Zones.Add(zo, origin, a.transfer)
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/reuseport"
+	"github.com/coredns/coredns/plugin/pkg/uniq"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	caches    = &registry{}
+	uniqAdmin = uniq.New()
+)
+
+// registry holds all caches, of all server blocks, so the admin endpoint can inspect and flush them.
+type registry struct {
+	sync.RWMutex
+	caches []*Cache
+}
+
+func (r *registry) add(c *Cache) {
+	r.Lock()
+	defer r.Unlock()
+	for _, c1 := range r.caches {
+		if c1 == c {
+			return
+		}
+	}
+	r.caches = append(r.caches, c)
+}
+
+func (r *registry) remove(c *Cache) {
+	r.Lock()
+	defer r.Unlock()
+	for i, c1 := range r.caches {
+		if c1 == c {
+			r.caches = append(r.caches[:i], r.caches[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *registry) all() []*Cache {
+	r.RLock()
+	defer r.RUnlock()
+	return append([]*Cache(nil), r.caches...)
+}
+
+// admin is the HTTP endpoint to list and flush the entries in the caches.
+type admin struct {
+	Addr string
+
+	sync.Mutex
+	ln net.Listener
+}
+
+func (a *admin) onStartup() error {
+	ln, err := reuseport.Listen("tcp", a.Addr)
+	if err != nil {
+		return err
+	}
+
+	a.Lock()
+	a.ln = ln
+	a.Unlock()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/entries", entriesHandler)
+	mux.HandleFunc("/cache/flush", flushHandler)
+
+	go func() { http.Serve(ln, mux) }()
+
+	return nil
+}
+
+func (a *admin) onFinalShutdown() error {
+	a.Lock()
+	defer a.Unlock()
+	if a.ln == nil {
+		return nil
+	}
+
+	uniqAdmin.Unset(a.Addr)
+
+	a.ln.Close()
+	a.ln = nil
+	return nil
+}
+
+// Entry is a cache entry as listed by the admin endpoint.
+type Entry struct {
+	Zones  []string `json:"zones"` // zones of the cache holding the entry
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Cache  string   `json:"cache"` // "success" or "denial"
+	Rcode  string   `json:"rcode"`
+	TTL    int      `json:"ttl"` // remaining TTL, negative for stale entries
+	Subnet string   `json:"subnet,omitempty"`
+}
+
+// filter selects entries by exact name or by zone, an empty filter selects everything.
+type filter struct {
+	name string
+	zone string
+}
+
+func newFilter(r *http.Request) filter {
+	f := filter{}
+	if n := r.URL.Query().Get("name"); n != "" {
+		f.name = dns.Fqdn(strings.ToLower(n))
+	}
+	if z := r.URL.Query().Get("zone"); z != "" {
+		f.zone = dns.Fqdn(strings.ToLower(z))
+	}
+	return f
+}
+
+func (f filter) match(name string) bool {
+	if f.name != "" && f.name != name {
+		return false
+	}
+	if f.zone != "" && !dns.IsSubDomain(f.zone, name) {
+		return false
+	}
+	return true
+}
+
+// entriesHandler lists the entries of all caches, optionally filtered by the name and zone parameters.
+func entriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	f := newFilter(r)
+
+	entries := []Entry{}
+	for _, c := range caches.all() {
+		entries = append(entries, c.entries(f, c.pcache, Success)...)
+		entries = append(entries, c.entries(f, c.ncache, Denial)...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// flushHandler removes the entries selected by the name and zone parameters from all caches, without
+// parameters all entries are removed.
+func flushHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	f := newFilter(r)
+
+	n := 0
+	for _, c := range caches.all() {
+		n += c.flush(f)
+	}
+	log.Infof("Flushed %d cache entries", n)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Flushed int `json:"flushed"`
+	}{n})
+}
+
+// entries returns the entries in ca matching f.
+func (c *Cache) entries(f filter, ca *cache.Cache, class string) []Entry {
+	now := c.now().UTC()
+	entries := []Entry{}
+	ca.Walk(func(items map[uint64]interface{}, key uint64) bool {
+		i, ok := items[key].(*item)
+		if !ok || !f.match(i.name) {
+			return true
+		}
+		e := Entry{
+			Zones: c.Zones,
+			Name:  i.name,
+			Type:  dns.Type(i.qtype).String(),
+			Cache: class,
+			Rcode: dns.RcodeToString[i.Rcode],
+			TTL:   i.ttl(now),
+		}
+		if i.subnet != nil {
+			e.Subnet = i.subnet.String()
+		}
+		entries = append(entries, e)
+		return true
+	})
+	return entries
+}
+
+// flush removes the entries matching f from c, and returns how many were removed.
+func (c *Cache) flush(f filter) int {
+	n := 0
+	remove := func(items map[uint64]interface{}, key uint64) bool {
+		if i, ok := items[key].(*item); ok && f.match(i.name) {
+			delete(items, key)
+			n++
+		}
+		return true
+	}
+	c.pcache.Walk(remove)
+	c.ncache.Walk(remove)
+	if c.nsecs != nil {
+		// The NSEC and NSEC3 records of the zones would otherwise still deny the flushed names.
+		c.nsecs.zones.Walk(func(items map[uint64]interface{}, key uint64) bool {
+			if z, ok := items[key].(*nsecZone); ok && (f.zone == "" || dns.IsSubDomain(f.zone, z.name)) && (f.name == "" || dns.IsSubDomain(z.name, f.name)) {
+				delete(items, key)
+			}
+			return true
+		})
+	}
+	return n
+}
+
+// defaultAdminAddr is the address of the admin endpoint when none is given, it is only reachable
+// from the host itself.
+const defaultAdminAddr = "localhost:9154"
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func newAdminCache(t *testing.T) *Cache {
+	c := New()
+	for _, name := range []string{"a.example.org.", "b.example.org.", "example.net."} {
+		c.Next = ttlBackend(60)
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	}
+	c.Next = nxDomainBackend(60)
+	req := new(dns.Msg)
+	req.SetQuestion("nx.example.org.", dns.TypeA)
+	c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+
+	caches.add(c)
+	t.Cleanup(func() { caches.remove(c) })
+	return c
+}
+
+func listEntries(t *testing.T, query string) []Entry {
+	rec := httptest.NewRecorder()
+	entriesHandler(rec, httptest.NewRequest(http.MethodGet, "/cache/entries"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	entries := []Entry{}
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode the entries: %s", err)
+	}
+	return entries
+}
+
+func flushEntries(t *testing.T, query string) int {
+	rec := httptest.NewRecorder()
+	flushHandler(rec, httptest.NewRequest(http.MethodPost, "/cache/flush"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	flushed := struct{ Flushed int }{}
+	if err := json.NewDecoder(rec.Body).Decode(&flushed); err != nil {
+		t.Fatalf("Failed to decode the response: %s", err)
+	}
+	return flushed.Flushed
+}
+
+func TestAdminEntries(t *testing.T) {
+	newAdminCache(t)
+
+	if entries := listEntries(t, ""); len(entries) != 4 {
+		t.Errorf("Expected 4 entries, got %d", len(entries))
+	}
+	if entries := listEntries(t, "?zone=example.org"); len(entries) != 3 {
+		t.Errorf("Expected 3 entries in example.org, got %d", len(entries))
+	}
+
+	entries := listEntries(t, "?name=NX.example.org.")
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Name != "nx.example.org." || e.Type != "A" || e.Cache != Denial || e.Rcode != "NXDOMAIN" || e.TTL <= 0 || e.TTL > 60 {
+		t.Errorf("Unexpected entry %v", e)
+	}
+}
+
+func TestAdminFlush(t *testing.T) {
+	c := newAdminCache(t)
+
+	if n := flushEntries(t, "?name=a.example.org"); n != 1 {
+		t.Errorf("Expected 1 flushed entry, got %d", n)
+	}
+	if n := flushEntries(t, "?zone=example.org"); n != 2 {
+		t.Errorf("Expected 2 flushed entries, got %d", n)
+	}
+	if l := c.pcache.Len() + c.ncache.Len(); l != 1 {
+		t.Errorf("Expected 1 entry left, got %d", l)
+	}
+	if n := flushEntries(t, ""); n != 1 {
+		t.Errorf("Expected 1 flushed entry, got %d", n)
+	}
+
+	rec := httptest.NewRecorder()
+	flushHandler(rec, httptest.NewRequest(http.MethodGet, "/cache/flush", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for GET, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
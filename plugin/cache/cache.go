@@ -31,12 +31,29 @@ type Cache struct {
 	pttl    time.Duration
 	minpttl time.Duration
 
+	// Memory bounds in bytes, zero when the caches are only bounded by their capacity.
+	pmem   int64
+	nmem   int64
+	policy cache.Policy
+
 	// Prefetch.
 	prefetch   int
 	duration   time.Duration
 	percentage int
 
-	staleUpTo time.Duration
+	staleUpTo    time.Duration
+	staleTimeout time.Duration // client response timer of RFC 8767, zero to serve stale items immediately
+
+	ecs *ecs // nil when caching isn't ECS aware
+
+	adminAddr string // address of the admin endpoint, if enabled
+
+	nsecs *nsecs // nil when aggressive use of NSEC and NSEC3 records is disabled
+
+	// Persistence.
+	persistFile     string
+	persistInterval time.Duration
+	persistStop     chan struct{}
 
 	// Testing.
 	now func() time.Time
@@ -106,6 +123,7 @@ type ResponseWriter struct {
 
 	do         bool // When true the original request had the DO bit set.
 	prefetch   bool // When true write nothing back to the client.
+	refresh    bool // When true we refresh an item in the cache, which a server failure must not replace.
 	remoteAddr net.Addr
 }
 
@@ -129,6 +147,7 @@ func newPrefetchResponseWriter(server string, state request.Request, c *Cache) *
 		state:          state,
 		server:         server,
 		prefetch:       true,
+		refresh:        true,
 		remoteAddr:     addr,
 	}
 }
@@ -159,11 +178,26 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 		duration = computeTTL(msgTTL, w.minpttl, w.pttl)
 	}
 
+	// Keep serving the item we have, rather than the failure to refresh it.
+	if mt == response.ServerError && w.refresh {
+		hasKey = false
+	}
+
+	var sn *subnet
+	if hasKey && w.ecs != nil {
+		key, sn, hasKey = w.ecsKey(key, res)
+	}
+
 	if hasKey && duration > 0 {
 		if w.state.Match(res) {
-			w.set(res, key, mt, duration)
+			if sn != nil {
+				w.addSubnet(key, *sn)
+			}
+			w.set(res, key, mt, duration, sn)
 			cacheSize.WithLabelValues(w.server, Success).Set(float64(w.pcache.Len()))
 			cacheSize.WithLabelValues(w.server, Denial).Set(float64(w.ncache.Len()))
+			cacheBytes.WithLabelValues(w.server, Success).Set(float64(w.pcache.Cost()))
+			cacheBytes.WithLabelValues(w.server, Denial).Set(float64(w.ncache.Cost()))
 		} else {
 			// Don't log it, but increment counter
 			cacheDrops.WithLabelValues(w.server).Inc()
@@ -184,15 +218,14 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 	return w.ResponseWriter.WriteMsg(res)
 }
 
-func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration time.Duration) {
+func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration time.Duration, sn *subnet) {
 	// duration is expected > 0
 	// and key is valid
 	switch mt {
 	case response.NoError, response.Delegation:
 		i := newItem(m, w.now(), duration)
-		if w.pcache.Add(key, i) {
-			evictions.WithLabelValues(w.server, Success).Inc()
-		}
+		i.name, i.qtype, i.subnet = w.state.Name(), w.state.QType(), sn
+		w.evicted(w.pcache.Put(key, i), Success)
 		// when pre-fetching, remove the negative cache entry if it exists
 		if w.prefetch {
 			w.ncache.Remove(key)
@@ -200,8 +233,10 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 
 	case response.NameError, response.NoData, response.ServerError:
 		i := newItem(m, w.now(), duration)
-		if w.ncache.Add(key, i) {
-			evictions.WithLabelValues(w.server, Denial).Inc()
+		i.name, i.qtype, i.subnet = w.state.Name(), w.state.QType(), sn
+		w.evicted(w.ncache.Put(key, i), Denial)
+		if w.nsecs != nil && mt != response.ServerError && m.AuthenticatedData {
+			w.nsecs.add(m, w.now(), w.nttl)
 		}
 
 	case response.OtherError:
@@ -211,6 +246,19 @@ func (w *ResponseWriter) set(m *dns.Msg, key uint64, mt response.Type, duration
 	}
 }
 
+// evicted updates the eviction metrics for the cache of type t.
+func (w *ResponseWriter) evicted(e cache.Evictions, t string) {
+	if !e.Evicted() {
+		return
+	}
+	evictions.WithLabelValues(w.server, t).Inc()
+	for r, n := range e {
+		if n > 0 {
+			evictionReasons.WithLabelValues(w.server, t, cache.Reason(r).String()).Add(float64(n))
+		}
+	}
+}
+
 // Write implements the dns.ResponseWriter interface.
 func (w *ResponseWriter) Write(buf []byte) (int, error) {
 	log.Warning("Caching called with Write: not caching reply")
@@ -7,12 +7,15 @@ import (
 	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 type cacheTestCase struct {
@@ -201,7 +204,7 @@ func TestCache(t *testing.T) {
 		valid, k := key(state.Name(), m, mt)
 
 		if valid {
-			crr.set(m, k, mt, c.pttl)
+			crr.set(m, k, mt, c.pttl, nil)
 		}
 
 		i, _ := c.get(time.Now().UTC(), state, "dns://:53")
@@ -300,6 +303,126 @@ func TestServeFromStaleCache(t *testing.T) {
 	}
 }
 
+func TestServeFromStaleCacheExtendedError(t *testing.T) {
+	c := New()
+	c.Next = ttlBackend(60)
+	c.staleUpTo = 1 * time.Hour
+
+	req := new(dns.Msg)
+	req.SetQuestion("cached.org.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	ctx := context.TODO()
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	c.ServeDNS(ctx, rec, req)
+	if ede := edns.ExtendedError(rec.Msg); ede != nil {
+		t.Errorf("Expected no extended error for a fresh answer, got %v", ede)
+	}
+
+	c.Next = plugin.HandlerFunc(func(context.Context, dns.ResponseWriter, *dns.Msg) (int, error) {
+		return 255, nil
+	})
+	c.now = func() time.Time { return time.Now().Add(30 * time.Minute) }
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	c.ServeDNS(ctx, rec, req)
+	ede := edns.ExtendedError(rec.Msg)
+	if ede == nil || ede.InfoCode != dns.ExtendedErrorCodeStaleAnswer {
+		t.Errorf("Expected a stale answer extended error, got %v", ede)
+	}
+}
+
+func TestServeStaleClientTimeout(t *testing.T) {
+	c := New()
+	c.Next = ttlBackend(60)
+	c.staleUpTo = 1 * time.Hour
+	c.staleTimeout = 50 * time.Millisecond
+
+	req := new(dns.Msg)
+	req.SetQuestion("cached.org.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	ctx := context.TODO()
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	c.ServeDNS(ctx, rec, req)
+
+	tests := []struct {
+		next  plugin.Handler
+		stale bool
+	}{
+		{ttlBackend(60), false}, // answers in time
+		{plugin.HandlerFunc(func(context.Context, dns.ResponseWriter, *dns.Msg) (int, error) {
+			return dns.RcodeServerFailure, nil
+		}), true}, // fails
+		{plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			time.Sleep(200 * time.Millisecond)
+			return ttlBackend(60).ServeDNS(ctx, w, r)
+		}), true}, // times out
+	}
+	for i, tc := range tests {
+		c.Next = tc.next
+		c.now = func() time.Time { return time.Now().Add(time.Duration(i+1) * 30 * time.Minute) }
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(ctx, rec, req)
+
+		ede := edns.ExtendedError(rec.Msg)
+		if stale := ede != nil && ede.InfoCode == dns.ExtendedErrorCodeStaleAnswer; stale != tc.stale {
+			t.Errorf("Test %d: expected stale answer %t, got %t", i, tc.stale, stale)
+		}
+		if tc.stale && rec.Msg.Answer[0].Header().Ttl != 0 {
+			t.Errorf("Test %d: expected TTL 0 for a stale answer, got %d", i, rec.Msg.Answer[0].Header().Ttl)
+		}
+		if !tc.stale && rec.Msg.Answer[0].Header().Ttl == 0 {
+			t.Errorf("Test %d: expected a fresh answer", i)
+		}
+	}
+}
+
+func TestServeStaleRefreshFailure(t *testing.T) {
+	servfail := func(done chan struct{}) plugin.Handler {
+		return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			if done != nil {
+				done <- struct{}{}
+			}
+			return dns.RcodeServerFailure, nil
+		})
+	}
+
+	for _, timeout := range []time.Duration{0, 50 * time.Millisecond} {
+		c := New()
+		c.Next = ttlBackend(60)
+		c.staleUpTo = 1 * time.Hour
+		c.staleTimeout = timeout
+
+		req := new(dns.Msg)
+		req.SetQuestion("cached.org.", dns.TypeA)
+		ctx := context.TODO()
+		c.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), req)
+
+		// The refreshes fail, and must not replace the stale item with the failure.
+		done := make(chan struct{}, 1)
+		c.Next = servfail(done)
+		c.now = func() time.Time { return time.Now().Add(30 * time.Minute) }
+		for i := 0; i < 2; i++ {
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			c.ServeDNS(ctx, rec, req)
+			// Wait for the refresh, if any.
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+			}
+			if rec.Msg.Rcode != dns.RcodeSuccess || len(rec.Msg.Answer) != 1 {
+				t.Errorf("Timeout %s, query %d: expected the stale answer, got %v", timeout, i, rec.Msg)
+			}
+		}
+		if c.ncache.Len() != 0 {
+			t.Errorf("Timeout %s: expected the failures not to be cached, got %d items", timeout, c.ncache.Len())
+		}
+	}
+}
+
 func TestNegativeStaleMaskingPositiveCache(t *testing.T) {
 	c := New()
 	c.staleUpTo = time.Minute * 10
@@ -469,3 +592,25 @@ func TestComputeTTL(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheMemory(t *testing.T) {
+	const mem = 256 * 1024
+	c := New()
+	c.pcache = newCache(0, mem, cache.TinyLFU)
+	c.Next = BackendHandler()
+
+	for i := 0; i < 4000; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion(fmt.Sprintf("%d.example.org.", i), dns.TypeA)
+		c.ServeDNS(context.TODO(), &test.ResponseWriter{}, req)
+	}
+	if x := c.pcache.Cost(); x == 0 || x > mem {
+		t.Errorf("Expected the cache to use at most %d bytes, got %d", mem, x)
+	}
+	if x := c.pcache.Len(); x >= 4000 {
+		t.Errorf("Expected items to be evicted, got %d items", x)
+	}
+	if x := testutil.ToFloat64(cacheBytes.WithLabelValues("", Success)); int64(x) != c.pcache.Cost() {
+		t.Errorf("Expected the size metric to be %d bytes, got %v", c.pcache.Cost(), x)
+	}
+}
@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ecs holds the settings for EDNS Client Subnet (RFC 7871) aware caching. Responses with a scope
+// prefix length are only served to clients in that subnet. They are stored under a key made from the
+// key of the name and the subnet; for each name we keep track of the subnets that are cached.
+type ecs struct {
+	scope4  uint8 // longest IPv4 scope that is cached
+	scope6  uint8 // longest IPv6 scope that is cached
+	entries int   // maximum number of subnets cached per name
+
+	names *cache.Cache // key of the name -> *subnets
+}
+
+// subnet is the scope a response for the name with key name is cached for.
+type subnet struct {
+	name   uint64
+	family uint16
+	scope  uint8
+	ip     net.IP
+}
+
+// String returns the subnet in CIDR notation.
+func (n subnet) String() string {
+	bits := net.IPv6len * 8
+	if n.family == 1 {
+		bits = net.IPv4len * 8
+	}
+	return (&net.IPNet{IP: n.ip.Mask(net.CIDRMask(int(n.scope), bits)), Mask: net.CIDRMask(int(n.scope), bits)}).String()
+}
+
+// subnets are the keys of the subnets cached for a name.
+type subnets struct {
+	sync.Mutex
+	keys map[uint64]subnet
+}
+
+// clientSubnet returns the family, address and source prefix length of the client in state. These come
+// from the ECS option of the request, or from the client's address if there is none.
+func clientSubnet(state request.Request) (uint16, net.IP, uint8) {
+	if s := edns.Subnet(state.Req); s != nil {
+		return s.Family, s.Address, s.SourceNetmask
+	}
+	ip := net.ParseIP(state.IP())
+	if ip4 := ip.To4(); ip4 != nil {
+		return 1, ip4, net.IPv4len * 8
+	}
+	return 2, ip, net.IPv6len * 8
+}
+
+// ecsHash returns the key for the subnet of ip with prefix length scope, of the name with key k.
+func ecsHash(k uint64, family uint16, scope uint8, ip net.IP) uint64 {
+	bits := net.IPv6len * 8
+	if family == 1 {
+		ip = ip.To4()
+		bits = net.IPv4len * 8
+	}
+	h := fnv.New64()
+	b := make([]byte, 11)
+	binary.BigEndian.PutUint64(b, k)
+	binary.BigEndian.PutUint16(b[8:], family)
+	b[10] = scope
+	h.Write(b)
+	h.Write(ip.Mask(net.CIDRMask(int(scope), bits)))
+	return h.Sum64()
+}
+
+// keys returns the keys to look up for the request in state: the keys of the cached subnets the
+// client is in, the most specific one first, and the key k of the name itself.
+func (c *Cache) keys(state request.Request) []uint64 {
+	k := hash(state.Name(), state.QType())
+	if c.ecs == nil {
+		return []uint64{k}
+	}
+	s, ok := c.ecs.names.Get(k)
+	if !ok {
+		return []uint64{k}
+	}
+
+	family, ip, source := clientSubnet(state)
+	if source == 0 || ip == nil {
+		// The client doesn't want an answer tailored to its subnet.
+		return []uint64{k}
+	}
+
+	sn := s.(*subnets)
+	sn.Lock()
+	scopes := []uint8{}
+	seen := map[uint8]bool{}
+	for _, n := range sn.keys {
+		// A response for a longer prefix than the client gave us, doesn't apply to it.
+		if n.family != family || n.scope > source || seen[n.scope] {
+			continue
+		}
+		seen[n.scope] = true
+		scopes = append(scopes, n.scope)
+	}
+	sn.Unlock()
+	sort.Slice(scopes, func(i, j int) bool { return scopes[i] > scopes[j] })
+
+	keys := make([]uint64, 0, len(scopes)+1)
+	for _, scope := range scopes {
+		keys = append(keys, ecsHash(k, family, scope, ip))
+	}
+	return append(keys, k)
+}
+
+// ecsKey returns the key to store the response res under, and its subnet. For responses without a
+// scope this is the key k of the name. False is returned when res should not be cached, because its
+// scope is longer than we are willing to cache.
+func (c *Cache) ecsKey(k uint64, res *dns.Msg) (uint64, *subnet, bool) {
+	s := edns.Subnet(res)
+	if s == nil || s.SourceScope == 0 {
+		return k, nil, true
+	}
+
+	// A scope longer than the source prefix length is handled as the source prefix length, see
+	// section 7.3.1 of RFC 7871.
+	scope := s.SourceScope
+	if scope > s.SourceNetmask {
+		scope = s.SourceNetmask
+	}
+	switch {
+	case s.Family == 1 && scope <= c.ecs.scope4:
+	case s.Family == 2 && scope <= c.ecs.scope6:
+	default:
+		return 0, nil, false
+	}
+	return ecsHash(k, s.Family, scope, s.Address), &subnet{name: k, family: s.Family, scope: scope, ip: s.Address}, true
+}
+
+// addSubnet records that the subnet n with key sk is cached for its name. When the name already has
+// the maximum number of subnets, one of them is removed from the caches.
+func (c *Cache) addSubnet(sk uint64, n subnet) {
+	s, ok := c.ecs.names.Get(n.name)
+	if !ok {
+		s = &subnets{keys: map[uint64]subnet{}}
+		c.ecs.names.Add(n.name, s)
+	}
+
+	sn := s.(*subnets)
+	sn.Lock()
+	defer sn.Unlock()
+	if _, ok := sn.keys[sk]; !ok && len(sn.keys) >= c.ecs.entries {
+		for evict := range sn.keys {
+			delete(sn.keys, evict)
+			c.pcache.Remove(evict)
+			c.ncache.Remove(evict)
+			break
+		}
+	}
+	sn.keys[sk] = n
+}
+
+// setSubnet adds the ECS option to the response m from the cache, if the request r has one. The scope
+// is the one of the item, zero if it applies to all clients.
+func setSubnet(r, m *dns.Msg, i *item) {
+	s := edns.Subnet(r)
+	if s == nil {
+		return
+	}
+	scope := uint8(0)
+	if i.subnet != nil {
+		scope = i.subnet.scope
+	}
+	edns.SetSubnet(m, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        s.Family,
+		SourceNetmask: s.SourceNetmask,
+		SourceScope:   scope,
+		Address:       s.Address,
+	})
+}
+
+const (
+	defaultECSScope4  = 24
+	defaultECSScope6  = 56
+	defaultECSEntries = 32
+)
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// ecsBackend answers with the address from the ECS option, or 127.0.0.1 if there is none, and echoes
+// the option with scope. It counts the queries it gets.
+func ecsBackend(scope *uint8, queries *int) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*queries++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Response, m.RecursionAvailable = true, true
+
+		addr := "127.0.0.1"
+		if s := edns.Subnet(r); s != nil {
+			addr = s.Address.String()
+			edns.SetSubnet(m, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: s.Family, SourceNetmask: s.SourceNetmask, SourceScope: *scope, Address: s.Address})
+		}
+		m.Answer = []dns.RR{test.A("example.org. 300 IN A " + addr)}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
+
+func newECSCache(scope *uint8, queries *int) *Cache {
+	c := New()
+	c.ecs = &ecs{scope4: defaultECSScope4, scope6: defaultECSScope6, entries: 2, names: cache.New(defaultCap)}
+	c.Next = ecsBackend(scope, queries)
+	return c
+}
+
+// ecsQuery sends a query from ip, with an ECS option for subnet if it isn't empty.
+func ecsQuery(c *Cache, ip, subnet string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	if subnet != "" {
+		_, n, _ := net.ParseCIDR(subnet)
+		source, _ := n.Mask.Size()
+		edns.SetSubnet(req, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: uint8(source), Address: n.IP})
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip})
+	c.ServeDNS(context.TODO(), rec, req)
+	return rec.Msg
+}
+
+func TestCacheECS(t *testing.T) {
+	scope, queries := uint8(24), 0
+	c := newECSCache(&scope, &queries)
+
+	tests := []struct {
+		ip      string
+		subnet  string
+		scope   uint8 // scope of the backend's answer
+		answer  string
+		queries int
+	}{
+		{"10.0.0.1", "10.0.0.0/24", 24, "10.0.0.0", 1},
+		{"10.0.0.1", "10.0.1.0/24", 24, "10.0.1.0", 2}, // other subnet
+		{"10.0.0.1", "10.0.0.0/24", 24, "10.0.0.0", 2}, // cached
+		{"10.0.0.1", "10.0.0.0/28", 24, "10.0.0.0", 2}, // more specific source, cached
+		{"10.0.0.1", "10.0.0.0/16", 0, "10.0.0.0", 3},  // less specific source, not cached
+		{"10.0.1.9", "", 0, "10.0.1.0", 3},             // the client's address is in a cached subnet
+		{"10.0.0.1", "10.0.0.0/16", 0, "10.0.0.0", 3},  // the scope 0 answer is cached now
+	}
+	for i, tc := range tests {
+		scope = tc.scope
+		m := ecsQuery(c, tc.ip, tc.subnet)
+		if a := m.Answer[0].(*dns.A).A.String(); a != tc.answer {
+			t.Errorf("Test %d: expected answer %s, got %s", i, tc.answer, a)
+		}
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries to the backend, got %d", i, tc.queries, queries)
+		}
+	}
+
+	// The answer from the cache carries the scope of the item.
+	m := ecsQuery(c, "10.0.0.1", "10.0.0.0/24")
+	if s := edns.Subnet(m); s == nil || s.SourceScope != 24 || s.SourceNetmask != 24 {
+		t.Errorf("Expected an ECS option with scope 24, got %v", s)
+	}
+}
+
+func TestCacheECSScope(t *testing.T) {
+	scope, queries := uint8(32), 0
+	c := newECSCache(&scope, &queries)
+
+	// A scope longer than the maximum isn't cached.
+	ecsQuery(c, "10.0.0.1", "10.0.0.1/32")
+	ecsQuery(c, "10.0.0.1", "10.0.0.1/32")
+	if queries != 2 {
+		t.Errorf("Expected 2 queries to the backend, got %d", queries)
+	}
+}
+
+func TestCacheECSEntries(t *testing.T) {
+	scope, queries := uint8(24), 0
+	c := newECSCache(&scope, &queries)
+
+	// Only 2 subnets are kept per name.
+	for _, subnet := range []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"} {
+		ecsQuery(c, "10.0.0.1", subnet)
+	}
+	if l := c.pcache.Len(); l != 2 {
+		t.Errorf("Expected 2 cached items, got %d", l)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -38,10 +39,21 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 	if i != nil {
 		ttl = i.ttl(now)
 	}
+	if i == nil && c.nsecs != nil {
+		// The NSEC or NSEC3 records of the zone may prove the name or type doesn't exist.
+		if i := c.nsecs.synthesize(state, now); i != nil {
+			synthesized.WithLabelValues(server, dns.RcodeToString[i.Rcode]).Inc()
+			w.WriteMsg(i.toMsg(r, now, do))
+			return dns.RcodeSuccess, nil
+		}
+	}
 	if i == nil {
 		crr := &ResponseWriter{ResponseWriter: w, Cache: c, state: state, server: server, do: do}
 		return c.doRefresh(ctx, state, crr)
 	}
+	if ttl < 0 && c.staleTimeout > 0 {
+		return c.serveStaleAfter(ctx, w, r, state, server, i, now, ttl)
+	}
 	if ttl < 0 {
 		servedStale.WithLabelValues(server).Inc()
 		// Adjust the time to get a 0 TTL in the reply built from a stale item.
@@ -53,6 +65,12 @@ func (c *Cache) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		go c.doPrefetch(ctx, state, cw, i, now)
 	}
 	resp := i.toMsg(r, now, do)
+	if c.ecs != nil {
+		setSubnet(r, resp, i)
+	}
+	if ttl < 0 {
+		edns.SetExtendedError(r, resp, dns.ExtendedErrorCodeStaleAnswer, "")
+	}
 	w.WriteMsg(resp)
 
 	return dns.RcodeSuccess, nil
@@ -90,16 +108,16 @@ func (c *Cache) shouldPrefetch(i *item, now time.Time) bool {
 func (c *Cache) Name() string { return "cache" }
 
 func (c *Cache) get(now time.Time, state request.Request, server string) (*item, bool) {
-	k := hash(state.Name(), state.QType())
-
-	if i, ok := c.ncache.Get(k); ok && i.(*item).ttl(now) > 0 {
-		cacheHits.WithLabelValues(server, Denial).Inc()
-		return i.(*item), true
-	}
+	for _, k := range c.keys(state) {
+		if i, ok := c.ncache.Get(k); ok && i.(*item).ttl(now) > 0 {
+			cacheHits.WithLabelValues(server, Denial).Inc()
+			return i.(*item), true
+		}
 
-	if i, ok := c.pcache.Get(k); ok && i.(*item).ttl(now) > 0 {
-		cacheHits.WithLabelValues(server, Success).Inc()
-		return i.(*item), true
+		if i, ok := c.pcache.Get(k); ok && i.(*item).ttl(now) > 0 {
+			cacheHits.WithLabelValues(server, Success).Inc()
+			return i.(*item), true
+		}
 	}
 	cacheMisses.WithLabelValues(server).Inc()
 	return nil, false
@@ -107,20 +125,20 @@ func (c *Cache) get(now time.Time, state request.Request, server string) (*item,
 
 // getIgnoreTTL unconditionally returns an item if it exists in the cache.
 func (c *Cache) getIgnoreTTL(now time.Time, state request.Request, server string) *item {
-	k := hash(state.Name(), state.QType())
-
-	if i, ok := c.ncache.Get(k); ok {
-		ttl := i.(*item).ttl(now)
-		if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
-			cacheHits.WithLabelValues(server, Denial).Inc()
-			return i.(*item)
+	for _, k := range c.keys(state) {
+		if i, ok := c.ncache.Get(k); ok {
+			ttl := i.(*item).ttl(now)
+			if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
+				cacheHits.WithLabelValues(server, Denial).Inc()
+				return i.(*item)
+			}
 		}
-	}
-	if i, ok := c.pcache.Get(k); ok {
-		ttl := i.(*item).ttl(now)
-		if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
-			cacheHits.WithLabelValues(server, Success).Inc()
-			return i.(*item)
+		if i, ok := c.pcache.Get(k); ok {
+			ttl := i.(*item).ttl(now)
+			if ttl > 0 || (c.staleUpTo > 0 && -ttl < int(c.staleUpTo.Seconds())) {
+				cacheHits.WithLabelValues(server, Success).Inc()
+				return i.(*item)
+			}
 		}
 	}
 	cacheMisses.WithLabelValues(server).Inc()
@@ -128,12 +146,13 @@ func (c *Cache) getIgnoreTTL(now time.Time, state request.Request, server string
 }
 
 func (c *Cache) exists(state request.Request) *item {
-	k := hash(state.Name(), state.QType())
-	if i, ok := c.ncache.Get(k); ok {
-		return i.(*item)
-	}
-	if i, ok := c.pcache.Get(k); ok {
-		return i.(*item)
+	for _, k := range c.keys(state) {
+		if i, ok := c.ncache.Get(k); ok {
+			return i.(*item)
+		}
+		if i, ok := c.pcache.Get(k); ok {
+			return i.(*item)
+		}
 	}
 	return nil
 }
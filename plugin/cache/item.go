@@ -16,8 +16,11 @@ type item struct {
 	Ns                 []dns.RR
 	Extra              []dns.RR
 
+	name    string // lowercased qname and qtype, for the admin endpoint
+	qtype   uint16
 	origTTL uint32
 	stored  time.Time
+	subnet  *subnet // only set when the item is for a client subnet
 
 	*freq.Freq
 }
@@ -49,6 +52,32 @@ func newItem(m *dns.Msg, now time.Time, d time.Duration) *item {
 	return i
 }
 
+// size returns an estimate of the memory used by i, in bytes.
+func (i *item) size() int {
+	n := itemOverhead + len(i.name)
+	for _, rrs := range [][]dns.RR{i.Answer, i.Ns, i.Extra} {
+		for _, r := range rrs {
+			n += rrOverhead + dns.Len(r)
+		}
+	}
+	return n
+}
+
+// itemSize returns the size of el if it is an item, for use as the cost function of the caches.
+func itemSize(el interface{}) int {
+	if i, ok := el.(*item); ok {
+		return i.size()
+	}
+	return 0
+}
+
+const (
+	// itemOverhead is the memory used by an item besides its records, rrOverhead the memory used by a
+	// record besides its wire format: headers, pointers and slice headers.
+	itemOverhead = 200
+	rrOverhead   = 64
+)
+
 // toMsg turns i into a message, it tailors the reply to m.
 // The Authoritative bit should be set to 0, but some client stub resolver implementations, most notably,
 // on some legacy systems(e.g. ubuntu 14.04 with glib version 2.20), low-level glibc function `getaddrinfo`
@@ -50,6 +50,14 @@ var (
 		Name:      "served_stale_total",
 		Help:      "The number of requests served from stale cache entries.",
 	}, []string{"server"})
+	// servedStaleAfter is the number of requests served from stale cache entries, because the resolution
+	// timed out or failed.
+	servedStaleAfter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "served_stale_client_timeout_total",
+		Help:      "The number of requests served from stale cache entries after a resolution timed out or failed.",
+	}, []string{"server", "reason"})
 	// evictions is the counter of cache evictions.
 	evictions = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
@@ -57,4 +65,25 @@ var (
 		Name:      "evictions_total",
 		Help:      "The count of cache evictions.",
 	}, []string{"server", "type"})
+	// evictionReasons is the counter of evicted elements, by the reason they were evicted.
+	evictionReasons = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "evictions_reason_total",
+		Help:      "The count of cache evictions by reason.",
+	}, []string{"server", "type", "reason"})
+	// cacheBytes is the estimated memory used by the elements in the cache, by cache type.
+	cacheBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "size_bytes",
+		Help:      "The estimated memory used by the elements in the cache, in bytes.",
+	}, []string{"server", "type"})
+	// synthesized is the counter of negative responses synthesized from NSEC and NSEC3 records.
+	synthesized = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "cache",
+		Name:      "synthesized_total",
+		Help:      "The count of negative responses synthesized from NSEC and NSEC3 records.",
+	}, []string{"server", "rcode"})
 )
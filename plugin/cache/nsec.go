@@ -0,0 +1,447 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/cache/freq"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// nsecs holds the NSEC and NSEC3 records of authenticated negative responses, per zone, to synthesize
+// negative answers for the names they cover, as described in RFC 8198.
+type nsecs struct {
+	size  int          // maximum number of NSEC or NSEC3 records kept per zone
+	zones *cache.Cache // key of the zone -> *nsecZone
+}
+
+// nsecZone holds the SOA, NSEC and NSEC3 records of a zone.
+type nsecZone struct {
+	sync.RWMutex
+	name string
+
+	soa       []dns.RR // SOA and its RRSIGs
+	soaExpire time.Time
+	ra        bool // RecursionAvailable of the responses
+
+	nsec  []*denial // sorted in canonical order of the owner names
+	nsec3 []*denial // sorted on the hashed owner names
+
+	// NSEC3 parameters, these are the same for all NSEC3 records of a zone.
+	hash       uint8
+	iterations uint16
+	salt       string
+}
+
+// denial is an NSEC or NSEC3 record, with its RRSIGs.
+type denial struct {
+	owner  string // lowercased owner name for NSEC, the uppercase hash for NSEC3
+	next   string // the next name or the uppercase next hash
+	bitmap []uint16
+	optOut bool
+	rrs    []dns.RR
+	expire time.Time
+}
+
+// add stores the SOA, NSEC and NSEC3 records of the negative response m. The caller must have checked
+// that m is authenticated. The records are kept for at most their TTL, the SOA's minimum TTL, or maxTTL.
+func (n *nsecs) add(m *dns.Msg, now time.Time, maxTTL time.Duration) {
+	var soa *dns.SOA
+	for _, r := range m.Ns {
+		if s, ok := r.(*dns.SOA); ok {
+			soa = s
+			break
+		}
+	}
+	if soa == nil {
+		return
+	}
+	zone := strings.ToLower(soa.Hdr.Name)
+
+	// See section 5.4 of RFC 8198 and RFC 9077 for the TTL of negative answers.
+	ttl := time.Duration(min32(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	sigs := map[string][]dns.RR{}
+	for _, r := range m.Ns {
+		if s, ok := r.(*dns.RRSIG); ok {
+			k := strings.ToLower(s.Hdr.Name) + "/" + dns.Type(s.TypeCovered).String()
+			sigs[k] = append(sigs[k], dns.Copy(s))
+		}
+	}
+
+	var denials, denials3 []*denial
+	var nsec3 *dns.NSEC3
+	for _, r := range m.Ns {
+		owner := strings.ToLower(r.Header().Name)
+		if !dns.IsSubDomain(zone, owner) {
+			continue
+		}
+		expire := now.Add(ttl)
+		if d := time.Duration(r.Header().Ttl) * time.Second; d < ttl {
+			expire = now.Add(d)
+		}
+
+		switch x := r.(type) {
+		case *dns.NSEC:
+			rrs := append([]dns.RR{dns.Copy(x)}, sigs[owner+"/NSEC"]...)
+			denials = append(denials, &denial{owner: owner, next: strings.ToLower(x.NextDomain), bitmap: x.TypeBitMap, rrs: rrs, expire: expire})
+		case *dns.NSEC3:
+			if x.Hash != dns.SHA1 || x.Iterations > maxNSEC3Iterations {
+				continue
+			}
+			if nsec3 != nil && (x.Iterations != nsec3.Iterations || x.Salt != nsec3.Salt) {
+				continue
+			}
+			nsec3 = x
+			label := owner[:strings.Index(owner, ".")]
+			rrs := append([]dns.RR{dns.Copy(x)}, sigs[owner+"/NSEC3"]...)
+			denials3 = append(denials3, &denial{owner: strings.ToUpper(label), next: strings.ToUpper(x.NextDomain), bitmap: x.TypeBitMap, optOut: x.Flags&1 == 1, rrs: rrs, expire: expire})
+		}
+	}
+	if len(denials) == 0 && len(denials3) == 0 {
+		return
+	}
+
+	k := cache.Hash([]byte(zone))
+	zi, ok := n.zones.Get(k)
+	if !ok {
+		zi = &nsecZone{name: zone}
+		n.zones.Add(k, zi)
+	}
+	z := zi.(*nsecZone)
+
+	z.Lock()
+	defer z.Unlock()
+
+	z.soa = []dns.RR{dns.Copy(soa)}
+	z.soa = append(z.soa, sigs[zone+"/SOA"]...)
+	z.soaExpire = now.Add(ttl)
+	z.ra = m.RecursionAvailable
+
+	for _, d := range denials {
+		z.nsec = insert(z.nsec, d, canonicalCompare, n.size, now)
+	}
+	if nsec3 != nil && (nsec3.Iterations != z.iterations || nsec3.Salt != z.salt || nsec3.Hash != z.hash) {
+		// The zone has new NSEC3 parameters, the records we have are of no use anymore.
+		z.nsec3 = nil
+		z.hash, z.iterations, z.salt = nsec3.Hash, nsec3.Iterations, nsec3.Salt
+	}
+	for _, d := range denials3 {
+		z.nsec3 = insert(z.nsec3, d, strings.Compare, n.size, now)
+	}
+}
+
+// insert adds d to the sorted ds, replacing the record with the same owner. When ds holds more than
+// size records, the expired ones are removed, or else the one that expires first.
+func insert(ds []*denial, d *denial, compare func(a, b string) int, size int, now time.Time) []*denial {
+	i := sort.Search(len(ds), func(i int) bool { return compare(ds[i].owner, d.owner) >= 0 })
+	if i < len(ds) && ds[i].owner == d.owner {
+		ds[i] = d
+		return ds
+	}
+	ds = append(ds, nil)
+	copy(ds[i+1:], ds[i:])
+	ds[i] = d
+
+	if len(ds) <= size {
+		return ds
+	}
+	j := 0
+	for _, d1 := range ds {
+		if now.Before(d1.expire) {
+			ds[j] = d1
+			j++
+		}
+	}
+	ds = ds[:j]
+	if len(ds) <= size {
+		return ds
+	}
+	first := 0
+	for i, d1 := range ds {
+		if d1.expire.Before(ds[first].expire) {
+			first = i
+		}
+	}
+	return append(ds[:first], ds[first+1:]...)
+}
+
+// synthesize returns an item with a NXDOMAIN or NODATA response for the request in state, if the
+// records of its zone prove the name or type doesn't exist. Otherwise nil is returned.
+func (n *nsecs) synthesize(state request.Request, now time.Time) *item {
+	qname, qtype := state.Name(), state.QType()
+
+	// Find the closest zone we have records for.
+	var z *nsecZone
+	for off, end := 0, false; ; off, end = dns.NextLabel(qname, off) {
+		name := "."
+		if !end {
+			name = qname[off:]
+		}
+		if zi, ok := n.zones.Get(cache.Hash([]byte(name))); ok {
+			z = zi.(*nsecZone)
+			break
+		}
+		if end {
+			return nil
+		}
+	}
+
+	z.RLock()
+	defer z.RUnlock()
+	if !now.Before(z.soaExpire) {
+		return nil
+	}
+
+	rcode, proof := z.proveNSEC(qname, qtype, now)
+	if proof == nil {
+		rcode, proof = z.proveNSEC3(qname, qtype, now)
+	}
+	if proof == nil {
+		return nil
+	}
+
+	expire := z.soaExpire
+	ns := append([]dns.RR{}, z.soa...)
+	seen := map[*denial]bool{}
+	for _, d := range proof {
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		ns = append(ns, d.rrs...)
+		if d.expire.Before(expire) {
+			expire = d.expire
+		}
+	}
+
+	return &item{
+		Rcode:              rcode,
+		AuthenticatedData:  true,
+		RecursionAvailable: z.ra,
+		Ns:                 ns,
+		name:               qname,
+		qtype:              qtype,
+		origTTL:            uint32(expire.Sub(now).Seconds()),
+		stored:             now,
+		Freq:               new(freq.Freq),
+	}
+}
+
+// proveNSEC returns the rcode and the NSEC records that prove qname or qtype doesn't exist.
+func (z *nsecZone) proveNSEC(qname string, qtype uint16, now time.Time) (int, []*denial) {
+	d := z.findNSEC(qname, now)
+	if d == nil {
+		return 0, nil
+	}
+	if d.owner == qname {
+		if !nodata(d.bitmap, qtype) {
+			return 0, nil
+		}
+		return dns.RcodeSuccess, []*denial{d}
+	}
+	if !d.covers(qname, canonicalCompare) || d.delegates(qname) {
+		return 0, nil
+	}
+	// If the next name is below qname, qname is an empty non-terminal.
+	if dns.IsSubDomain(qname, d.next) {
+		return dns.RcodeSuccess, []*denial{d}
+	}
+
+	// The wildcard at the closest encloser must not exist either.
+	ce := dns.CompareDomainName(qname, d.owner)
+	if c := dns.CompareDomainName(qname, d.next); c > ce {
+		ce = c
+	}
+	wildcard := "*." + ancestor(qname, ce)
+	w := z.findNSEC(wildcard, now)
+	if w == nil || w.owner == wildcard || !w.covers(wildcard, canonicalCompare) || w.delegates(wildcard) {
+		return 0, nil
+	}
+	return dns.RcodeNameError, []*denial{d, w}
+}
+
+// findNSEC returns the unexpired NSEC record with the largest owner name that is not larger than name.
+func (z *nsecZone) findNSEC(name string, now time.Time) *denial {
+	i := sort.Search(len(z.nsec), func(i int) bool { return canonicalCompare(z.nsec[i].owner, name) > 0 }) - 1
+	if i < 0 || !now.Before(z.nsec[i].expire) {
+		return nil
+	}
+	return z.nsec[i]
+}
+
+// proveNSEC3 returns the rcode and the NSEC3 records that prove qname or qtype doesn't exist.
+func (z *nsecZone) proveNSEC3(qname string, qtype uint16, now time.Time) (int, []*denial) {
+	if len(z.nsec3) == 0 {
+		return 0, nil
+	}
+
+	h := z.hashName(qname)
+	if d := z.findNSEC3(h, now); d != nil && d.owner == h {
+		if !nodata(d.bitmap, qtype) {
+			return 0, nil
+		}
+		return dns.RcodeSuccess, []*denial{d}
+	}
+
+	// Closest encloser proof, see section 8.3 of RFC 5155.
+	nextCloser := qname
+	for off, end := dns.NextLabel(qname, 0); !end; off, end = dns.NextLabel(qname, off) {
+		ce := qname[off:]
+		if !dns.IsSubDomain(z.name, ce) {
+			return 0, nil
+		}
+		h := z.hashName(ce)
+		c := z.findNSEC3(h, now)
+		if c == nil || c.owner != h {
+			nextCloser = ce
+			continue
+		}
+		if (hasType(c.bitmap, dns.TypeNS) && !hasType(c.bitmap, dns.TypeSOA)) || hasType(c.bitmap, dns.TypeDNAME) {
+			return 0, nil
+		}
+
+		// Opt-out records can't prove a name doesn't exist, there may be an insecure delegation.
+		hn := z.hashName(nextCloser)
+		n := z.findNSEC3(hn, now)
+		if n == nil || n.optOut || !n.covers(hn, strings.Compare) {
+			return 0, nil
+		}
+		hw := z.hashName("*." + ce)
+		w := z.findNSEC3(hw, now)
+		if w == nil || w.owner == hw || !w.covers(hw, strings.Compare) {
+			return 0, nil
+		}
+		return dns.RcodeNameError, []*denial{c, n, w}
+	}
+	return 0, nil
+}
+
+// findNSEC3 returns the unexpired NSEC3 record with the largest owner hash that is not larger than h.
+// For hashes smaller than the first one, this is the last record; it covers the end of the hash range.
+func (z *nsecZone) findNSEC3(h string, now time.Time) *denial {
+	i := sort.Search(len(z.nsec3), func(i int) bool { return z.nsec3[i].owner > h }) - 1
+	if i < 0 {
+		i = len(z.nsec3) - 1
+	}
+	if !now.Before(z.nsec3[i].expire) {
+		return nil
+	}
+	return z.nsec3[i]
+}
+
+func (z *nsecZone) hashName(name string) string {
+	return dns.HashName(name, z.hash, z.iterations, z.salt)
+}
+
+// covers returns true when name falls between the owner and next name of d. The last record of a
+// zone wraps around, its next name is the first one.
+func (d *denial) covers(name string, compare func(a, b string) int) bool {
+	if compare(d.next, d.owner) <= 0 {
+		return compare(name, d.owner) > 0 || compare(name, d.next) < 0
+	}
+	return compare(name, d.owner) > 0 && compare(name, d.next) < 0
+}
+
+// delegates returns true when the NSEC record d is at a delegation or DNAME above name. The names
+// below are not in this zone, so d can't prove they don't exist.
+func (d *denial) delegates(name string) bool {
+	if !dns.IsSubDomain(d.owner, name) {
+		return false
+	}
+	return (hasType(d.bitmap, dns.TypeNS) && !hasType(d.bitmap, dns.TypeSOA)) || hasType(d.bitmap, dns.TypeDNAME)
+}
+
+// nodata returns true when the type bitmap proves qtype doesn't exist.
+func nodata(bitmap []uint16, qtype uint16) bool {
+	if hasType(bitmap, qtype) || hasType(bitmap, dns.TypeCNAME) {
+		return false
+	}
+	// At a delegation only the absence of a DS can be proven. And the NSEC at the apex of a zone
+	// says nothing about the DS records in the parent.
+	if qtype == dns.TypeDS {
+		return !hasType(bitmap, dns.TypeSOA)
+	}
+	return !hasType(bitmap, dns.TypeNS) || hasType(bitmap, dns.TypeSOA)
+}
+
+func hasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ancestor returns the ancestor of name with labels labels.
+func ancestor(name string, labels int) string {
+	idx := dns.Split(name)
+	if labels <= 0 || len(idx) == 0 {
+		return "."
+	}
+	if labels >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-labels]:]
+}
+
+// canonicalCompare compares the lowercased names a and b in the canonical DNS name order of section
+// 6.1 of RFC 4034. It returns <0 when a sorts before b, 0 when they are equal and >0 otherwise.
+func canonicalCompare(a, b string) int {
+	la, lb := dns.SplitDomainName(a), dns.SplitDomainName(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(unescape(la[i]), unescape(lb[j])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// unescape returns the label l with its escapes (\. and \DDD) replaced by the bytes they stand for.
+func unescape(l string) string {
+	if !strings.Contains(l, `\`) {
+		return l
+	}
+	b := make([]byte, 0, len(l))
+	for i := 0; i < len(l); i++ {
+		if l[i] != '\\' || i+1 == len(l) {
+			b = append(b, l[i])
+			continue
+		}
+		if i+3 < len(l) && isDigit(l[i+1]) && isDigit(l[i+2]) && isDigit(l[i+3]) {
+			b = append(b, (l[i+1]-'0')*100+(l[i+2]-'0')*10+(l[i+3]-'0'))
+			i += 3
+			continue
+		}
+		b = append(b, l[i+1])
+		i++
+	}
+	return string(b)
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+const (
+	defaultNsecSize = 1000
+	// maxNSEC3Iterations is the maximum number of NSEC3 iterations we hash names with, see RFC 9276.
+	maxNSEC3Iterations = 100
+)
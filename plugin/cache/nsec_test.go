@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// The example.org zone holds example.org, a.example.org, sub.example.org (a delegation), www.example.org
+// and x.y.example.org, which makes y.example.org an empty non-terminal.
+var nsecProofs = map[string][]dns.RR{
+	"b.example.org.": {
+		test.NSEC("a.example.org.	3600	IN	NSEC	sub.example.org. A RRSIG NSEC"),
+		test.NSEC("example.org.	3600	IN	NSEC	a.example.org. NS SOA RRSIG NSEC DNSKEY"),
+	},
+	"a.example.org.": {
+		test.NSEC("a.example.org.	3600	IN	NSEC	sub.example.org. A RRSIG NSEC"),
+	},
+	"xa.example.org.": {
+		test.NSEC("www.example.org.	3600	IN	NSEC	x.y.example.org. A RRSIG NSEC"),
+		test.NSEC("example.org.	3600	IN	NSEC	a.example.org. NS SOA RRSIG NSEC DNSKEY"),
+	},
+	"t.example.org.": {
+		test.NSEC("sub.example.org.	3600	IN	NSEC	www.example.org. NS DS RRSIG NSEC"),
+		test.NSEC("example.org.	3600	IN	NSEC	a.example.org. NS SOA RRSIG NSEC DNSKEY"),
+	},
+}
+
+// nsecBackend answers with a negative response holding the proofs for qname, it counts the queries it gets.
+func nsecBackend(proofs map[string][]dns.RR, ad bool, queries *int) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*queries++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Response, m.RecursionAvailable, m.AuthenticatedData = true, true, ad
+
+		m.Rcode = dns.RcodeNameError
+		for _, rr := range proofs[r.Question[0].Name] {
+			if rr.Header().Name == r.Question[0].Name {
+				m.Rcode = dns.RcodeSuccess
+			}
+		}
+		m.Ns = append([]dns.RR{test.SOA("example.org.	3600	IN	SOA	ns.example.org. admin.example.org. 1 3600 600 86400 300")}, proofs[r.Question[0].Name]...)
+		w.WriteMsg(m)
+		return m.Rcode, nil
+	})
+}
+
+func newNsecCache(proofs map[string][]dns.RR, ad bool, queries *int) *Cache {
+	c := New()
+	c.nsecs = &nsecs{size: defaultNsecSize, zones: cache.New(defaultCap)}
+	c.Next = nsecBackend(proofs, ad, queries)
+	return c
+}
+
+func nsecQuery(c *Cache, qname string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(qname, qtype)
+	req.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	c.ServeDNS(context.TODO(), rec, req)
+	return rec.Msg
+}
+
+func TestCacheAggressiveNSEC(t *testing.T) {
+	queries := 0
+	c := newNsecCache(nsecProofs, true, &queries)
+
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		rcode   int
+		queries int
+	}{
+		{"b.example.org.", dns.TypeA, dns.RcodeNameError, 1},
+		{"c.example.org.", dns.TypeA, dns.RcodeNameError, 1},  // covered by a.example.org and the wildcard by the apex
+		{"c.example.org.", dns.TypeMX, dns.RcodeNameError, 1}, // any type
+		{"a.example.org.", dns.TypeMX, dns.RcodeSuccess, 1},   // NODATA, from the bitmap
+		{"a.example.org.", dns.TypeA, dns.RcodeSuccess, 2},    // A exists
+		{"foo.a.example.org.", dns.TypeA, dns.RcodeNameError, 2},
+		{"xa.example.org.", dns.TypeA, dns.RcodeNameError, 3},
+		{"y.example.org.", dns.TypeA, dns.RcodeSuccess, 3},    // empty non-terminal
+		{"xb.example.org.", dns.TypeA, dns.RcodeNameError, 3}, // covered by www.example.org
+		{"t.example.org.", dns.TypeA, dns.RcodeNameError, 4},
+		{"foo.sub.example.org.", dns.TypeA, dns.RcodeNameError, 5}, // below a delegation
+		{"sub.example.org.", dns.TypeA, dns.RcodeNameError, 6},     // at a delegation
+		{"b.example.net.", dns.TypeA, dns.RcodeNameError, 7},       // other zone
+	}
+	for i, tc := range tests {
+		m := nsecQuery(c, tc.qname, tc.qtype)
+		if m.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[m.Rcode])
+		}
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries to the backend, got %d", i, tc.queries, queries)
+		}
+	}
+}
+
+func TestCacheAggressiveNSECResponse(t *testing.T) {
+	queries := 0
+	c := newNsecCache(nsecProofs, true, &queries)
+
+	nsecQuery(c, "b.example.org.", dns.TypeA)
+	m := nsecQuery(c, "c.example.org.", dns.TypeA)
+	if queries != 1 {
+		t.Fatalf("Expected 1 query to the backend, got %d", queries)
+	}
+	if !m.AuthenticatedData || !m.RecursionAvailable {
+		t.Errorf("Expected AD and RA to be set")
+	}
+	if x := m.Question[0].Name; x != "c.example.org." {
+		t.Errorf("Expected question for c.example.org., got %s", x)
+	}
+	if len(m.Ns) != 3 {
+		t.Fatalf("Expected SOA and 2 NSEC records, got %d records", len(m.Ns))
+	}
+	if _, ok := m.Ns[0].(*dns.SOA); !ok {
+		t.Errorf("Expected SOA first, got %s", m.Ns[0])
+	}
+	for _, rr := range m.Ns {
+		if rr.Header().Ttl > 300 {
+			t.Errorf("Expected TTL capped by the SOA minimum, got %d", rr.Header().Ttl)
+		}
+	}
+}
+
+func TestCacheAggressiveNSECNotAuthenticated(t *testing.T) {
+	queries := 0
+	c := newNsecCache(nsecProofs, false, &queries)
+
+	nsecQuery(c, "b.example.org.", dns.TypeA)
+	nsecQuery(c, "c.example.org.", dns.TypeA)
+	if queries != 2 {
+		t.Errorf("Expected 2 queries to the backend, got %d", queries)
+	}
+}
+
+// nsec3Proofs returns the NSEC3 chain of a zone holding example.org and a.example.org.
+func nsec3Proofs(flags uint8) []dns.RR {
+	names := []string{"example.org.", "a.example.org."}
+	hashes := []string{}
+	for _, n := range names {
+		hashes = append(hashes, dns.HashName(n, dns.SHA1, 1, "AABB"))
+	}
+	sort.Strings(hashes)
+
+	proofs := []dns.RR{}
+	for i, h := range hashes {
+		next := hashes[(i+1)%len(hashes)]
+		proofs = append(proofs, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(h) + ".example.org.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: 1,
+			SaltLength: 2,
+			Salt:       "AABB",
+			HashLength: 20,
+			NextDomain: next,
+			TypeBitMap: []uint16{dns.TypeA, dns.TypeRRSIG},
+		})
+	}
+	return proofs
+}
+
+func TestCacheAggressiveNSEC3(t *testing.T) {
+	tests := []struct {
+		flags   uint8
+		queries int
+	}{
+		{0, 1},
+		{1, 2}, // opt-out
+	}
+	for i, tc := range tests {
+		queries := 0
+		c := newNsecCache(map[string][]dns.RR{
+			"b.example.org.": nsec3Proofs(tc.flags),
+			"c.example.org.": nsec3Proofs(tc.flags),
+		}, true, &queries)
+
+		nsecQuery(c, "b.example.org.", dns.TypeA)
+		m := nsecQuery(c, "c.example.org.", dns.TypeA)
+		if m.Rcode != dns.RcodeNameError {
+			t.Errorf("Test %d: expected NXDOMAIN, got %s", i, dns.RcodeToString[m.Rcode])
+		}
+		if queries != tc.queries {
+			t.Errorf("Test %d: expected %d queries to the backend, got %d", i, tc.queries, queries)
+		}
+	}
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	// The example from section 6.1 of RFC 4034, in canonical order.
+	names := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"z.a.example.",
+		"zabc.a.example.",
+		"z.example.",
+		`\001.z.example.`,
+		"*.z.example.",
+		`\200.z.example.`,
+	}
+	for i := range names {
+		for j := range names {
+			c := canonicalCompare(names[i], names[j])
+			switch {
+			case i < j && c >= 0, i == j && c != 0, i > j && c <= 0:
+				t.Errorf("Expected %q and %q to compare as %d, got %d", names[i], names[j], i-j, c)
+			}
+		}
+	}
+}
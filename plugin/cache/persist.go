@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/coredns/plugin/cache/freq"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+// snapshot is what is written to the persist file: all items of both caches.
+type snapshot struct {
+	Version int
+	Entries []entry
+}
+
+// entry is a single cached item, the message holds the question, sections, rcode and flags of the item.
+type entry struct {
+	Key      uint64
+	Positive bool // true for pcache, false for ncache
+	OrigTTL  uint32
+	Stored   time.Time
+	Msg      []byte
+
+	// For ECS aware caching, the key of the name and the subnet the item is for.
+	Name    uint64
+	Family  uint16
+	Scope   uint8
+	Address net.IP
+}
+
+// snapshotVersion is increased when the cache keys or the format of the snapshot change, older snapshots
+// are then ignored. Version 2 added the ECS name, family and scope, version 3 the ECS address and the
+// question in the message.
+const snapshotVersion = 3
+
+// save writes the contents of the caches to c.persistFile. The file is replaced atomically.
+func (c *Cache) save() error {
+	s := snapshot{Version: snapshotVersion}
+	s.Entries = appendEntries(s.Entries, c.pcache, true)
+	s.Entries = appendEntries(s.Entries, c.ncache, false)
+
+	f, err := ioutil.TempFile(filepath.Dir(c.persistFile), filepath.Base(c.persistFile))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // noop once renamed
+
+	bw := bufio.NewWriter(f)
+	if err := gob.NewEncoder(bw).Encode(s); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.persistFile)
+}
+
+func appendEntries(entries []entry, ca *cache.Cache, positive bool) []entry {
+	ca.Walk(func(items map[uint64]interface{}, key uint64) bool {
+		i, ok := items[key].(*item)
+		if !ok {
+			return true
+		}
+		m := new(dns.Msg)
+		m.Question = []dns.Question{{Name: i.name, Qtype: i.qtype, Qclass: dns.ClassINET}}
+		m.Rcode = i.Rcode
+		m.AuthenticatedData = i.AuthenticatedData
+		m.RecursionAvailable = i.RecursionAvailable
+		m.Answer = i.Answer
+		m.Ns = i.Ns
+		m.Extra = i.Extra
+		// Pack a copy, packing writes to the records and these are shared with the cache's readers.
+		m = m.Copy()
+		m.Compress = true
+		buf, err := m.Pack()
+		if err != nil {
+			return true
+		}
+		e := entry{Key: key, Positive: positive, OrigTTL: i.origTTL, Stored: i.stored, Msg: buf}
+		if i.subnet != nil {
+			e.Name, e.Family, e.Scope, e.Address = i.subnet.name, i.subnet.family, i.subnet.scope, i.subnet.ip
+		}
+		entries = append(entries, e)
+		return true
+	})
+	return entries
+}
+
+// load reads c.persistFile and adds the items in it to the caches. Items that can't be served anymore
+// are skipped. It returns the number of items added. A missing file is not an error.
+func (c *Cache) load() (int, error) {
+	f, err := os.Open(c.persistFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	s := snapshot{}
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&s); err != nil {
+		return 0, err
+	}
+	if s.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+
+	now := c.now().UTC()
+	n := 0
+	for _, e := range s.Entries {
+		m := new(dns.Msg)
+		if err := m.Unpack(e.Msg); err != nil {
+			continue
+		}
+		i := &item{
+			Rcode:              m.Rcode,
+			AuthenticatedData:  m.AuthenticatedData,
+			RecursionAvailable: m.RecursionAvailable,
+			Answer:             m.Answer,
+			Ns:                 m.Ns,
+			Extra:              m.Extra,
+			origTTL:            e.OrigTTL,
+			stored:             e.Stored.UTC(),
+			Freq:               new(freq.Freq),
+		}
+		if len(m.Question) == 1 {
+			i.name, i.qtype = m.Question[0].Name, m.Question[0].Qtype
+		}
+		if ttl := i.ttl(now); ttl <= 0 && (c.staleUpTo <= 0 || -ttl >= int(c.staleUpTo.Seconds())) {
+			continue
+		}
+		if e.Scope > 0 {
+			// Without ECS aware caching, items for a subnet can't be used.
+			if c.ecs == nil {
+				continue
+			}
+			i.subnet = &subnet{name: e.Name, family: e.Family, scope: e.Scope, ip: e.Address}
+			c.addSubnet(e.Key, *i.subnet)
+		}
+		if e.Positive {
+			c.pcache.Add(e.Key, i)
+		} else {
+			c.ncache.Add(e.Key, i)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// startPersist restores the caches from c.persistFile and then saves them every c.persistInterval, until
+// stopPersist is called.
+func (c *Cache) startPersist() {
+	n, err := c.load()
+	if err != nil {
+		log.Warningf("Failed to restore cache from %q: %s", c.persistFile, err)
+	} else if n > 0 {
+		log.Infof("Restored %d cache entries from %q", n, c.persistFile)
+	}
+
+	c.persistStop = make(chan struct{})
+	if c.persistInterval <= 0 {
+		return
+	}
+	go func(stop chan struct{}) {
+		tick := time.NewTicker(c.persistInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				c.saveLog()
+			}
+		}
+	}(c.persistStop)
+}
+
+// stopPersist stops saving the caches periodically.
+func (c *Cache) stopPersist() {
+	if c.persistStop != nil {
+		close(c.persistStop)
+		c.persistStop = nil
+	}
+}
+
+// saveLog saves the caches and logs any error.
+func (c *Cache) saveLog() {
+	if err := c.save(); err != nil {
+		log.Warningf("Failed to save cache to %q: %s", c.persistFile, err)
+	}
+}
+
+// defaultPersistInterval is how often the cache is saved, when persist is given without an interval.
+const defaultPersistInterval = 5 * time.Minute
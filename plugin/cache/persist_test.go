@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestPersistSaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+
+	c := New()
+	c.persistFile = file
+	ctx := context.TODO()
+
+	// Cache a positive answer with a TTL of 60s, one with a TTL of 10s and a negative one.
+	for _, q := range []struct {
+		name    string
+		backend plugin.Handler
+	}{
+		{"a.example.org.", ttlBackend(60)},
+		{"b.example.org.", ttlBackend(10)},
+		{"nx.example.org.", nxDomainBackend(60)},
+	} {
+		c.Next = q.backend
+		req := new(dns.Msg)
+		req.SetQuestion(q.name, dns.TypeA)
+		c.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	}
+	if err := c.save(); err != nil {
+		t.Fatalf("Failed to save the cache: %s", err)
+	}
+
+	// Restore 30s later, the 10s entry has expired.
+	now := time.Now().Add(30 * time.Second)
+	c1 := New()
+	c1.persistFile = file
+	c1.now = func() time.Time { return now }
+	n, err := c1.load()
+	if err != nil {
+		t.Fatalf("Failed to load the cache: %s", err)
+	}
+	if n != 2 || c1.pcache.Len() != 1 || c1.ncache.Len() != 1 {
+		t.Fatalf("Expected 2 restored entries, 1 positive and 1 negative, got %d: %d and %d", n, c1.pcache.Len(), c1.ncache.Len())
+	}
+
+	// The names are restored for the admin endpoint.
+	if entries := c1.entries(filter{name: "a.example.org."}, c1.pcache, Success); len(entries) != 1 || entries[0].Type != "A" {
+		t.Errorf("Expected the entry for a.example.org. to be restored, got %v", entries)
+	}
+
+	// Everything must come from the cache now.
+	c1.Next = plugin.HandlerFunc(func(context.Context, dns.ResponseWriter, *dns.Msg) (int, error) {
+		return 255, nil
+	})
+	for _, name := range []string{"a.example.org.", "nx.example.org."} {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if ret, _ := c1.ServeDNS(ctx, rec, req); ret != dns.RcodeSuccess {
+			t.Fatalf("Expected %s to be served from the cache, got %d", name, ret)
+		}
+		rrs := append(rec.Msg.Answer, rec.Msg.Ns...)
+		if len(rrs) != 1 || rrs[0].Header().Ttl > 30 {
+			t.Errorf("Expected a single record with a TTL of at most 30s for %s, got %v", name, rrs)
+		}
+	}
+}
+
+func TestPersistLoadMissing(t *testing.T) {
+	c := New()
+	c.persistFile = filepath.Join(t.TempDir(), "cache")
+	if n, err := c.load(); n != 0 || err != nil {
+		t.Errorf("Expected no entries and no error for a missing file, got %d and %v", n, err)
+	}
+}
+
+func TestPersistLoadOldVersion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := snapshot{Version: snapshotVersion - 1, Entries: []entry{{Key: 1, Positive: true, OrigTTL: 60, Stored: time.Now()}}}
+	if err := gob.NewEncoder(f).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	c := New()
+	c.persistFile = file
+	if n, err := c.load(); n != 0 || err == nil {
+		t.Errorf("Expected an older snapshot to be ignored, got %d entries and %v", n, err)
+	}
+}
+
+func TestPersistECS(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+
+	scope, queries := uint8(24), 0
+	c := newECSCache(&scope, &queries)
+	c.persistFile = file
+	ecsQuery(c, "10.0.0.1", "10.0.0.0/24")
+	if err := c.save(); err != nil {
+		t.Fatalf("Failed to save the cache: %s", err)
+	}
+
+	c1 := newECSCache(&scope, &queries)
+	c1.persistFile = file
+	if n, err := c1.load(); n != 1 || err != nil {
+		t.Fatalf("Expected 1 restored entry, got %d: %v", n, err)
+	}
+	if m := ecsQuery(c1, "10.0.0.1", "10.0.0.0/24"); queries != 1 || edns.Subnet(m).SourceScope != 24 {
+		t.Errorf("Expected the answer for the subnet from the cache, got %d queries to the backend", queries)
+	}
+
+	// Without ECS aware caching the item isn't restored.
+	c2 := New()
+	c2.persistFile = file
+	if n, err := c2.load(); n != 0 || err != nil {
+		t.Errorf("Expected no restored entries, got %d: %v", n, err)
+	}
+}
@@ -3,7 +3,10 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -27,11 +30,38 @@ func setup(c *caddy.Controller) error {
 		return ca
 	})
 
+	// Every cache can be inspected and flushed via the admin endpoint, if any cache enables it.
+	c.OnStartup(func() error { caches.add(ca); return nil })
+	c.OnRestartFailed(func() error { caches.add(ca); return nil })
+	c.OnRestart(func() error { caches.remove(ca); return nil })
+	c.OnFinalShutdown(func() error { caches.remove(ca); return nil })
+
+	if ca.adminAddr != "" {
+		a := &admin{Addr: ca.adminAddr}
+		c.OnStartup(func() error { uniqAdmin.Set(a.Addr, a.onStartup); return nil })
+		c.OnRestartFailed(func() error { uniqAdmin.Set(a.Addr, a.onStartup); return nil })
+
+		c.OnStartup(func() error { return uniqAdmin.ForEach() })
+		c.OnRestartFailed(func() error { return uniqAdmin.ForEach() })
+
+		c.OnRestart(a.onFinalShutdown)
+		c.OnFinalShutdown(a.onFinalShutdown)
+	}
+
+	if ca.persistFile != "" {
+		c.OnStartup(func() error { ca.startPersist(); return nil })
+		// Save before the new instance starts on a reload, so it picks up our items.
+		c.OnRestart(func() error { ca.saveLog(); return nil })
+		c.OnShutdown(func() error { ca.stopPersist(); return nil })
+		c.OnFinalShutdown(func() error { ca.saveLog(); return nil })
+	}
+
 	return nil
 }
 
 func cacheParse(c *caddy.Controller) (*Cache, error) {
 	ca := New()
+	pcapSet, ncapSet := false, false
 
 	j := 0
 	for c.Next() {
@@ -71,6 +101,7 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 					return nil, err
 				}
 				ca.pcap = pcap
+				pcapSet = true
 				if len(args) > 1 {
 					pttl, err := strconv.Atoi(args[1])
 					if err != nil {
@@ -103,6 +134,7 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 					return nil, err
 				}
 				ca.ncap = ncap
+				ncapSet = true
 				if len(args) > 1 {
 					nttl, err := strconv.Atoi(args[1])
 					if err != nil {
@@ -165,11 +197,11 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 
 			case "serve_stale":
 				args := c.RemainingArgs()
-				if len(args) > 1 {
+				if len(args) > 2 {
 					return nil, c.ArgErr()
 				}
 				ca.staleUpTo = 1 * time.Hour
-				if len(args) == 1 {
+				if len(args) > 0 {
 					d, err := time.ParseDuration(args[0])
 					if err != nil {
 						return nil, err
@@ -179,15 +211,172 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 					}
 					ca.staleUpTo = d
 				}
+				if len(args) > 1 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if d <= 0 {
+						return nil, errors.New("invalid non-positive client timeout for serve_stale")
+					}
+					ca.staleTimeout = d
+				}
+			case "ecs":
+				args := c.RemainingArgs()
+				if len(args) == 1 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				ca.ecs = &ecs{scope4: defaultECSScope4, scope6: defaultECSScope6, entries: defaultECSEntries}
+				if len(args) > 1 {
+					scope4, err := strconv.ParseUint(args[0], 10, 8)
+					if err != nil || scope4 > 32 {
+						return nil, fmt.Errorf("invalid IPv4 scope prefix length: %s", args[0])
+					}
+					scope6, err := strconv.ParseUint(args[1], 10, 8)
+					if err != nil || scope6 > 128 {
+						return nil, fmt.Errorf("invalid IPv6 scope prefix length: %s", args[1])
+					}
+					ca.ecs.scope4, ca.ecs.scope6 = uint8(scope4), uint8(scope6)
+				}
+				if len(args) > 2 {
+					entries, err := strconv.Atoi(args[2])
+					if err != nil {
+						return nil, err
+					}
+					if entries <= 0 {
+						return nil, fmt.Errorf("ecs entries should be positive: %d", entries)
+					}
+					ca.ecs.entries = entries
+				}
+			case "aggressive_nsec":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				size := defaultNsecSize
+				if len(args) == 1 {
+					var err error
+					if size, err = strconv.Atoi(args[0]); err != nil {
+						return nil, err
+					}
+					if size <= 0 {
+						return nil, fmt.Errorf("aggressive_nsec size should be positive: %d", size)
+					}
+				}
+				ca.nsecs = &nsecs{size: size}
+			case "memory":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				pmem, err := parseBytes(args[0])
+				if err != nil {
+					return nil, err
+				}
+				ca.pmem, ca.nmem = pmem, pmem
+				if len(args) > 1 {
+					if ca.nmem, err = parseBytes(args[1]); err != nil {
+						return nil, err
+					}
+				}
+			case "eviction":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "random":
+					ca.policy = cache.Random
+				case "tinylfu":
+					ca.policy = cache.TinyLFU
+				default:
+					return nil, fmt.Errorf("unknown eviction policy: %s", args[0])
+				}
+			case "admin":
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				ca.adminAddr = defaultAdminAddr
+				if len(args) == 1 {
+					if _, _, err := net.SplitHostPort(args[0]); err != nil {
+						return nil, err
+					}
+					ca.adminAddr = args[0]
+				}
+			case "persist":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.persistFile = args[0]
+				config := dnsserver.GetConfig(c)
+				if !filepath.IsAbs(ca.persistFile) && config.Root != "" {
+					ca.persistFile = filepath.Join(config.Root, ca.persistFile)
+				}
+				ca.persistInterval = defaultPersistInterval
+				if len(args) > 1 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if d < 0 {
+						return nil, errors.New("invalid negative duration for persist")
+					}
+					ca.persistInterval = d
+				}
 			default:
 				return nil, c.ArgErr()
 			}
 		}
 
 		ca.Zones = origins
-		ca.pcache = cache.New(ca.pcap)
-		ca.ncache = cache.New(ca.ncap)
+		// With a memory bound, the number of items is only limited when a capacity is given.
+		pcap, ncap := ca.pcap, ca.ncap
+		if ca.pmem > 0 && !pcapSet {
+			pcap = 0
+		}
+		if ca.nmem > 0 && !ncapSet {
+			ncap = 0
+		}
+		ca.pcache = newCache(pcap, ca.pmem, ca.policy)
+		ca.ncache = newCache(ncap, ca.nmem, ca.policy)
+		if ca.ecs != nil {
+			ca.ecs.names = cache.New(ca.pcap)
+		}
+		if ca.nsecs != nil {
+			ca.nsecs.zones = cache.New(ca.ncap)
+		}
 	}
 
 	return ca, nil
 }
+
+// newCache returns a cache for items holding at most size items and mem bytes, evicting with policy.
+func newCache(size int, mem int64, policy cache.Policy) *cache.Cache {
+	if mem == 0 && policy == cache.Random {
+		return cache.New(size)
+	}
+	return cache.NewWithOptions(size, cache.Options{MaxCost: mem, Cost: itemSize, Policy: policy})
+}
+
+// parseBytes parses a size in bytes, optionally with a K, M or G suffix for KiB, MiB or GiB.
+func parseBytes(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult, s = 1<<10, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1<<20, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "G"):
+		mult, s = 1<<30, strings.TrimSuffix(s, "G")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("memory size should be positive: %d", n)
+	}
+	return n * mult, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/cache"
 )
 
 func TestSetup(t *testing.T) {
@@ -117,20 +118,24 @@ func TestSetup(t *testing.T) {
 
 func TestServeStale(t *testing.T) {
 	tests := []struct {
-		input     string
-		shouldErr bool
-		staleUpTo time.Duration
+		input        string
+		shouldErr    bool
+		staleUpTo    time.Duration
+		staleTimeout time.Duration
 	}{
-		{"serve_stale", false, 1 * time.Hour},
-		{"serve_stale 20m", false, 20 * time.Minute},
-		{"serve_stale 1h20m", false, 80 * time.Minute},
-		{"serve_stale 0m", false, 0},
-		{"serve_stale 0", false, 0},
+		{"serve_stale", false, 1 * time.Hour, 0},
+		{"serve_stale 20m", false, 20 * time.Minute, 0},
+		{"serve_stale 1h20m", false, 80 * time.Minute, 0},
+		{"serve_stale 0m", false, 0, 0},
+		{"serve_stale 0", false, 0, 0},
+		{"serve_stale 1h 1800ms", false, 1 * time.Hour, 1800 * time.Millisecond},
 		// fails
-		{"serve_stale 20", true, 0},
-		{"serve_stale -20m", true, 0},
-		{"serve_stale aa", true, 0},
-		{"serve_stale 1m nono", true, 0},
+		{"serve_stale 20", true, 0, 0},
+		{"serve_stale -20m", true, 0, 0},
+		{"serve_stale aa", true, 0, 0},
+		{"serve_stale 1m nono", true, 0, 0},
+		{"serve_stale 1m 0s", true, 0, 0},
+		{"serve_stale 1m 1s 1s", true, 0, 0},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
@@ -148,5 +153,196 @@ func TestServeStale(t *testing.T) {
 		if ca.staleUpTo != test.staleUpTo {
 			t.Errorf("Test %v: Expected stale %v but found: %v", i, test.staleUpTo, ca.staleUpTo)
 		}
+		if ca.staleTimeout != test.staleTimeout {
+			t.Errorf("Test %v: Expected client timeout %v but found: %v", i, test.staleTimeout, ca.staleTimeout)
+		}
+	}
+}
+
+func TestPersist(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		file      string
+		interval  time.Duration
+	}{
+		{"persist /tmp/cache", false, "/tmp/cache", defaultPersistInterval},
+		{"persist /tmp/cache 1m", false, "/tmp/cache", time.Minute},
+		{"persist /tmp/cache 0", false, "/tmp/cache", 0},
+		// fails
+		{"persist", true, "", 0},
+		{"persist /tmp/cache -1m", true, "", 0},
+		{"persist /tmp/cache aa", true, "", 0},
+		{"persist /tmp/cache 1m nono", true, "", 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.persistFile != test.file {
+			t.Errorf("Test %v: Expected persist file %v but found: %v", i, test.file, ca.persistFile)
+		}
+		if ca.persistInterval != test.interval {
+			t.Errorf("Test %v: Expected persist interval %v but found: %v", i, test.interval, ca.persistInterval)
+		}
+	}
+}
+
+func TestECS(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		scope4    uint8
+		scope6    uint8
+		entries   int
+	}{
+		{"ecs", false, defaultECSScope4, defaultECSScope6, defaultECSEntries},
+		{"ecs 16 48", false, 16, 48, defaultECSEntries},
+		{"ecs 32 128 8", false, 32, 128, 8},
+		// fails
+		{"ecs 24", true, 0, 0, 0},
+		{"ecs 33 56", true, 0, 0, 0},
+		{"ecs 24 129", true, 0, 0, 0},
+		{"ecs 24 56 0", true, 0, 0, 0},
+		{"ecs 24 56 aa", true, 0, 0, 0},
+		{"ecs 24 56 8 nono", true, 0, 0, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.ecs.scope4 != test.scope4 || ca.ecs.scope6 != test.scope6 {
+			t.Errorf("Test %v: Expected scopes %d and %d but found: %d and %d", i, test.scope4, test.scope6, ca.ecs.scope4, ca.ecs.scope6)
+		}
+		if ca.ecs.entries != test.entries {
+			t.Errorf("Test %v: Expected entries %d but found: %d", i, test.entries, ca.ecs.entries)
+		}
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		addr      string
+	}{
+		{"admin", false, defaultAdminAddr},
+		{"admin :9155", false, ":9155"},
+		// fails
+		{"admin 9155", true, ""},
+		{"admin :9155 :9156", true, ""},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.adminAddr != test.addr {
+			t.Errorf("Test %v: Expected admin address %v but found: %v", i, test.addr, ca.adminAddr)
+		}
+	}
+}
+
+func TestAggressiveNsec(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		size      int
+	}{
+		{"aggressive_nsec", false, defaultNsecSize},
+		{"aggressive_nsec 100", false, 100},
+		// fails
+		{"aggressive_nsec 0", true, 0},
+		{"aggressive_nsec aa", true, 0},
+		{"aggressive_nsec 100 nono", true, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.nsecs == nil || ca.nsecs.zones == nil {
+			t.Errorf("Test %v: Expected aggressive NSEC caching to be enabled", i)
+			continue
+		}
+		if ca.nsecs.size != test.size {
+			t.Errorf("Test %v: Expected size %v but found: %v", i, test.size, ca.nsecs.size)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		pmem      int64
+		nmem      int64
+		policy    cache.Policy
+	}{
+		{"memory 1024", false, 1024, 1024, cache.Random},
+		{"memory 64M 16M", false, 64 << 20, 16 << 20, cache.Random},
+		{"memory 1G\neviction tinylfu", false, 1 << 30, 1 << 30, cache.TinyLFU},
+		{"eviction random", false, 0, 0, cache.Random},
+		// fails
+		{"memory", true, 0, 0, 0},
+		{"memory 0", true, 0, 0, 0},
+		{"memory 64X", true, 0, 0, 0},
+		{"memory 1M 1M 1M", true, 0, 0, 0},
+		{"eviction lru", true, 0, 0, 0},
+		{"eviction", true, 0, 0, 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr && err != nil {
+			continue
+		}
+		if ca.pmem != test.pmem || ca.nmem != test.nmem {
+			t.Errorf("Test %v: Expected memory %d %d but found: %d %d", i, test.pmem, test.nmem, ca.pmem, ca.nmem)
+		}
+		if ca.policy != test.policy {
+			t.Errorf("Test %v: Expected policy %v but found: %v", i, test.policy, ca.policy)
+		}
 	}
 }
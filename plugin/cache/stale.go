@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// staleWriter hands the response to the client to serveStaleAfter, instead of writing it.
+type staleWriter struct {
+	dns.ResponseWriter
+	ch chan *dns.Msg
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *staleWriter) WriteMsg(m *dns.Msg) error {
+	select {
+	case w.ch <- m:
+	default:
+	}
+	return nil
+}
+
+// serveStaleAfter implements the client response timer of RFC 8767: it resolves the request for the
+// stale item i, and replies with the fresh response if it arrives within c.staleTimeout. Otherwise, or
+// when the resolution fails, the stale item is served and the resolution continues in the background
+// to refresh the cache. ttl is the (negative) TTL of i.
+func (c *Cache) serveStaleAfter(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request, server string, i *item, now time.Time, ttl int) (int, error) {
+	do := state.Do()
+	ch := make(chan *dns.Msg, 2)
+	sw := &staleWriter{ResponseWriter: w, ch: ch}
+	// Resolve the address now, the connection might be closed when the resolution finishes.
+	crr := &ResponseWriter{ResponseWriter: sw, Cache: c, state: state, server: server, do: do, refresh: true, remoteAddr: w.RemoteAddr()}
+
+	go func() {
+		c.doRefresh(ctx, state, crr)
+		// Signal a failure if nothing was written.
+		sw.WriteMsg(nil)
+	}()
+
+	timer := time.NewTimer(c.staleTimeout)
+	defer timer.Stop()
+
+	reason := "timeout"
+	select {
+	case m := <-ch:
+		if m != nil && m.Rcode != dns.RcodeServerFailure && m.Rcode != dns.RcodeRefused {
+			w.WriteMsg(m)
+			return dns.RcodeSuccess, nil
+		}
+		reason = "failure"
+	case <-timer.C:
+	}
+
+	servedStale.WithLabelValues(server).Inc()
+	servedStaleAfter.WithLabelValues(server, reason).Inc()
+
+	// Adjust the time to get a 0 TTL in the reply built from a stale item.
+	now = now.Add(time.Duration(ttl) * time.Second)
+	resp := i.toMsg(r, now, do)
+	if c.ecs != nil {
+		setSubnet(r, resp, i)
+	}
+	edns.SetExtendedError(r, resp, dns.ExtendedErrorCodeStaleAnswer, "")
+	w.WriteMsg(resp)
+
+	return dns.RcodeSuccess, nil
+}
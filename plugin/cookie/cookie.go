@@ -0,0 +1,172 @@
+// Package cookie implements server side DNS Cookies (RFC 7873).
+package cookie
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Cookie adds server cookies to the responses of clients that send a client cookie, and validates the
+// server cookies clients send back. Server cookies are made as described in RFC 9018.
+type Cookie struct {
+	Next plugin.Handler
+
+	require bool // send BADCOOKIE to UDP clients without a valid server cookie
+
+	secrets *secrets
+	now     func() time.Time
+}
+
+// New returns a Cookie with a random secret that is rotated every rotate.
+func New(rotate time.Duration) *Cookie {
+	return &Cookie{secrets: newSecrets(rotate), now: time.Now}
+}
+
+type validKey struct{}
+
+// Valid returns true when the request in ctx carried a valid server cookie. Such a client proved it
+// receives our responses, so its source address isn't spoofed.
+func Valid(ctx context.Context) bool {
+	v, _ := ctx.Value(validKey{}).(bool)
+	return v
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (c *Cookie) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	cookie := edns.Cookie(r)
+	if cookie == "" {
+		return plugin.NextOrFailure(c.Name(), c.Next, ctx, w, r)
+	}
+
+	b, err := hex.DecodeString(cookie)
+	// A client cookie is 8 bytes, a server cookie between 8 and 32 bytes.
+	if err != nil || len(b) < clientLen || (len(b) > clientLen && len(b) < clientLen+8) || len(b) > clientLen+32 {
+		return dns.RcodeFormatError, nil
+	}
+
+	state := request.Request{W: w, Req: r}
+	ip := net.ParseIP(state.IP())
+	now := c.now()
+
+	client, server := b[:clientLen:clientLen], b[clientLen:]
+	valid, fresh := c.validate(client, server, ip, now)
+	if !valid && c.require && state.Proto() == "udp" {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeBadCookie)
+		edns.SetCookie(m, hex.EncodeToString(append(client, c.server(client, ip, now)...)))
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+	if valid {
+		ctx = context.WithValue(ctx, validKey{}, true)
+	}
+	if !fresh {
+		server = c.server(client, ip, now)
+	}
+
+	cw := &ResponseWriter{ResponseWriter: w, cookie: hex.EncodeToString(append(client, server...))}
+	return plugin.NextOrFailure(c.Name(), c.Next, ctx, cw, r)
+}
+
+// Name implements the plugin.Handler interface.
+func (c *Cookie) Name() string { return "cookie" }
+
+// server returns a new server cookie for client cookie client, sent from ip.
+func (c *Cookie) server(client []byte, ip net.IP, now time.Time) []byte {
+	secret, _ := c.secrets.get(now)
+	return serverCookie(secret, client, ip, uint32(now.Unix()))
+}
+
+// validate checks the server cookie, it returns true when it is valid. Fresh is true when the cookie
+// can be sent back as is, otherwise a new one should be made.
+func (c *Cookie) validate(client, server []byte, ip net.IP, now time.Time) (valid, fresh bool) {
+	if len(server) != serverLen || server[0] != version {
+		return false, false
+	}
+
+	// Serial number arithmetic, so this keeps working after 2106.
+	age := int32(uint32(now.Unix()) - binary.BigEndian.Uint32(server[4:8]))
+	if age > int32(maxAge.Seconds()) || age < -int32(maxSkew.Seconds()) {
+		return false, false
+	}
+
+	secret, previous := c.secrets.get(now)
+	ts := binary.BigEndian.Uint32(server[4:8])
+	if s := serverCookie(secret, client, ip, ts); string(s) == string(server) {
+		return true, age < int32(refreshAge.Seconds())
+	}
+	if previous != nil {
+		if s := serverCookie(*previous, client, ip, ts); string(s) == string(server) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// serverCookie returns the server cookie as defined in RFC 9018: version, reserved, timestamp and
+// the SipHash-2-4 of those, the client cookie and the client's address.
+func serverCookie(secret [16]byte, client []byte, ip net.IP, ts uint32) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	b := make([]byte, 0, clientLen+serverLen+len(ip))
+	b = append(b, client...)
+	b = append(b, version, 0, 0, 0)
+	b = binary.BigEndian.AppendUint32(b, ts)
+	b = append(b, ip...)
+
+	server := make([]byte, 8, serverLen)
+	copy(server, b[clientLen:clientLen+8])
+	return binary.LittleEndian.AppendUint64(server, siphash(secret, b))
+}
+
+// secrets holds the secret used to make server cookies, and the previous one, if the secret is
+// rotated. Server cookies made with the previous secret are still valid.
+type secrets struct {
+	sync.Mutex
+	current  [16]byte
+	previous *[16]byte
+	rotated  time.Time
+	rotate   time.Duration // zero disables rotation
+}
+
+func newSecrets(rotate time.Duration) *secrets {
+	s := &secrets{rotate: rotate, rotated: time.Now()}
+	rand.Read(s.current[:])
+	return s
+}
+
+// get returns the current and previous secret, rotating them when it's time.
+func (s *secrets) get(now time.Time) ([16]byte, *[16]byte) {
+	s.Lock()
+	defer s.Unlock()
+	if s.rotate > 0 && now.Sub(s.rotated) >= s.rotate {
+		previous := s.current
+		s.previous = &previous
+		rand.Read(s.current[:])
+		s.rotated = now
+	}
+	return s.current, s.previous
+}
+
+const (
+	clientLen = 8
+	serverLen = 16
+	version   = 1
+
+	maxAge     = time.Hour       // server cookies older than this are invalid
+	maxSkew    = 5 * time.Minute // server cookies from this far into the future are still valid
+	refreshAge = 30 * time.Minute
+)
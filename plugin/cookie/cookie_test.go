@@ -0,0 +1,186 @@
+package cookie
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestSiphash(t *testing.T) {
+	// Test vector from the SipHash paper.
+	var k [16]byte
+	for i := range k {
+		k[i] = byte(i)
+	}
+	p := make([]byte, 15)
+	for i := range p {
+		p[i] = byte(i)
+	}
+	if h := siphash(k, p); h != 0xa129ca6149be45e5 {
+		t.Errorf("Expected hash %x, got %x", uint64(0xa129ca6149be45e5), h)
+	}
+}
+
+func TestServerCookie(t *testing.T) {
+	// Test vector from RFC 9018, Appendix A.1.
+	var secret [16]byte
+	b, _ := hex.DecodeString("e5e973e5a6b2a43f48e7dc849e37bfcf")
+	copy(secret[:], b)
+	client, _ := hex.DecodeString("2464c4abcf10c957")
+
+	server := serverCookie(secret, client, net.ParseIP("198.51.100.100"), 1559731985)
+	if s := hex.EncodeToString(server); s != "010000005cf79f111f8130c3eee29480" {
+		t.Errorf("Expected server cookie %s, got %s", "010000005cf79f111f8130c3eee29480", s)
+	}
+}
+
+// query sends a query with cookie to c, it returns the response and if the server cookie was valid.
+func query(c *Cookie, cookie string, tcp bool) (*dns.Msg, bool) {
+	valid := false
+	c.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		valid = Valid(ctx)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	if cookie != "" {
+		edns.SetCookie(m, cookie)
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{TCP: tcp})
+	rcode, _ := c.ServeDNS(context.TODO(), rec, m)
+	if rec.Msg == nil {
+		rec.Msg = new(dns.Msg)
+		rec.Msg.SetRcode(m, rcode)
+	}
+	return rec.Msg, valid
+}
+
+func TestCookie(t *testing.T) {
+	c := New(defaultRotate)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	const client = "0102030405060708"
+
+	m, valid := query(c, "", false)
+	if edns.Cookie(m) != "" || valid {
+		t.Errorf("Expected no cookie without a client cookie, got %s", edns.Cookie(m))
+	}
+
+	// Only a client cookie, we should get a server cookie.
+	m, valid = query(c, client, false)
+	cookie := edns.Cookie(m)
+	if len(cookie) != 2*(clientLen+serverLen) || cookie[:16] != client {
+		t.Fatalf("Expected a client and server cookie, got %s", cookie)
+	}
+	if valid {
+		t.Error("Expected the request to be not valid without a server cookie")
+	}
+
+	// Send it back, it should be valid and returned unchanged.
+	m, valid = query(c, cookie, false)
+	if !valid {
+		t.Error("Expected the server cookie to be valid")
+	}
+	if edns.Cookie(m) != cookie {
+		t.Errorf("Expected the same cookie %s, got %s", cookie, edns.Cookie(m))
+	}
+
+	// After the refresh age the cookie is still valid, but we get a new one.
+	now = now.Add(refreshAge + time.Minute)
+	m, valid = query(c, cookie, false)
+	if !valid {
+		t.Error("Expected the server cookie to be valid")
+	}
+	if edns.Cookie(m) == cookie {
+		t.Error("Expected a new server cookie")
+	}
+
+	// Too old.
+	now = now.Add(maxAge)
+	_, valid = query(c, cookie, false)
+	if valid {
+		t.Error("Expected the expired server cookie to be not valid")
+	}
+
+	// Another client cookie, or another address, doesn't validate.
+	_, valid = query(c, "ffffffffffffffff"+cookie[16:], false)
+	if valid {
+		t.Error("Expected the server cookie with another client cookie to be not valid")
+	}
+
+	// Malformed cookies.
+	for _, cookie := range []string{"01020304", client + "0102", "zz" + client[2:]} {
+		m, _ = query(c, cookie, false)
+		if m.Rcode != dns.RcodeFormatError {
+			t.Errorf("Expected FORMERR for cookie %s, got %s", cookie, dns.RcodeToString[m.Rcode])
+		}
+	}
+}
+
+func TestCookieRequire(t *testing.T) {
+	c := New(defaultRotate)
+	c.require = true
+
+	const client = "0102030405060708"
+
+	m, _ := query(c, client, false)
+	if m.Rcode != dns.RcodeBadCookie {
+		t.Fatalf("Expected BADCOOKIE, got %s", dns.RcodeToString[m.Rcode])
+	}
+	cookie := edns.Cookie(m)
+	if len(cookie) != 2*(clientLen+serverLen) {
+		t.Fatalf("Expected a server cookie with BADCOOKIE, got %s", cookie)
+	}
+
+	m, valid := query(c, cookie, false)
+	if m.Rcode != dns.RcodeSuccess || !valid {
+		t.Errorf("Expected a valid response with the server cookie, got %s", dns.RcodeToString[m.Rcode])
+	}
+
+	// TCP clients are not spoofed.
+	m, _ = query(c, client, true)
+	if m.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected NOERROR over TCP, got %s", dns.RcodeToString[m.Rcode])
+	}
+}
+
+func TestCookieRotate(t *testing.T) {
+	c := New(2 * time.Hour)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	m, _ := query(c, "0102030405060708", false)
+	cookie := edns.Cookie(m)
+
+	// Rotate the secret. The cookie we got is too old by now, so make a recent one with the previous
+	// secret, which should still be valid, but replaced.
+	now = now.Add(2*time.Hour + time.Second)
+	_, previous := c.secrets.get(now)
+	if previous == nil {
+		t.Fatal("Expected the secret to be rotated")
+	}
+	client, _ := hex.DecodeString(cookie[:16])
+	old := hex.EncodeToString(append(client, serverCookie(*previous, client, net.ParseIP("10.240.0.1"), uint32(now.Unix()))...))
+
+	m, valid := query(c, old, false)
+	if !valid {
+		t.Error("Expected the server cookie made with the previous secret to be valid")
+	}
+	if edns.Cookie(m) == old {
+		t.Error("Expected a new server cookie made with the current secret")
+	}
+}
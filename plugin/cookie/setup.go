@@ -0,0 +1,91 @@
+package cookie
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+const pluginName = "cookie"
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	ck, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		ck.Next = next
+		return ck
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*Cookie, error) {
+	ck := New(defaultRotate)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+		if len(c.RemainingArgs()) != 0 {
+			return nil, c.ArgErr()
+		}
+
+		secret := false
+		for c.NextBlock() {
+			switch c.Val() {
+			case "secret":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				b, err := hex.DecodeString(args[0])
+				if err != nil || len(b) != len(ck.secrets.current) {
+					return nil, c.Errf("secret must be %d hex encoded bytes: %s", len(ck.secrets.current), args[0])
+				}
+				copy(ck.secrets.current[:], b)
+				secret = true
+			case "rotate":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if d < 0 {
+					return nil, c.Errf("rotate can not be negative: %s", d)
+				}
+				// Cookies made with the previous secret must stay valid for their lifetime.
+				if d > 0 && d < maxAge {
+					return nil, c.Errf("rotate must be at least %s: %s", maxAge, d)
+				}
+				ck.secrets.rotate = d
+			case "require":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				ck.require = true
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+		// A configured secret is shared with other servers, it can't be rotated by us.
+		if secret {
+			ck.secrets.rotate = 0
+		}
+	}
+	return ck, nil
+}
+
+const defaultRotate = 24 * time.Hour
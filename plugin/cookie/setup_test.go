@@ -0,0 +1,87 @@
+package cookie
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("dns", `cookie`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", `cookie example.org`)
+	if err := setup(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		require   bool
+		rotate    time.Duration
+		secret    string
+	}{
+		{`cookie`, false, false, defaultRotate, ""},
+		{`cookie {
+			require
+			rotate 2h
+		}`, false, true, 2 * time.Hour, ""},
+		{`cookie {
+			rotate 0
+		}`, false, false, 0, ""},
+		{`cookie {
+			secret e5e973e5a6b2a43f48e7dc849e37bfcf
+		}`, false, false, 0, "e5e973e5a6b2a43f48e7dc849e37bfcf"},
+		// fails
+		{`cookie {
+			secret e5e973e5
+		}`, true, false, 0, ""},
+		{`cookie {
+			secret zz
+		}`, true, false, 0, ""},
+		{`cookie {
+			rotate 10m
+		}`, true, false, 0, ""},
+		{`cookie {
+			require yes
+		}`, true, false, 0, ""},
+		{`cookie {
+			blah
+		}`, true, false, 0, ""},
+		{`cookie
+		cookie`, true, false, 0, ""},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		ck, err := parse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			continue
+		}
+
+		if ck.require != test.require {
+			t.Errorf("Test %d: expected require %t, got %t", i, test.require, ck.require)
+		}
+		if ck.secrets.rotate != test.rotate {
+			t.Errorf("Test %d: expected rotate %s, got %s", i, test.rotate, ck.secrets.rotate)
+		}
+		if test.secret != "" && hex.EncodeToString(ck.secrets.current[:]) != test.secret {
+			t.Errorf("Test %d: expected secret %s, got %x", i, test.secret, ck.secrets.current)
+		}
+	}
+}
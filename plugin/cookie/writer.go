@@ -0,0 +1,20 @@
+package cookie
+
+import (
+	"github.com/coredns/coredns/plugin/pkg/edns"
+
+	"github.com/miekg/dns"
+)
+
+// ResponseWriter is a response writer that adds the cookie to every response.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	cookie string
+}
+
+// WriteMsg implements the dns.ResponseWriter interface. Any existing cookie, i.e. one from an
+// upstream, is replaced.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	edns.SetCookie(res, w.cookie)
+	return w.ResponseWriter.WriteMsg(res)
+}
@@ -3,10 +3,12 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/transfer"
 	"github.com/coredns/coredns/request"
@@ -52,12 +54,19 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeRefused, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		return z.serveUpdate(state)
+	}
+
 	// This is only for when we are a secondary zones.
 	if r.Opcode == dns.OpcodeNotify {
 		if z.isNotify(state) {
 			m := new(dns.Msg)
 			m.SetReply(r)
 			m.Authoritative = true
+			if z.TsigKey != nil {
+				z.TsigKey.Sign(m)
+			}
 			w.WriteMsg(m)
 
 			log.Infof("Notify from %s for %s: checking transfer", state.IP(), zone)
@@ -81,7 +90,7 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 	z.RUnlock()
 	if exp {
 		log.Errorf("Zone %s is expired", zone)
-		return dns.RcodeServerFailure, nil
+		return notAuthoritative("zone expired")
 	}
 
 	answer, ns, extra, result := z.Lookup(ctx, state, qname)
@@ -99,6 +108,13 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 	case Delegation:
 		m.Authoritative = false
 	case ServerFailure:
+		// A secondary zone that hasn't been transferred yet, doesn't have a SOA.
+		z.RLock()
+		loaded := z.Apex.SOA != nil
+		z.RUnlock()
+		if !loaded {
+			return notAuthoritative("zone not loaded")
+		}
 		return dns.RcodeServerFailure, nil
 	}
 
@@ -109,6 +125,12 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 // Name implements the Handler interface.
 func (f File) Name() string { return "file" }
 
+// notAuthoritative returns SERVFAIL with an extended error telling the client we can't answer
+// authoritatively for the zone, because of reason text. The server writes the reply.
+func notAuthoritative(text string) (int, error) {
+	return dns.RcodeServerFailure, &edns.Error{Err: errors.New(text), Code: dns.ExtendedErrorCodeNotAuthoritative, Text: text}
+}
+
 type serialErr struct {
 	err    string
 	zone   string
@@ -1,8 +1,16 @@
 package file
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func BenchmarkFileParseInsert(b *testing.B) {
@@ -21,6 +29,33 @@ func TestParseNoSOA(t *testing.T) {
 	}
 }
 
+func TestServeDNSNotAuthoritative(t *testing.T) {
+	// A secondary zone that has not been transferred yet.
+	zone := NewZone("example.org.", "stdin")
+	f := File{Zones: Zones{Z: map[string]*Zone{"example.org.": zone}, Names: []string{"example.org."}}}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	// The SERVFAIL is left to the server, so plugins in front don't cache it.
+	rcode, err := f.ServeDNS(context.TODO(), rec, m)
+	if rcode != dns.RcodeServerFailure || rec.Msg != nil {
+		t.Fatalf("Expected SERVFAIL to be returned and nothing written, got %d and %v", rcode, rec.Msg)
+	}
+	var ede *edns.Error
+	if !errors.As(err, &ede) || ede.Code != dns.ExtendedErrorCodeNotAuthoritative {
+		t.Errorf("Expected a not authoritative extended error, got %v", err)
+	}
+
+	zone.Expired = true
+	_, err = f.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+	if !errors.As(err, &ede) || ede.Text != "zone expired" {
+		t.Errorf("Expected an extended error for the expired zone, got %v", err)
+	}
+}
+
 const dbNoSOA = `
 $TTL         1M
 $ORIGIN      example.org.
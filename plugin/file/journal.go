@@ -0,0 +1,92 @@
+package file
+
+import (
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultJournalSize is the default number of changes kept in the journal of a zone.
+const DefaultJournalSize = 10
+
+// change holds the differences between two consecutive versions of a zone, identified by their SOA records.
+type change struct {
+	from    *dns.SOA
+	to      *dns.SOA
+	deleted []dns.RR
+	added   []dns.RR
+}
+
+// diff returns the change between the zone versions with the records in before and after; these
+// include all records except the SOA.
+func diff(from, to *dns.SOA, before, after []dns.RR) *change {
+	c := &change{from: from, to: to}
+
+	seen := make(map[string]bool, len(before))
+	for _, rr := range before {
+		seen[rr.String()] = true
+	}
+	for _, rr := range after {
+		s := rr.String()
+		if seen[s] {
+			delete(seen, s)
+			continue
+		}
+		c.added = append(c.added, rr)
+	}
+	for _, rr := range before {
+		if seen[rr.String()] {
+			c.deleted = append(c.deleted, rr)
+		}
+	}
+	return c
+}
+
+// records returns all records of the zone version in apex and t, except the SOA.
+func records(apex Apex, t *tree.Tree) []dns.RR {
+	rrs := []dns.RR{}
+	rrs = append(rrs, apex.SIGSOA...)
+	rrs = append(rrs, apex.NS...)
+	rrs = append(rrs, apex.SIGNS...)
+	t.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { rrs = append(rrs, e.All()...); return nil })
+	return rrs
+}
+
+// journal records the change from the current version of z to the one in apex and t. When the
+// journal holds more than z.JournalSize changes, the oldest is dropped. The caller must hold the
+// write lock of z.
+func (z *Zone) journal(apex Apex, t *tree.Tree) {
+	if z.JournalSize <= 0 || z.Apex.SOA == nil || apex.SOA == nil {
+		return
+	}
+	c := diff(z.Apex.SOA, apex.SOA, records(z.Apex, z.Tree), records(apex, t))
+	z.changes = append(z.changes, c)
+	if len(z.changes) > z.JournalSize {
+		z.changes = z.changes[len(z.changes)-z.JournalSize:]
+	}
+}
+
+// ixfr returns the records of an incremental zone transfer from serial to the current version of
+// the zone, as described in RFC 1995: the current SOA, followed by each change as the old SOA, the
+// deleted records, the new SOA and the added records, and the current SOA again. If the journal
+// does not reach back to serial, nil is returned.
+func (z *Zone) ixfr(serial uint32) [][]dns.RR {
+	z.RLock()
+	defer z.RUnlock()
+
+	if z.Apex.SOA == nil {
+		return nil
+	}
+	for i, c := range z.changes {
+		if c.from.Serial != serial {
+			continue
+		}
+		rrs := [][]dns.RR{{z.Apex.SOA}}
+		for _, c := range z.changes[i:] {
+			rrs = append(rrs, append([]dns.RR{c.from}, c.deleted...))
+			rrs = append(rrs, append([]dns.RR{c.to}, c.added...))
+		}
+		return append(rrs, []dns.RR{z.Apex.SOA})
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const journalZone1 = `$ORIGIN example.org.
+@	3600 IN	SOA sns.dns.icann.org. noc.dns.icann.org. 1 7200 3600 1209600 3600
+	3600 IN	NS  a.iana-servers.net.
+a	3600 IN	A   127.0.0.1
+b	3600 IN	A   127.0.0.2
+`
+
+const journalZone2 = `$ORIGIN example.org.
+@	3600 IN	SOA sns.dns.icann.org. noc.dns.icann.org. 2 7200 3600 1209600 3600
+	3600 IN	NS  a.iana-servers.net.
+a	3600 IN	A   127.0.0.1
+b	3600 IN	A   127.0.0.3
+`
+
+const journalZone3 = `$ORIGIN example.org.
+@	3600 IN	SOA sns.dns.icann.org. noc.dns.icann.org. 3 7200 3600 1209600 3600
+	3600 IN	NS  a.iana-servers.net.
+a	3600 IN	A   127.0.0.1
+b	3600 IN	A   127.0.0.3
+c	3600 IN	A   127.0.0.4
+`
+
+// journaledZone returns the zone with all versions loaded in order, as reload would do.
+func journaledZone(t *testing.T, size int, versions ...string) *Zone {
+	var z *Zone
+	for _, v := range versions {
+		zone, err := Parse(strings.NewReader(v), "example.org.", "stdin", 0)
+		if err != nil {
+			t.Fatalf("Failed to parse zone: %s", err)
+		}
+		if z == nil {
+			z = zone
+			z.JournalSize = size
+			continue
+		}
+		z.Lock()
+		z.journal(zone.Apex, zone.Tree)
+		z.Apex = zone.Apex
+		z.Tree = zone.Tree
+		z.Unlock()
+	}
+	return z
+}
+
+func TestJournalIXFR(t *testing.T) {
+	z := journaledZone(t, DefaultJournalSize, journalZone1, journalZone2, journalZone3)
+
+	ixfr := z.ixfr(1)
+	expect := []struct {
+		serial uint32
+		rrs    []string
+	}{
+		{3, nil},
+		{1, []string{"b.example.org.\t3600\tIN\tA\t127.0.0.2"}},
+		{2, []string{"b.example.org.\t3600\tIN\tA\t127.0.0.3"}},
+		{2, nil},
+		{3, []string{"c.example.org.\t3600\tIN\tA\t127.0.0.4"}},
+		{3, nil},
+	}
+	if len(ixfr) != len(expect) {
+		t.Fatalf("Expected %d parts, got %d: %v", len(expect), len(ixfr), ixfr)
+	}
+	for i, rrs := range ixfr {
+		soa, ok := rrs[0].(*dns.SOA)
+		if !ok {
+			t.Fatalf("Part %d: expected SOA first, got %s", i, rrs[0])
+		}
+		if soa.Serial != expect[i].serial {
+			t.Errorf("Part %d: expected SOA serial %d, got %d", i, expect[i].serial, soa.Serial)
+		}
+		if len(rrs)-1 != len(expect[i].rrs) {
+			t.Fatalf("Part %d: expected %d records, got %d: %v", i, len(expect[i].rrs), len(rrs)-1, rrs[1:])
+		}
+		for j, rr := range rrs[1:] {
+			if rr.String() != expect[i].rrs[j] {
+				t.Errorf("Part %d: expected %q, got %q", i, expect[i].rrs[j], rr.String())
+			}
+		}
+	}
+
+	if ixfr := z.ixfr(2); len(ixfr) != 4 {
+		t.Errorf("Expected %d parts for serial 2, got %d", 4, len(ixfr))
+	}
+	if ixfr := z.ixfr(100); ixfr != nil {
+		t.Errorf("Expected no incremental transfer for unknown serial, got %v", ixfr)
+	}
+}
+
+func TestJournalSize(t *testing.T) {
+	z := journaledZone(t, 1, journalZone1, journalZone2, journalZone3)
+	if ixfr := z.ixfr(1); ixfr != nil {
+		t.Errorf("Expected serial 1 to be dropped from the journal, got %v", ixfr)
+	}
+	if ixfr := z.ixfr(2); ixfr == nil {
+		t.Error("Expected incremental transfer for serial 2")
+	}
+
+	z = journaledZone(t, 0, journalZone1, journalZone2)
+	if ixfr := z.ixfr(1); ixfr != nil {
+		t.Errorf("Expected no journal, got %v", ixfr)
+	}
+}
+
+func TestTransferIXFR(t *testing.T) {
+	z := journaledZone(t, DefaultJournalSize, journalZone1, journalZone2)
+
+	ch, err := z.Transfer(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rrs := range ch {
+		n += len(rrs)
+	}
+	// SOA 2, SOA 1, deleted b, SOA 2, added b, SOA 2
+	if n != 6 {
+		t.Errorf("Expected %d records, got %d", 6, n)
+	}
+}
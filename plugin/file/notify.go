@@ -10,7 +10,8 @@ import (
 
 // isNotify checks if state is a notify message and if so, will *also* check if it
 // is from one of the configured masters. If not it will not be a valid notify
-// message. If the zone z is not a secondary zone the message will also be ignored.
+// message. If the zone z is not a secondary zone the message will also be ignored. When the
+// zone has a TSIG key, the notify must be signed with it.
 func (z *Zone) isNotify(state request.Request) bool {
 	if state.Req.Opcode != dns.OpcodeNotify {
 		return false
@@ -18,6 +19,12 @@ func (z *Zone) isNotify(state request.Request) bool {
 	if len(z.TransferFrom) == 0 {
 		return false
 	}
+	if z.TsigKey != nil {
+		if err := z.TsigKey.Verify(state.W, state.Req); err != nil {
+			log.Warningf("Notify from %s for %s failed TSIG verification: %s", state.IP(), z.origin, err)
+			return false
+		}
+	}
 	// If remote IP matches we accept.
 	remote := state.IP()
 	for _, f := range z.TransferFrom {
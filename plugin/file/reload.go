@@ -34,9 +34,15 @@ func (z *Zone) Reload(t *transfer.Transfer) error {
 					}
 					continue
 				}
+				// With dynamic updates the zone in memory can be newer than the file, keep it until the file catches up.
+				if len(z.UpdateFrom) > 0 && serial >= 0 && less(zone.Apex.SOA.Serial, uint32(serial)) {
+					log.Debugf("Not reloading zone %q in %q: SOA serial %d is older than %d", z.origin, zFile, zone.Apex.SOA.Serial, serial)
+					continue
+				}
 
 				// copy elements we need
 				z.Lock()
+				z.journal(zone.Apex, zone.Tree)
 				z.Apex = zone.Apex
 				z.Tree = zone.Tree
 				z.Unlock()
@@ -3,6 +3,7 @@ package file
 import (
 	"context"
 	"io/ioutil"
+	"net"
 	"os"
 	"strings"
 	"testing"
@@ -89,3 +90,58 @@ const reloadZone2Test = `miek.nl.		1627	IN	SOA	linode.atoom.net. miek.miek.nl. 1
 miek.nl.		1627	IN	NS	ext.ns.whyscream.net.
 miek.nl.		1627	IN	NS	omval.tednet.nl.
 `
+
+func TestZoneReloadAfterUpdate(t *testing.T) {
+	fileName, rm, err := test.TempFile(".", reloadZoneTest)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+	reader, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Failed to open zone: %s", err)
+	}
+	z, err := Parse(reader, "miek.nl", fileName, 0)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	z.UpdateFrom = []*net.IPNet{all}
+
+	m := new(dns.Msg)
+	m.SetUpdate("miek.nl.")
+	m.Insert([]dns.RR{test.A("a.miek.nl. 3600 IN A 127.0.0.1")})
+	if rcode, _ := z.applyUpdate(m); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected success, got %s", dns.RcodeToString[rcode])
+	}
+
+	// Touch the file, so a reload finds its older serial.
+	if err := ioutil.WriteFile(fileName, []byte(reloadZoneTest), 0644); err != nil {
+		t.Fatalf("Failed to write zone data: %s", err)
+	}
+	z.ReloadInterval = 10 * time.Millisecond
+	z.Reload(&transfer.Transfer{})
+	defer close(z.reloadShutdown)
+	time.Sleep(30 * time.Millisecond)
+
+	r := new(dns.Msg)
+	r.SetQuestion("a.miek.nl.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: r}
+	if _, _, _, res := z.Lookup(context.TODO(), state, "a.miek.nl."); res != Success {
+		t.Errorf("Expected the update to survive the reload, got %d", res)
+	}
+
+	// A file with a newer serial replaces the zone.
+	if err := ioutil.WriteFile(fileName, []byte(reloadZone3Test), 0644); err != nil {
+		t.Fatalf("Failed to write new zone data: %s", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if serial := z.SOASerialIfDefined(); serial != 1460175190 {
+		t.Errorf("Expected the zone to be reloaded with serial 1460175190, got %d", serial)
+	}
+}
+
+const reloadZone3Test = `miek.nl.		1627	IN	SOA	linode.atoom.net. miek.miek.nl. 1460175190 14400 3600 604800 14400
+miek.nl.		1627	IN	NS	ext.ns.whyscream.net.
+`
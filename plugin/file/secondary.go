@@ -24,7 +24,10 @@ func (z *Zone) TransferIn() error {
 Transfer:
 	for _, tr = range z.TransferFrom {
 		t := new(dns.Transfer)
-		c, err := t.In(m, tr)
+		if z.TsigKey != nil {
+			t.TsigSecret = z.TsigKey.Secrets()
+		}
+		c, err := t.In(z.sign(m), tr)
 		if err != nil {
 			log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, tr, err)
 			Err = err
@@ -55,6 +58,7 @@ Transfer:
 	z.Tree = z1.Tree
 	z.Apex = z1.Apex
 	z.Expired = false
+	z.changes = nil // we don't know what changed, so incremental transfers are no longer possible
 	z.Unlock()
 	log.Infof("Transferred: %s from %s", z.origin, tr)
 	return nil
@@ -65,6 +69,9 @@ Transfer:
 func (z *Zone) shouldTransfer() (bool, error) {
 	c := new(dns.Client)
 	c.Net = "tcp" // do this query over TCP to minimize spoofing
+	if z.TsigKey != nil {
+		c.TsigSecret = z.TsigKey.Secrets()
+	}
 	m := new(dns.Msg)
 	m.SetQuestion(z.origin, dns.TypeSOA)
 
@@ -74,7 +81,7 @@ func (z *Zone) shouldTransfer() (bool, error) {
 Transfer:
 	for _, tr := range z.TransferFrom {
 		Err = nil
-		ret, _, err := c.Exchange(m, tr)
+		ret, _, err := c.Exchange(z.sign(m), tr)
 		if err != nil || ret.Rcode != dns.RcodeSuccess {
 			Err = err
 			continue
@@ -95,6 +102,17 @@ Transfer:
 	return less(z.Apex.SOA.Serial, uint32(serial)), Err
 }
 
+// sign returns m, or when the zone has a TSIG key, a signed copy of m. Sending a message strips
+// the TSIG record again, hence the copy.
+func (z *Zone) sign(m *dns.Msg) *dns.Msg {
+	if z.TsigKey == nil {
+		return m
+	}
+	m = m.Copy()
+	z.TsigKey.Sign(m)
+	return m
+}
+
 // less returns true of a is smaller than b when taking RFC 1982 serial arithmetic into account.
 func less(a, b uint32) bool {
 	if a < b {
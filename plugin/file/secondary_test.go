@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/request"
 
@@ -138,6 +139,24 @@ func TestIsNotify(t *testing.T) {
 	}
 }
 
+func TestIsNotifyTsig(t *testing.T) {
+	z := new(Zone)
+	z.origin = testZone
+	z.TransferFrom = []string{"10.240.0.1:53"}
+	z.TsigKey, _ = tsig.NewKey("transfer.key.", "c2VjcmV0", "")
+
+	state := newRequest(testZone, dns.TypeSOA)
+	state.Req.Opcode = dns.OpcodeNotify
+	if z.isNotify(state) {
+		t.Fatal("Should have been invalid notify, as it is not signed")
+	}
+
+	z.TsigKey.Sign(state.Req)
+	if !z.isNotify(state) {
+		t.Fatal("Should have been valid notify")
+	}
+}
+
 func newRequest(zone string, qtype uint16) request.Request {
 	m := new(dns.Msg)
 	m.SetQuestion("example.com.", dns.TypeA)
@@ -1,13 +1,18 @@
 package file
 
 import (
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cidr"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/plugin/transfer"
 )
@@ -28,6 +33,9 @@ func setup(c *caddy.Controller) error {
 			return nil
 		}
 		f.transfer = t.(*transfer.Transfer) // if found this must be OK.
+		for _, n := range zones.Names {
+			zones.Z[n].transfer = f.transfer
+		}
 		go func() {
 			for _, n := range zones.Names {
 				f.transfer.Notify(n)
@@ -49,6 +57,18 @@ func setup(c *caddy.Controller) error {
 		return nil
 	})
 
+	// Let the server accept dynamic updates and register the keys with it, so it verifies signed updates.
+	for _, n := range zones.Names {
+		if len(zones.Z[n].UpdateFrom) > 0 {
+			dnsserver.GetConfig(c).DynamicUpdates = true
+		}
+		if k := zones.Z[n].UpdateKey; k != nil {
+			if err := dnsserver.GetConfig(c).AddTsigSecret(k.Name, k.Secret); err != nil {
+				return plugin.Error("file", err)
+			}
+		}
+	}
+
 	for _, n := range zones.Names {
 		z := zones.Z[n]
 		c.OnShutdown(z.OnShutdown)
@@ -74,6 +94,12 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 
 	var openErr error
 	reload := 1 * time.Minute
+	journal := DefaultJournalSize
+	var (
+		updateFrom []*net.IPNet
+		updateKey  *tsig.Key
+		persist    bool
+	)
 
 	for c.Next() {
 		// file db.file [zones...]
@@ -113,6 +139,42 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 					return Zones{}, plugin.Error("file", err)
 				}
 				reload = d
+			case "journal":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return Zones{}, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return Zones{}, c.Errf("invalid journal size %q", args[0])
+				}
+				journal = n
+			case "update":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return Zones{}, c.ArgErr()
+				}
+				nets, err := parseNets(args)
+				if err != nil {
+					return Zones{}, c.Err(err.Error())
+				}
+				updateFrom = append(updateFrom, nets...)
+			case "tsig":
+				args := c.RemainingArgs()
+				if len(args) != 2 && len(args) != 3 {
+					return Zones{}, c.ArgErr()
+				}
+				args = append(args, "")
+				key, err := tsig.NewKey(args[0], args[1], args[2])
+				if err != nil {
+					return Zones{}, c.Err(err.Error())
+				}
+				updateKey = key
+			case "persist":
+				if len(c.RemainingArgs()) != 0 {
+					return Zones{}, c.ArgErr()
+				}
+				persist = true
 			case "upstream":
 				// remove soon
 				c.RemainingArgs()
@@ -125,6 +187,10 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 
 	for origin := range z {
 		z[origin].ReloadInterval = reload
+		z[origin].JournalSize = journal
+		z[origin].UpdateFrom = updateFrom
+		z[origin].UpdateKey = updateKey
+		z[origin].Persist = persist
 		z[origin].Upstream = upstream.New()
 	}
 
@@ -138,3 +204,22 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 	}
 	return Zones{Z: z, Names: names}, nil
 }
+
+// parseNets parses the addresses and CIDR ranges in args, "*" means all addresses.
+func parseNets(args []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, a := range args {
+		if a == "*" {
+			_, all4, _ := net.ParseCIDR("0.0.0.0/0")
+			_, all6, _ := net.ParseCIDR("::/0")
+			nets = append(nets, all4, all6)
+			continue
+		}
+		n, err := cidr.Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("illegal CIDR notation %q", a)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -122,3 +122,61 @@ func TestParseReload(t *testing.T) {
 		}
 	}
 }
+
+func TestParseUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		nets      int
+		key       bool
+		persist   bool
+	}{
+		{`file ` + name + ` example.org.`, false, 0, false, false},
+		{`file ` + name + ` example.org. {
+			update 10.0.0.1 10.1.0.0/16 ::1
+		}`, false, 3, false, false},
+		{`file ` + name + ` example.org. {
+			update *
+			tsig update.key. c2VjcmV0 hmac-sha512
+			persist
+		}`, false, 2, true, true},
+		{`file ` + name + ` example.org. {
+			update
+		}`, true, 0, false, false},
+		{`file ` + name + ` example.org. {
+			update 10.0.0.300
+		}`, true, 0, false, false},
+		{`file ` + name + ` example.org. {
+			tsig update.key.
+		}`, true, 0, false, false},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		z, err := fileParse(c)
+		if err == nil && test.shouldErr {
+			t.Fatalf("Test %d expected errors, but got no error", i)
+		} else if err != nil && !test.shouldErr {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		zone := z.Z["example.org."]
+		if x := len(zone.UpdateFrom); x != test.nets {
+			t.Errorf("Test %d expected %d update networks, got %d", i, test.nets, x)
+		}
+		if x := zone.UpdateKey != nil; x != test.key {
+			t.Errorf("Test %d expected key to be %t, got %t", i, test.key, x)
+		}
+		if zone.Persist != test.persist {
+			t.Errorf("Test %d expected persist to be %t, got %t", i, test.persist, zone.Persist)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// rrsets holds the records of a zone version keyed by owner name and type.
+type rrsets map[string]map[uint16][]dns.RR
+
+func newRRsets(rrs []dns.RR) rrsets {
+	s := rrsets{}
+	for _, rr := range rrs {
+		s.add(rr)
+	}
+	return s
+}
+
+func (s rrsets) get(name string, qtype uint16) []dns.RR { return s[name][qtype] }
+
+func (s rrsets) exists(name string) bool { return len(s[name]) > 0 }
+
+// add adds rr to s, replacing a record with the same data. It returns true if s was changed.
+func (s rrsets) add(rr dns.RR) bool {
+	h := rr.Header()
+	if s[h.Name] == nil {
+		s[h.Name] = make(map[uint16][]dns.RR)
+	}
+	rrs := s[h.Name][h.Rrtype]
+	for i := range rrs {
+		if dns.IsDuplicate(rrs[i], rr) {
+			if rrs[i].Header().Ttl == h.Ttl {
+				return false
+			}
+			rrs[i] = rr
+			return true
+		}
+	}
+	s[h.Name][h.Rrtype] = append(rrs, rr)
+	return true
+}
+
+// remove removes the record with the same data as rr from s. It returns true if s was changed.
+func (s rrsets) remove(rr dns.RR) bool {
+	h := rr.Header()
+	rrs := s[h.Name][h.Rrtype]
+	for i := range rrs {
+		if dns.IsDuplicate(rrs[i], rr) {
+			s[h.Name][h.Rrtype] = append(rrs[:i:i], rrs[i+1:]...)
+			s.cleanup(h.Name, h.Rrtype)
+			return true
+		}
+	}
+	return false
+}
+
+// removeRRset removes the records of type qtype from name. It returns true if s was changed.
+func (s rrsets) removeRRset(name string, qtype uint16) bool {
+	if len(s[name][qtype]) == 0 {
+		return false
+	}
+	delete(s[name], qtype)
+	s.cleanup(name, qtype)
+	return true
+}
+
+func (s rrsets) cleanup(name string, qtype uint16) {
+	if len(s[name][qtype]) == 0 {
+		delete(s[name], qtype)
+	}
+	if len(s[name]) == 0 {
+		delete(s, name)
+	}
+}
+
+func (s rrsets) all() []dns.RR {
+	rrs := []dns.RR{}
+	for _, types := range s {
+		for _, set := range types {
+			rrs = append(rrs, set...)
+		}
+	}
+	return rrs
+}
+
+// serveUpdate handles a dynamic update for zone z.
+func (z *Zone) serveUpdate(state request.Request) (int, error) {
+	w, r := state.W, state.Req
+	if !z.updateAllowed(state) {
+		log.Infof("Refusing dynamic update from %s for %s", state.IP(), z.origin)
+		return dns.RcodeRefused, nil
+	}
+	if z.UpdateKey != nil {
+		if err := z.UpdateKey.Verify(w, r); err != nil {
+			log.Warningf("Dynamic update from %s for %s failed TSIG verification: %s", state.IP(), z.origin, err)
+			tsig.Refuse(w, r, err)
+			return dns.RcodeSuccess, nil
+		}
+	}
+
+	rcode, changed := dns.RcodeFormatError, false
+	q := r.Question[0]
+	switch {
+	case len(r.Question) != 1 || q.Qtype != dns.TypeSOA || q.Qclass != dns.ClassINET:
+	case strings.ToLower(q.Name) != z.origin:
+		rcode = dns.RcodeNotAuth
+	default:
+		rcode, changed = z.applyUpdate(r)
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(r, rcode)
+	if z.UpdateKey != nil {
+		z.UpdateKey.Sign(m)
+	}
+	w.WriteMsg(m)
+
+	if !changed {
+		log.Infof("Dynamic update from %s for %s: %s, no changes", state.IP(), z.origin, dns.RcodeToString[rcode])
+		return dns.RcodeSuccess, nil
+	}
+
+	serial := z.SOASerialIfDefined()
+	log.Infof("Dynamic update from %s for %s: zone updated to %d SOA serial", state.IP(), z.origin, serial)
+	if z.Persist {
+		if err := z.persist(); err != nil {
+			log.Errorf("Failed to write zone %q to %q: %s", z.origin, z.File(), err)
+		}
+	}
+	go func() {
+		if err := z.transfer.Notify(z.origin); err != nil {
+			log.Warningf("Failed sending notifies: %s", err)
+		}
+	}()
+	return dns.RcodeSuccess, nil
+}
+
+// persist writes the zone to its file. The file is replaced atomically, so a concurrent reload never
+// sees a partially written zone.
+func (z *Zone) persist() error {
+	z.RLock()
+	defer z.RUnlock()
+
+	f, err := ioutil.TempFile(filepath.Dir(z.file), filepath.Base(z.file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // noop once renamed
+
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "; zone %s written after a dynamic update\n", z.origin)
+	fmt.Fprintln(bw, z.Apex.SOA.String())
+	for _, rr := range records(z.Apex, z.Tree) {
+		fmt.Fprintln(bw, rr.String())
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), z.file)
+}
+
+// updateAllowed returns true if the client in state may send dynamic updates to z.
+func (z *Zone) updateAllowed(state request.Request) bool {
+	ip := net.ParseIP(state.IP())
+	for _, n := range z.UpdateFrom {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyUpdate applies the dynamic update in r to z, as described in RFC 2136, and returns the rcode
+// for the reply and whether the zone was changed. The zone section has been checked by the caller.
+func (z *Zone) applyUpdate(r *dns.Msg) (int, bool) {
+	z.Lock()
+	defer z.Unlock()
+
+	if z.Apex.SOA == nil {
+		return dns.RcodeServerFailure, false
+	}
+
+	sets := newRRsets(records(z.Apex, z.Tree))
+	if rcode := z.prerequisites(sets, r.Answer); rcode != dns.RcodeSuccess {
+		return rcode, false
+	}
+	if rcode := z.prescan(r.Ns); rcode != dns.RcodeSuccess {
+		return rcode, false
+	}
+
+	soa := dns.Copy(z.Apex.SOA).(*dns.SOA)
+	soaChanged, changed := false, false
+	for _, rr := range r.Ns {
+		if s, ok := rr.(*dns.SOA); ok && rr.Header().Class == dns.ClassINET {
+			// Only replace the SOA when the serial increases.
+			if less(soa.Serial, s.Serial) {
+				soa = dns.Copy(s).(*dns.SOA)
+				soaChanged, changed = true, true
+			}
+			continue
+		}
+		if z.updateRR(sets, rr) {
+			changed = true
+		}
+	}
+	if !changed {
+		return dns.RcodeSuccess, false
+	}
+	if !soaChanged {
+		soa.Serial++
+	}
+
+	z1 := z.CopyWithoutApex()
+	z1.Insert(soa)
+	for _, rr := range sets.all() {
+		z1.Insert(rr)
+	}
+	z.journal(z1.Apex, z1.Tree)
+	z.Apex = z1.Apex
+	z.Tree = z1.Tree
+	return dns.RcodeSuccess, true
+}
+
+// prerequisites checks the prerequisite section of an update, see section 3.2 of RFC 2136.
+func (z *Zone) prerequisites(sets rrsets, prereqs []dns.RR) int {
+	used := rrsets{}
+	for _, rr := range prereqs {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(z.origin, name) {
+			return dns.RcodeNotZone
+		}
+
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if !sets.exists(name) && name != z.origin {
+					return dns.RcodeNameError
+				}
+				continue
+			}
+			if len(sets.get(name, h.Rrtype)) == 0 && !(name == z.origin && h.Rrtype == dns.TypeSOA) {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if sets.exists(name) || name == z.origin {
+					return dns.RcodeYXDomain
+				}
+				continue
+			}
+			if len(sets.get(name, h.Rrtype)) > 0 || (name == z.origin && h.Rrtype == dns.TypeSOA) {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			rr = dns.Copy(rr)
+			rr.Header().Name = name
+			used.add(rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// RRsets that must exist with exactly these records, TTLs are not compared.
+	for name, types := range used {
+		for qtype, want := range types {
+			have := sets.get(name, qtype)
+			if len(have) != len(want) {
+				return dns.RcodeNXRrset
+			}
+			for _, w := range want {
+				if !containsRR(have, w) {
+					return dns.RcodeNXRrset
+				}
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// prescan checks the update section of an update, see section 3.4.1 of RFC 2136.
+func (z *Zone) prescan(updates []dns.RR) int {
+	for _, rr := range updates {
+		h := rr.Header()
+		if !dns.IsSubDomain(z.origin, strings.ToLower(h.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassINET:
+			if metaType(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if h.Ttl != 0 || h.Rdlength != 0 || (metaType(h.Rrtype) && h.Rrtype != dns.TypeANY) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if h.Ttl != 0 || metaType(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// updateRR applies a single update (other than adding a SOA record) to sets, see section 3.4.2 of
+// RFC 2136. It returns true if sets was changed.
+func (z *Zone) updateRR(sets rrsets, rr dns.RR) bool {
+	rr = dns.Copy(rr)
+	h := rr.Header()
+	h.Name = strings.ToLower(h.Name)
+	apex := h.Name == z.origin
+
+	switch h.Class {
+	case dns.ClassINET:
+		cnames := len(sets.get(h.Name, dns.TypeCNAME)) > 0
+		if h.Rrtype == dns.TypeCNAME {
+			// A CNAME can't coexist with other data and replaces an existing CNAME.
+			if sets.exists(h.Name) && !cnames {
+				return false
+			}
+			if cnames && !containsRR(sets.get(h.Name, dns.TypeCNAME), rr) {
+				sets.removeRRset(h.Name, dns.TypeCNAME)
+			}
+			return sets.add(rr)
+		}
+		if cnames {
+			return false
+		}
+		return sets.add(rr)
+
+	case dns.ClassANY:
+		if h.Rrtype == dns.TypeANY {
+			changed := false
+			for qtype := range sets[h.Name] {
+				// The apex SOA and NS records can't be removed this way.
+				if apex && qtype == dns.TypeNS {
+					continue
+				}
+				if sets.removeRRset(h.Name, qtype) {
+					changed = true
+				}
+			}
+			return changed
+		}
+		if apex && (h.Rrtype == dns.TypeSOA || h.Rrtype == dns.TypeNS) {
+			return false
+		}
+		return sets.removeRRset(h.Name, h.Rrtype)
+
+	case dns.ClassNONE:
+		if apex && h.Rrtype == dns.TypeSOA {
+			return false
+		}
+		// Never remove the last NS record of the zone.
+		if apex && h.Rrtype == dns.TypeNS && len(sets.get(h.Name, dns.TypeNS)) <= 1 {
+			return false
+		}
+		h.Class = dns.ClassINET
+		return sets.remove(rr)
+	}
+	return false
+}
+
+func containsRR(rrs []dns.RR, rr dns.RR) bool {
+	for _, r := range rrs {
+		if dns.IsDuplicate(r, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// metaType returns true for types that can't be stored in a zone.
+func metaType(t uint16) bool {
+	switch t {
+	case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package file
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+const updateZone = `$ORIGIN example.org.
+@	3600 IN	SOA sns.dns.icann.org. noc.dns.icann.org. 10 7200 3600 1209600 3600
+	3600 IN	NS  a.iana-servers.net.
+a	3600 IN	A   127.0.0.1
+a	3600 IN	A   127.0.0.2
+b	3600 IN	TXT "b"
+c	3600 IN	CNAME a
+`
+
+func newUpdateZone(t *testing.T) *Zone {
+	z, err := Parse(strings.NewReader(updateZone), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Failed to parse zone: %s", err)
+	}
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	z.UpdateFrom = []*net.IPNet{all}
+	z.JournalSize = DefaultJournalSize
+	return z
+}
+
+func newUpdate() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	return m
+}
+
+func TestUpdatePrerequisites(t *testing.T) {
+	tests := []struct {
+		prereq func(m *dns.Msg)
+		rcode  int
+	}{
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("a.example.org. 0 IN A 127.0.0.1")}) }, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("x.example.org. 0 IN A 127.0.0.1")}) }, dns.RcodeNameError},
+		{func(m *dns.Msg) { m.NameNotUsed([]dns.RR{test.A("x.example.org. 0 IN A 127.0.0.1")}) }, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.NameNotUsed([]dns.RR{test.A("a.example.org. 0 IN A 127.0.0.1")}) }, dns.RcodeYXDomain},
+		{func(m *dns.Msg) { m.RRsetUsed([]dns.RR{test.TXT(`b.example.org. 0 IN TXT "b"`)}) }, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.RRsetUsed([]dns.RR{test.A("b.example.org. 0 IN A 127.0.0.1")}) }, dns.RcodeNXRrset},
+		{func(m *dns.Msg) { m.RRsetNotUsed([]dns.RR{test.A("b.example.org. 0 IN A 127.0.0.1")}) }, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.RRsetNotUsed([]dns.RR{test.TXT(`b.example.org. 0 IN TXT "b"`)}) }, dns.RcodeYXRrset},
+		{func(m *dns.Msg) {
+			m.Used([]dns.RR{test.A("a.example.org. 0 IN A 127.0.0.2"), test.A("a.example.org. 0 IN A 127.0.0.1")})
+		}, dns.RcodeSuccess},
+		{func(m *dns.Msg) { m.Used([]dns.RR{test.A("a.example.org. 0 IN A 127.0.0.1")}) }, dns.RcodeNXRrset},
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("a.example.net. 0 IN A 127.0.0.1")}) }, dns.RcodeNotZone},
+		{func(m *dns.Msg) { m.Used([]dns.RR{test.A("a.example.org. 10 IN A 127.0.0.1")}) }, dns.RcodeFormatError},
+	}
+
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+		m := newUpdate()
+		tc.prereq(m)
+		m.Insert([]dns.RR{test.A("d.example.org. 3600 IN A 127.0.0.4")})
+
+		rcode, changed := z.applyUpdate(m)
+		if rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+		if changed != (tc.rcode == dns.RcodeSuccess) {
+			t.Errorf("Test %d: expected zone changed to be %t", i, !changed)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		update func(m *dns.Msg)
+		qname  string
+		qtype  uint16
+		answer int
+		serial uint32
+	}{
+		// add a record
+		{func(m *dns.Msg) { m.Insert([]dns.RR{test.A("d.example.org. 3600 IN A 127.0.0.4")}) }, "d.example.org.", dns.TypeA, 1, 11},
+		// add a duplicate record, nothing changes
+		{func(m *dns.Msg) { m.Insert([]dns.RR{test.A("a.example.org. 3600 IN A 127.0.0.1")}) }, "a.example.org.", dns.TypeA, 2, 10},
+		// delete an RRset
+		{func(m *dns.Msg) { m.RemoveRRset([]dns.RR{test.A("a.example.org. 0 IN A 127.0.0.1")}) }, "a.example.org.", dns.TypeA, 0, 11},
+		// delete a single record
+		{func(m *dns.Msg) { m.Remove([]dns.RR{test.A("a.example.org. 0 IN A 127.0.0.1")}) }, "a.example.org.", dns.TypeA, 1, 11},
+		// delete a name
+		{func(m *dns.Msg) { m.RemoveName([]dns.RR{test.TXT(`b.example.org. 0 IN TXT "b"`)}) }, "b.example.org.", dns.TypeTXT, 0, 11},
+		// adding data next to a CNAME is ignored
+		{func(m *dns.Msg) { m.Insert([]dns.RR{test.A("c.example.org. 3600 IN A 127.0.0.4")}) }, "c.example.org.", dns.TypeA, 0, 10},
+		// the last NS record can't be deleted
+		{func(m *dns.Msg) { m.Remove([]dns.RR{test.NS("example.org. 0 IN NS a.iana-servers.net.")}) }, "example.org.", dns.TypeNS, 1, 10},
+		// a SOA with a higher serial replaces the current one
+		{func(m *dns.Msg) {
+			m.Insert([]dns.RR{test.SOA("example.org. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 20 7200 3600 1209600 3600")})
+		}, "example.org.", dns.TypeSOA, 1, 20},
+		// a SOA with a lower serial is ignored
+		{func(m *dns.Msg) {
+			m.Insert([]dns.RR{test.SOA("example.org. 3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 5 7200 3600 1209600 3600")})
+		}, "example.org.", dns.TypeSOA, 1, 10},
+	}
+
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+		m := newUpdate()
+		tc.update(m)
+
+		if rcode, _ := z.applyUpdate(m); rcode != dns.RcodeSuccess {
+			t.Fatalf("Test %d: expected success, got %s", i, dns.RcodeToString[rcode])
+		}
+		if serial := z.Apex.SOA.Serial; serial != tc.serial {
+			t.Errorf("Test %d: expected serial %d, got %d", i, tc.serial, serial)
+		}
+
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, tc.qtype)
+		state := request.Request{W: &test.ResponseWriter{}, Req: r}
+		answer, _, _, _ := z.Lookup(context.TODO(), state, tc.qname)
+		answer = rrsOf(answer, tc.qname, tc.qtype)
+		if len(answer) != tc.answer {
+			t.Errorf("Test %d: expected %d answers, got %d: %v", i, tc.answer, len(answer), answer)
+		}
+	}
+}
+
+func TestUpdateJournal(t *testing.T) {
+	z := newUpdateZone(t)
+	m := newUpdate()
+	m.Insert([]dns.RR{test.A("d.example.org. 3600 IN A 127.0.0.4")})
+	z.applyUpdate(m)
+
+	if ixfr := z.ixfr(10); len(ixfr) != 4 {
+		t.Errorf("Expected the update to be journaled, got %v", ixfr)
+	}
+}
+
+func TestServeUpdate(t *testing.T) {
+	z := newUpdateZone(t)
+	z.UpdateFrom = nil
+	m := newUpdate()
+	m.Insert([]dns.RR{test.A("d.example.org. 3600 IN A 127.0.0.4")})
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	state := request.Request{W: rec, Req: m}
+	if rcode, _ := z.serveUpdate(state); rcode != dns.RcodeRefused {
+		t.Errorf("Expected update to be refused, got %s", dns.RcodeToString[rcode])
+	}
+
+	_, n, _ := net.ParseCIDR("10.240.0.0/24") // IP from test.ResponseWriter
+	z.UpdateFrom = []*net.IPNet{n}
+	z.UpdateKey, _ = tsig.NewKey("update.key.", "c2VjcmV0", "")
+	z.serveUpdate(state)
+	if rec.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected unsigned update to be refused, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+
+	m.SetTsig("update.key.", dns.HmacSHA256, tsig.Fudge, 0)
+	z.serveUpdate(state)
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected update to succeed, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if rec.Msg.IsTsig() == nil {
+		t.Error("Expected signed reply")
+	}
+	if serial := z.Apex.SOA.Serial; serial != 11 {
+		t.Errorf("Expected serial %d, got %d", 11, serial)
+	}
+}
+
+// rrsOf returns the records in rrs with owner name and type qtype.
+func rrsOf(rrs []dns.RR, name string, qtype uint16) []dns.RR {
+	ret := []dns.RR{}
+	for _, rr := range rrs {
+		if rr.Header().Name == name && rr.Header().Rrtype == qtype {
+			ret = append(ret, rr)
+		}
+	}
+	return ret
+}
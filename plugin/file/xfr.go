@@ -16,8 +16,9 @@ func (f File) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
 	return z.Transfer(serial)
 }
 
-// Transfer transfers a zone with serial in the returned channel and implements IXFR fallback, by just
-// sending a single SOA record.
+// Transfer transfers a zone with serial in the returned channel. If serial is the current serial only
+// the SOA record is sent, if the journal holds the changes since serial an incremental transfer is
+// done, otherwise the entire zone is sent.
 func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 	// get soa and apex
 	apex, err := z.ApexIfDefined()
@@ -25,6 +26,11 @@ func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 		return nil, err
 	}
 
+	var ixfr [][]dns.RR
+	if serial != 0 {
+		ixfr = z.ixfr(serial)
+	}
+
 	ch := make(chan []dns.RR)
 	go func() {
 		if serial != 0 && apex[0].(*dns.SOA).Serial == serial { // ixfr fallback, only send SOA
@@ -34,6 +40,15 @@ func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 			return
 		}
 
+		if ixfr != nil {
+			for _, rrs := range ixfr {
+				ch <- rrs
+			}
+
+			close(ch)
+			return
+		}
+
 		ch <- apex
 		z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { ch <- e.All(); return nil })
 		ch <- []dns.RR{apex[0]}
@@ -2,13 +2,16 @@ package file
 
 import (
 	"fmt"
+	"net"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/coredns/coredns/plugin/file/tree"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
+	"github.com/coredns/coredns/plugin/transfer"
 
 	"github.com/miekg/dns"
 )
@@ -26,10 +29,19 @@ type Zone struct {
 
 	StartupOnce  sync.Once
 	TransferFrom []string
+	TsigKey      *tsig.Key // if not nil, transfers are signed and notifies must be signed with this key
 
 	ReloadInterval time.Duration
 	reloadShutdown chan bool
 
+	JournalSize int       // Number of changes kept to answer incremental transfers, zero disables the journal.
+	changes     []*change // Changes between consecutive versions of the zone, oldest first.
+
+	UpdateFrom []*net.IPNet       // Networks allowed to send dynamic updates, if empty updates are refused.
+	UpdateKey  *tsig.Key          // If not nil, dynamic updates must be signed with this key.
+	Persist    bool               // Write the zone back to its file after a dynamic update.
+	transfer   *transfer.Transfer // Used to send notifies after a dynamic update.
+
 	Upstream *upstream.Upstream // Upstream for looking up external names during the resolution process.
 }
 
@@ -56,6 +68,7 @@ func NewZone(name, file string) *Zone {
 func (z *Zone) Copy() *Zone {
 	z1 := NewZone(z.origin, z.file)
 	z1.TransferFrom = z.TransferFrom
+	z1.TsigKey = z.TsigKey
 	z1.Expired = z.Expired
 
 	z1.Apex = z.Apex
@@ -66,6 +79,7 @@ func (z *Zone) Copy() *Zone {
 func (z *Zone) CopyWithoutApex() *Zone {
 	z1 := NewZone(z.origin, z.file)
 	z1.TransferFrom = z.TransferFrom
+	z1.TsigKey = z.TsigKey
 	z1.Expired = z.Expired
 
 	return z1
@@ -0,0 +1,68 @@
+package forward
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// qnameCase keeps track of whether an upstream echoes the case of the query name, for the randomization
+// of the case of query names (0x20, draft-vixie-dnsext-dns0x20). Upstreams that don't are left alone.
+type qnameCase struct {
+	mismatches uint32 // subsequent replies with another case than we sent
+	disabled   uint32
+}
+
+// enabled returns true when the case of query names to the upstream should be randomized.
+func (q *qnameCase) enabled() bool { return atomic.LoadUint32(&q.disabled) == 0 }
+
+// randomizeCase returns name with the case of each letter chosen at random.
+func randomizeCase(name string) string {
+	b := []byte(name)
+	bits := make([]byte, (len(b)+7)/8)
+	rand.Read(bits)
+	for i, c := range b {
+		if c|0x20 < 'a' || c|0x20 > 'z' {
+			continue
+		}
+		if bits[i/8]&(1<<(i%8)) != 0 {
+			b[i] = c ^ 0x20
+		} else {
+			b[i] = c
+		}
+	}
+	return string(b)
+}
+
+// check returns true when the reply m has the query name sent in the same case. After
+// caseMismatchMax subsequent replies in another case we assume the upstream doesn't preserve case,
+// and stop randomizing.
+func (q *qnameCase) check(addr, sent string, m *dns.Msg) bool {
+	if len(m.Question) == 0 || m.Question[0].Name == sent {
+		atomic.StoreUint32(&q.mismatches, 0)
+		return true
+	}
+	CaseMismatchCount.WithLabelValues(addr).Add(1)
+	if atomic.AddUint32(&q.mismatches, 1) == caseMismatchMax && atomic.CompareAndSwapUint32(&q.disabled, 0, 1) {
+		log.Warningf("Upstream %s doesn't preserve the case of query names, no longer randomizing it", addr)
+	}
+	return false
+}
+
+// restoreCase gives the names in m that are the query name sent, the case of the query name of the client.
+func restoreCase(m *dns.Msg, sent, name string) {
+	if len(m.Question) > 0 && strings.EqualFold(m.Question[0].Name, sent) {
+		m.Question[0].Name = name
+	}
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if h := rr.Header(); h.Name == sent {
+				h.Name = name
+			}
+		}
+	}
+}
+
+const caseMismatchMax = 5
@@ -0,0 +1,166 @@
+package forward
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestRandomizeCase(t *testing.T) {
+	const name = "www.Example-1.org."
+	changed := false
+	for i := 0; i < 10; i++ {
+		x := randomizeCase(name)
+		if !strings.EqualFold(x, name) {
+			t.Fatalf("Expected %s in another case, got %s", name, x)
+		}
+		changed = changed || x != name
+	}
+	if !changed {
+		t.Errorf("Expected the case of %s to be randomized", name)
+	}
+}
+
+func TestCaseRandomization(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		seen = append(seen, r.Question[0].Name)
+		mu.Unlock()
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.1"))
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\nrandomize_case\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	const name = "www.Example-of-a-long-name.org."
+	for i := 0; i < 5; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Expected a reply, got %s", err)
+		}
+		if x := rec.Msg.Question[0].Name; x != name {
+			t.Errorf("Expected the question of the client, got %s", x)
+		}
+		if x := rec.Msg.Answer[0].Header().Name; x != name {
+			t.Errorf("Expected the answer in the case of the client, got %s", x)
+		}
+		if x := m.Question[0].Name; x != name {
+			t.Errorf("Expected the request of the client to be untouched, got %s", x)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	randomized := false
+	for _, x := range seen {
+		randomized = randomized || x != name
+	}
+	if !randomized {
+		t.Errorf("Expected the upstream to see randomized names, got %v", seen)
+	}
+}
+
+func TestCaseRandomizationNotPreserved(t *testing.T) {
+	// This upstream lowercases the query name.
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Question[0].Name = strings.ToLower(ret.Question[0].Name)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	p := NewProxy(s.Addr, transport.DNS)
+	p.start(hcInterval)
+	defer p.stop()
+
+	opts := options{randomizeCase: true}
+	for i := 0; i < caseMismatchMax; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("www.Example-of-a-long-name.org.", dns.TypeA)
+		req := request.Request{Req: m, W: &test.ResponseWriter{}}
+		if _, err := p.Connect(context.Background(), req, opts); err != ErrCaseMismatch {
+			t.Fatalf("Test %d: expected a case mismatch, got %v", i, err)
+		}
+	}
+	if p.qcase.enabled() {
+		t.Fatalf("Expected the randomization to be disabled")
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	req := request.Request{Req: m, W: &test.ResponseWriter{}}
+	if _, err := p.Connect(context.Background(), req, opts); err != nil {
+		t.Errorf("Expected a reply, got %s", err)
+	}
+}
+
+func TestCaseRandomizationCookie(t *testing.T) {
+	const server = "1112131415161718"
+
+	// This upstream wants its server cookie, the first query gets a BADCOOKIE and is retried.
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		cookie := edns.Cookie(r)
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		if cookie[16:] != server {
+			ret.Rcode = dns.RcodeBadCookie
+		} else {
+			ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.1"))
+		}
+		edns.SetCookie(ret, cookie[:16]+server)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\ncookie\nrandomize_case\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	const name = "www.Example-of-a-long-name.org."
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypeA)
+	m.SetEdns0(4096, false)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected a reply, got %s", err)
+	}
+	if rec.Msg.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected an answer, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+	if x := rec.Msg.Question[0].Name; x != name {
+		t.Errorf("Expected the question of the client, got %s", x)
+	}
+	if x := rec.Msg.Answer[0].Header().Name; x != name {
+		t.Errorf("Expected the answer in the case of the client, got %s", x)
+	}
+}
@@ -0,0 +1,91 @@
+package forward
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// coalesced is the outcome of a query that is shared with identical queries that came in while it was in flight.
+type coalesced struct {
+	msg   *dns.Msg // the reply written, nil if none was, as for a SERVFAIL of our own
+	rcode int
+}
+
+// serveCoalesced serves the query in state, unless an identical query is in flight: then it waits for that
+// query and writes its reply, with the ID of our request.
+func (f *Forward) serveCoalesced(ctx context.Context, w dns.ResponseWriter, state request.Request) (int, error) {
+	leader := false
+	v, err := f.inflight.Do(coalesceKey(state), func() (interface{}, error) {
+		leader = true
+		cw := &coalesceWriter{ResponseWriter: w}
+		rcode, err := f.serve(ctx, cw, state)
+		return &coalesced{msg: cw.msg, rcode: rcode}, err
+	})
+	c := v.(*coalesced)
+	if leader {
+		return c.rcode, err
+	}
+
+	// No reply was written, so we fail like the query in flight, and the server writes the error.
+	if c.msg == nil {
+		CoalescedCount.Add(1)
+		return c.rcode, err
+	}
+	// Guard against hash collisions; the question must be ours.
+	if len(c.msg.Question) != 1 || c.msg.Question[0] != state.Req.Question[0] {
+		return f.serve(ctx, w, state)
+	}
+
+	CoalescedCount.Add(1)
+	ret := c.msg.Copy()
+	ret.Id = state.Req.Id
+	w.WriteMsg(ret)
+	return c.rcode, err
+}
+
+// coalesceKey returns the key of the query in state: identical queries get the same reply from the upstreams.
+// These have the same name, in the same case, type and class, the same RD, CD and DO bits, come in over the
+// same transport, and have the same EDNS Client Subnet, if any.
+func coalesceKey(state request.Request) uint64 {
+	var flags byte
+	if state.Req.RecursionDesired {
+		flags |= 1 << 0
+	}
+	if state.Req.CheckingDisabled {
+		flags |= 1 << 1
+	}
+	if state.Do() {
+		flags |= 1 << 2
+	}
+	if state.Proto() == "tcp" {
+		flags |= 1 << 3
+	}
+
+	h := fnv.New64()
+	qtype, qclass := state.QType(), state.QClass()
+	h.Write([]byte{byte(qtype >> 8), byte(qtype), byte(qclass >> 8), byte(qclass), flags})
+	if s := edns.Subnet(state.Req); s != nil {
+		h.Write([]byte{byte(s.Family >> 8), byte(s.Family), s.SourceNetmask})
+		h.Write(s.Address)
+	}
+	h.Write([]byte(state.QName()))
+	return h.Sum64()
+}
+
+// coalesceWriter keeps a copy of the reply, to hand to the identical queries.
+type coalesceWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *coalesceWriter) WriteMsg(m *dns.Msg) error {
+	// Copy before writing, as writers further down may change m.
+	w.msg = m.Copy()
+	return w.ResponseWriter.WriteMsg(m)
+}
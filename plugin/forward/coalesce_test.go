@@ -0,0 +1,116 @@
+package forward
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestCoalesce(t *testing.T) {
+	// Other tests lower the timeouts, the held queries must not time out here.
+	defer func(r, d time.Duration) { readTimeout, defaultTimeout = r, d }(readTimeout, defaultTimeout)
+	readTimeout, defaultTimeout = 2*time.Second, 5*time.Second
+
+	var queries uint32
+	release := make(chan struct{})
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddUint32(&queries, 1)
+		<-release
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.1"))
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\ncoalesce\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := new(dns.Msg)
+			m.SetQuestion("example.org.", dns.TypeA)
+			m.Id = uint16(i + 1)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+				t.Errorf("Query %d: expected a reply, got %s", i, err)
+				return
+			}
+			if rec.Msg.Id != m.Id {
+				t.Errorf("Query %d: expected ID %d, got %d", i, m.Id, rec.Msg.Id)
+			}
+			if len(rec.Msg.Answer) != 1 {
+				t.Errorf("Query %d: expected an answer, got %v", i, rec.Msg)
+			}
+		}(i)
+	}
+
+	// Give the queries time to come in, and to find the first one in flight.
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if x := atomic.LoadUint32(&queries); x != 1 {
+		t.Errorf("Expected 1 upstream query, got %d", x)
+	}
+
+	// Another type is another query.
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeAAAA)
+	if _, err := f.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+		t.Fatalf("Expected a reply, got %s", err)
+	}
+	if x := atomic.LoadUint32(&queries); x != 2 {
+		t.Errorf("Expected 2 upstream queries, got %d", x)
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	query := func(name string, qtype uint16, do, cd bool) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		m.CheckingDisabled = cd
+		if do {
+			m.SetEdns0(4096, true)
+		}
+		return m
+	}
+	key := func(m *dns.Msg, w dns.ResponseWriter) uint64 {
+		return coalesceKey(request.Request{W: w, Req: m})
+	}
+
+	udp, tcp := &test.ResponseWriter{}, &test.ResponseWriter{TCP: true}
+	base := key(query("example.org.", dns.TypeA, false, false), udp)
+	if x := key(query("example.org.", dns.TypeA, false, false), udp); x != base {
+		t.Errorf("Expected identical queries to have the same key")
+	}
+	for i, k := range []uint64{
+		key(query("Example.org.", dns.TypeA, false, false), udp),
+		key(query("example.org.", dns.TypeAAAA, false, false), udp),
+		key(query("example.org.", dns.TypeA, true, false), udp),
+		key(query("example.org.", dns.TypeA, false, true), udp),
+		key(query("example.org.", dns.TypeA, false, false), tcp),
+	} {
+		if k == base {
+			t.Errorf("Test %d: expected another key", i)
+		}
+	}
+}
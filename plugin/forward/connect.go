@@ -75,6 +75,79 @@ func (t *Transport) Dial(proto string) (*persistConn, bool, error) {
 func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options) (*dns.Msg, error) {
 	start := time.Now()
 
+	// Only add a cookie when the client uses EDNS0, otherwise we'd change what the client asked for.
+	cookie := opts.cookie && state.Req.IsEdns0() != nil
+	randomize := opts.randomizeCase && len(state.Req.Question) > 0 && p.qcase.enabled()
+	name, sent := "", ""
+	if cookie || randomize {
+		req := state.Req.Copy()
+		if cookie {
+			p.cookie.set(req)
+		}
+		if randomize {
+			name = req.Question[0].Name
+			sent = randomizeCase(name)
+			req.Question[0].Name = sent
+		}
+		state = request.Request{W: state.W, Req: req}
+	}
+
+	ret, err := p.send(ctx, state, opts)
+	if err != nil {
+		// A query we cancelled, like the losers of a hedged query, is accounted for by the caller.
+		if err != ErrCachedClosed && ctx.Err() == nil {
+			p.observe(rttPenalty)
+		}
+		return ret, err
+	}
+
+	if cookie {
+		if !p.cookie.update(ret) {
+			return nil, ErrBadCookie
+		}
+		// We have learned the server cookie now, retry once with it.
+		if ret.Rcode == dns.RcodeBadCookie {
+			p.cookie.set(state.Req)
+			if ret, err = p.send(ctx, state, opts); err != nil {
+				return ret, err
+			}
+			if !p.cookie.update(ret) {
+				return nil, ErrBadCookie
+			}
+		}
+	}
+
+	// Check the final reply, which is the retried one after a BADCOOKIE.
+	if randomize {
+		if !p.qcase.check(p.addr, sent, ret) {
+			return nil, ErrCaseMismatch
+		}
+		restoreCase(ret, sent, name)
+	}
+
+	rc, ok := dns.RcodeToString[ret.Rcode]
+	if !ok {
+		rc = strconv.Itoa(ret.Rcode)
+	}
+
+	RequestCount.WithLabelValues(p.addr).Add(1)
+	RcodeCount.WithLabelValues(rc, p.addr).Add(1)
+	RequestDuration.WithLabelValues(p.addr, rc).Observe(time.Since(start).Seconds())
+	p.observe(time.Since(start))
+
+	return ret, nil
+}
+
+// send sends the request to the upstream, using the exchanger if there is one.
+func (p *Proxy) send(ctx context.Context, state request.Request, opts options) (*dns.Msg, error) {
+	if p.exchanger != nil {
+		return p.exchanger.Exchange(ctx, state.Req)
+	}
+	return p.exchange(ctx, state, opts)
+}
+
+// exchange sends the request over UDP, TCP or TLS using the connection cache in p.transport.
+func (p *Proxy) exchange(ctx context.Context, state request.Request, opts options) (*dns.Msg, error) {
 	proto := ""
 	switch {
 	case opts.forceTCP: // TCP flag has precedence over UDP flag
@@ -96,8 +169,12 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 		pc.c.UDPSize = 512
 	}
 
+	// Close the connection when the query is cancelled, e.g. because another upstream answered first.
+	stop := context.AfterFunc(ctx, func() { pc.c.Close() })
+
 	pc.c.SetWriteDeadline(time.Now().Add(maxTimeout))
 	if err := pc.c.WriteMsg(state.Req); err != nil {
+		stop()
 		pc.c.Close() // not giving it back
 		if err == io.EOF && cached {
 			return nil, ErrCachedClosed
@@ -110,6 +187,7 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 	for {
 		ret, err = pc.c.ReadMsg()
 		if err != nil {
+			stop()
 			pc.c.Close() // not giving it back
 			if err == io.EOF && cached {
 				return nil, ErrCachedClosed
@@ -122,16 +200,11 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts options
 		}
 	}
 
-	p.transport.Yield(pc)
-
-	rc, ok := dns.RcodeToString[ret.Rcode]
-	if !ok {
-		rc = strconv.Itoa(ret.Rcode)
+	if !stop() {
+		// The connection was, or is being, closed; don't give it back.
+		return ret, nil
 	}
-
-	RequestCount.WithLabelValues(p.addr).Add(1)
-	RcodeCount.WithLabelValues(rc, p.addr).Add(1)
-	RequestDuration.WithLabelValues(p.addr, rc).Observe(time.Since(start).Seconds())
+	p.transport.Yield(pc)
 
 	return ret, nil
 }
@@ -0,0 +1,51 @@
+package forward
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/edns"
+
+	"github.com/miekg/dns"
+)
+
+// clientCookie holds the DNS Cookie (RFC 7873) we use with an upstream: our client cookie and the last
+// server cookie the upstream gave us.
+type clientCookie struct {
+	sync.RWMutex
+	client string
+	server string
+}
+
+func newClientCookie() *clientCookie {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &clientCookie{client: hex.EncodeToString(b)}
+}
+
+// set adds our cookie to m, m must be a copy of the client's message as any cookie in it is replaced.
+func (c *clientCookie) set(m *dns.Msg) {
+	c.RLock()
+	defer c.RUnlock()
+	edns.SetCookie(m, c.client+c.server)
+}
+
+// update learns the server cookie from the response m and removes the cookie from m, as it is of no use
+// to our client. It returns false when m carries another client cookie than ours, i.e. when it is spoofed.
+// A response without a cookie is accepted, the upstream may not support cookies.
+func (c *clientCookie) update(m *dns.Msg) bool {
+	cookie := edns.Cookie(m)
+	if cookie == "" {
+		return true
+	}
+	edns.RemoveCookie(m)
+	if len(cookie) < len(c.client) || cookie[:len(c.client)] != c.client {
+		return false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.server = cookie[len(c.client):]
+	return true
+}
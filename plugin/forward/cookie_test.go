@@ -0,0 +1,100 @@
+package forward
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestProxyCookie(t *testing.T) {
+	const server = "1112131415161718"
+
+	var queries uint32
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddUint32(&queries, 1)
+		cookie := edns.Cookie(r)
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		if len(cookie) < 16 {
+			ret.Rcode = dns.RcodeFormatError
+			w.WriteMsg(ret)
+			return
+		}
+		// Require our server cookie.
+		if cookie[16:] != server {
+			ret.Rcode = dns.RcodeBadCookie
+		} else {
+			ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+		}
+		edns.SetCookie(ret, cookie[:16]+server)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\ncookie\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	for i, expected := range []uint32{2, 3} {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		m.SetEdns0(4096, false)
+		edns.SetCookie(m, "0102030405060708")
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected to receive reply, but didn't: %s", i, err)
+		}
+		if rec.Msg.Rcode != dns.RcodeSuccess || len(rec.Msg.Answer) != 1 {
+			t.Errorf("Test %d: expected an answer, got %s", i, dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if cookie := edns.Cookie(rec.Msg); cookie != "" {
+			t.Errorf("Test %d: expected the upstream's cookie to be removed, got %s", i, cookie)
+		}
+		// The client's cookie must not be changed.
+		if cookie := edns.Cookie(m); cookie != "0102030405060708" {
+			t.Errorf("Test %d: expected the client's cookie to be untouched, got %s", i, cookie)
+		}
+		// The first query gets a BADCOOKIE and is retried, the second one uses the learned cookie.
+		if q := atomic.LoadUint32(&queries); q != expected {
+			t.Errorf("Test %d: expected %d queries to the upstream, got %d", i, expected, q)
+		}
+	}
+}
+
+func TestProxyCookieMismatch(t *testing.T) {
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		edns.SetCookie(ret, "ffffffffffffffff1112131415161718")
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	p := NewProxy(s.Addr, transport.DNS)
+	p.start(hcInterval)
+	defer p.finalizer()
+	defer p.stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	req := request.Request{Req: m, W: &test.ResponseWriter{}}
+
+	if _, err := p.Connect(context.TODO(), req, options{cookie: true}); err != ErrBadCookie {
+		t.Errorf("Expected %s, got %v", ErrBadCookie, err)
+	}
+}
@@ -0,0 +1,109 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/doh"
+
+	"github.com/miekg/dns"
+)
+
+// dohTransport sends queries to a DNS-over-HTTPS upstream. The underlying http.Transport keeps the
+// HTTP/2 connection open, so all queries are multiplexed over it.
+type dohTransport struct {
+	addr   string
+	url    string
+	method string
+
+	tlsConfig *tls.Config
+	expire    time.Duration
+	client    *http.Client
+}
+
+func newDoHTransport(addr, path string) *dohTransport {
+	d := &dohTransport{
+		addr:      addr,
+		url:       "https://" + addr + path,
+		method:    http.MethodPost,
+		tlsConfig: new(tls.Config),
+		expire:    defaultExpire,
+	}
+	d.client = d.newClient()
+	return d
+}
+
+func (d *dohTransport) newClient() *http.Client {
+	tr := &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: maxTimeout}).DialContext,
+		TLSClientConfig:     d.tlsConfig.Clone(),
+		TLSHandshakeTimeout: maxTimeout,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 1,
+		IdleConnTimeout:     d.expire,
+	}
+	return &http.Client{Transport: tr}
+}
+
+// SetTLSConfig sets the TLS config used to connect to the upstream.
+func (d *dohTransport) SetTLSConfig(cfg *tls.Config) {
+	d.tlsConfig = cfg
+	d.client = d.newClient()
+}
+
+// SetExpire sets the time after which an idle connection is closed.
+func (d *dohTransport) SetExpire(expire time.Duration) {
+	d.expire = expire
+	d.client = d.newClient()
+}
+
+// SetMethod sets the HTTP method, GET or POST, used for queries.
+func (d *dohTransport) SetMethod(method string) { d.method = method }
+
+// Exchange sends m as a DoH request and waits for the response.
+func (d *dohTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// Use an ID of 0 to make the requests more cache friendly, see section 4.1 of RFC 8484.
+	req := m.Copy()
+	req.Id = 0
+	hreq, err := doh.NewRequestURL(d.method, d.url, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxTimeout+readTimeout)
+	defer cancel()
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				ConnCacheHitsCount.WithLabelValues(d.addr, "https").Add(1)
+				return
+			}
+			ConnCacheMissesCount.WithLabelValues(d.addr, "https").Add(1)
+		},
+	}
+	hreq = hreq.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	resp, err := d.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status from %s: %s", d.addr, resp.Status)
+	}
+
+	ret, err := doh.ResponseToMsg(resp)
+	if err != nil {
+		return nil, err
+	}
+	ret.Id = m.Id
+	return ret, nil
+}
+
+// Stop closes all idle connections.
+func (d *dohTransport) Stop() { d.client.CloseIdleConnections() }
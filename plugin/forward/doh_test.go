@@ -0,0 +1,141 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/doh"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// newDoHServer starts a DNS-over-HTTPS server that serves path and answers with f.
+func newDoHServer(path string, f func(*dns.Msg) *dns.Msg) *httptest.Server {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		m, err := doh.RequestToMsg(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		buf, _ := f(m).Pack()
+		w.Header().Set("Content-Type", doh.MimeType)
+		w.Write(buf)
+	}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	return s
+}
+
+func TestProxyDoH(t *testing.T) {
+	readTimeout = 1 * time.Second
+	defaultTimeout = 5 * time.Second
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		var methods, protos uint32
+		s := newDoHServer("/resolve", func(r *dns.Msg) *dns.Msg {
+			ret := new(dns.Msg)
+			ret.SetReply(r)
+			ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+			return ret
+		})
+		s.Config.Handler = countRequests(s.Config.Handler, method, &methods, &protos)
+
+		addr := strings.TrimPrefix(s.URL, "https://")
+		c := caddy.NewTestController("dns", "forward . https://"+addr+"/resolve {\nhttps_method "+method+"\n}\n")
+		f, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Failed to create forwarder: %s", err)
+		}
+		f.proxies[0].SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+		f.OnStartup()
+
+		for i := 0; i < 3; i++ {
+			m := new(dns.Msg)
+			m.SetQuestion("example.org.", dns.TypeA)
+			m.Id = 1234
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+			if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+				t.Fatalf("Expected to receive reply, but didn't: %s", err)
+			}
+			if x := rec.Msg.Answer[0].Header().Name; x != "example.org." {
+				t.Errorf("Expected %s, got %s", "example.org.", x)
+			}
+			if rec.Msg.Id != 1234 {
+				t.Errorf("Expected reply to have ID %d, got %d", 1234, rec.Msg.Id)
+			}
+		}
+		if x := atomic.LoadUint32(&methods); x != 3 {
+			t.Errorf("Expected %d %s requests, got %d", 3, method, x)
+		}
+		if x := atomic.LoadUint32(&protos); x != 3 {
+			t.Errorf("Expected %d HTTP/2 requests, got %d", 3, x)
+		}
+		f.OnShutdown()
+		s.Close()
+	}
+}
+
+func TestHealthDoH(t *testing.T) {
+	readTimeout = 1 * time.Second
+
+	var hc uint32
+	s := newDoHServer(doh.Path, func(r *dns.Msg) *dns.Msg {
+		if r.Question[0].Name == "." && r.Question[0].Qtype == dns.TypeNS {
+			atomic.AddUint32(&hc, 1)
+		}
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		return ret
+	})
+	defer s.Close()
+
+	p := NewProxy(strings.TrimPrefix(s.URL, "https://"), transport.HTTPS)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	defer p.exchanger.Stop()
+
+	if err := p.health.Check(p); err != nil {
+		t.Fatalf("Expected healthy upstream, got: %s", err)
+	}
+	if x := atomic.LoadUint32(&hc); x != 1 {
+		t.Errorf("Expected %d health check, got %d", 1, x)
+	}
+
+	// Wrong path returns a 404, which is a failed health check.
+	p = NewProxy(strings.TrimPrefix(s.URL, "https://")+"/resolve", transport.HTTPS)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	defer p.exchanger.Stop()
+
+	if err := p.health.Check(p); err == nil {
+		t.Error("Expected failed health check, got none")
+	}
+	if x := atomic.LoadUint32(&p.fails); x != 1 {
+		t.Errorf("Expected %d fails, got %d", 1, x)
+	}
+}
+
+func countRequests(h http.Handler, method string, methods, protos *uint32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == method {
+			atomic.AddUint32(methods, 1)
+		}
+		if r.ProtoMajor == 2 {
+			atomic.AddUint32(protos, 1)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
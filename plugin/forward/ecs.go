@@ -0,0 +1,136 @@
+package forward
+
+import (
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// ecs holds the settings for sending EDNS Client Subnet (RFC 7871) options to the upstreams.
+type ecs struct {
+	add     bool     // add an option made from the address of the client
+	prefix4 uint8    // source prefix length for IPv4 clients
+	prefix6 uint8    // source prefix length for IPv6 clients
+	strip   bool     // remove the option of the client
+	zones   []string // only send options for queries in these zones, all when empty
+}
+
+// subnet returns the option for the query in state, or nil when no option should be sent. The second
+// return value is true when the option is the one of the client, possibly shortened.
+func (e *ecs) subnet(state request.Request) (*dns.EDNS0_SUBNET, bool) {
+	if len(e.zones) > 0 && plugin.Zones(e.zones).Matches(state.Name()) == "" {
+		return nil, false
+	}
+
+	if s := edns.Subnet(state.Req); s != nil && !e.strip {
+		if !e.add {
+			return s, true
+		}
+		// Never send more of the client's address than we would send of our own.
+		return e.shorten(s.Family, s.Address, s.SourceNetmask), true
+	}
+	if !e.add {
+		return nil, false
+	}
+
+	ip := net.ParseIP(state.IP())
+	if ip == nil {
+		return nil, false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return e.shorten(1, ip4, net.IPv4len*8), false
+	}
+	return e.shorten(2, ip, net.IPv6len*8), false
+}
+
+// shorten returns an option for ip with a source prefix length of at most our own.
+func (e *ecs) shorten(family uint16, ip net.IP, source uint8) *dns.EDNS0_SUBNET {
+	prefix, bits := e.prefix6, net.IPv6len*8
+	if family == 1 {
+		prefix, bits = e.prefix4, net.IPv4len*8
+		ip = ip.To4()
+	}
+	if source < prefix {
+		prefix = source
+	}
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: prefix,
+		Address:       ip.Mask(net.CIDRMask(int(prefix), bits)),
+	}
+}
+
+// request returns the request in state with the option set by e, and a response writer that restores the
+// option of the client in the response. The request of the client itself is not modified.
+func (e *ecs) request(state request.Request, w dns.ResponseWriter) (request.Request, dns.ResponseWriter) {
+	client := edns.Subnet(state.Req)
+	s, own := e.subnet(state)
+	if s == client {
+		return state, w
+	}
+
+	r := state.Req.Copy()
+	if s == nil {
+		edns.RemoveSubnet(r)
+	} else {
+		edns.SetSubnet(r, s)
+	}
+	return request.Request{W: state.W, Req: r}, &ecsWriter{ResponseWriter: w, client: client, scope: own, opt: state.Req.IsEdns0() != nil}
+}
+
+// ecsWriter restores the option of the client in the response: it is removed when the client didn't send
+// one, and set to the one of the client otherwise. When the client didn't use EDNS0 at all, the OPT RR
+// we added is removed as well.
+type ecsWriter struct {
+	dns.ResponseWriter
+	client *dns.EDNS0_SUBNET
+	scope  bool // the scope of the upstream applies to the subnet of the client
+	opt    bool // the client sent an OPT RR
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ecsWriter) WriteMsg(m *dns.Msg) error {
+	if !w.opt {
+		removeOPT(m)
+		return w.ResponseWriter.WriteMsg(m)
+	}
+	if w.client == nil {
+		edns.RemoveSubnet(m)
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	// We sent a subnet the client may not be in, so the answer is only known to apply to all clients.
+	scope := uint8(0)
+	if s := edns.Subnet(m); s != nil && w.scope {
+		scope = s.SourceScope
+	}
+	edns.SetSubnet(m, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        w.client.Family,
+		SourceNetmask: w.client.SourceNetmask,
+		SourceScope:   scope,
+		Address:       w.client.Address,
+	})
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// removeOPT removes the OPT RR from m.
+func removeOPT(m *dns.Msg) {
+	extra := m.Extra[:0]
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	m.Extra = extra
+}
+
+const (
+	defaultECSPrefix4 = 24
+	defaultECSPrefix6 = 56
+)
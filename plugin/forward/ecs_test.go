@@ -0,0 +1,113 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestECS(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent string // the subnet the upstream got
+	)
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		mu.Lock()
+		sent = ""
+		if s := edns.Subnet(r); s != nil {
+			sent = fmt.Sprintf("%s/%d", s.Address, s.SourceNetmask)
+			// Answer for the whole subnet.
+			ret.SetEdns0(4096, false)
+			edns.SetSubnet(ret, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: s.Family, SourceNetmask: s.SourceNetmask, SourceScope: s.SourceNetmask, Address: s.Address})
+		}
+		mu.Unlock()
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	client := func(ip string, source uint8) *dns.EDNS0_SUBNET {
+		family := uint16(2)
+		if net.ParseIP(ip).To4() != nil {
+			family = 1
+		}
+		return &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: family, SourceNetmask: source, Address: net.ParseIP(ip)}
+	}
+
+	tests := []struct {
+		options  string
+		qname    string
+		v6       bool
+		client   *dns.EDNS0_SUBNET
+		sent     string // subnet sent upstream
+		received string // subnet and scope in the reply to the client
+	}{
+		{"ecs", "example.org.", false, nil, "10.240.0.0/24", ""},
+		{"ecs 16 48", "example.org.", true, nil, "fe80::/48", ""},
+		{"ecs 0", "example.org.", false, nil, "0.0.0.0/0", ""},
+		{"ecs", "example.org.", false, client("192.0.2.128", 25), "192.0.2.0/24", "192.0.2.128/25 24"},
+		{"ecs", "example.org.", false, client("192.0.2.0", 16), "192.0.0.0/16", "192.0.2.0/16 16"},
+		{"ecs\necs_client strip", "example.org.", false, client("192.0.2.0", 24), "10.240.0.0/24", "192.0.2.0/24 0"},
+		{"ecs_client strip", "example.org.", false, client("192.0.2.0", 24), "", "192.0.2.0/24 0"},
+		{"ecs_client preserve", "example.org.", false, client("192.0.2.0", 32), "192.0.2.0/32", "192.0.2.0/32 32"},
+		{"ecs\necs_zones example.net", "example.org.", false, nil, "", ""},
+		{"ecs\necs_zones example.net", "example.org.", false, client("192.0.2.0", 24), "", "192.0.2.0/24 0"},
+		{"ecs\necs_zones example.net example.org", "www.example.org.", false, nil, "10.240.0.0/24", ""},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\n"+tc.options+"\n}")
+		f, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create forwarder: %s", i, err)
+		}
+		f.OnStartup()
+
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		if tc.client != nil {
+			m.SetEdns0(4096, false)
+			edns.SetSubnet(m, tc.client)
+		}
+		var rw dns.ResponseWriter = &test.ResponseWriter{}
+		if tc.v6 {
+			rw = &test.ResponseWriter6{}
+		}
+		rec := dnstest.NewRecorder(rw)
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected a reply, got %s", i, err)
+		}
+		f.OnShutdown()
+
+		mu.Lock()
+		if sent != tc.sent {
+			t.Errorf("Test %d: expected %q to be sent upstream, got %q", i, tc.sent, sent)
+		}
+		mu.Unlock()
+
+		received := ""
+		if s := edns.Subnet(rec.Msg); s != nil {
+			received = fmt.Sprintf("%s/%d %d", s.Address, s.SourceNetmask, s.SourceScope)
+		}
+		if received != tc.received {
+			t.Errorf("Test %d: expected %q in the reply, got %q", i, tc.received, received)
+		}
+		// A client without EDNS0 must not get an OPT RR back.
+		if tc.client == nil && rec.Msg.IsEdns0() != nil {
+			t.Errorf("Test %d: expected no OPT RR in the reply, got %s", i, rec.Msg.IsEdns0())
+		}
+		// The request of the client must be left alone.
+		if x := edns.Subnet(m); x != tc.client {
+			t.Errorf("Test %d: expected the subnet of the client in its request, got %v", i, x)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package forward
+
+import (
+	"github.com/miekg/dns"
+)
+
+// isFailover returns true when a response with rcode should make us try the next upstream.
+func (f *Forward) isFailover(rcode int) bool {
+	for _, rc := range f.failover {
+		if rc == rcode {
+			return true
+		}
+	}
+	return false
+}
+
+// failedOver records that proxy answered with rcode, one of the failover rcodes. When these count as
+// failures, a health check is started, just as for a network error. The health check treats these
+// rcodes as failures as well, so it alone counts the fails of proxy.
+func (f *Forward) failedOver(proxy *Proxy, rcode int) {
+	FailoverCount.WithLabelValues(proxy.addr, dns.RcodeToString[rcode]).Add(1)
+	if !f.failoverFails || f.maxfails == 0 {
+		return
+	}
+	proxy.Healthcheck()
+}
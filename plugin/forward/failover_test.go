@@ -0,0 +1,133 @@
+package forward
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestFailover(t *testing.T) {
+	var broken, refused int32
+	servfail := answer(dns.RcodeServerFailure, "", 0, &broken)
+	defer servfail.Close()
+	refuse := answer(dns.RcodeRefused, "", 0, &refused)
+	defer refuse.Close()
+	good := answer(dns.RcodeSuccess, "127.0.0.1", 0, nil)
+	defer good.Close()
+
+	tests := []struct {
+		to       string
+		options  string
+		rcode    int
+		expected int32 // queries to the SERVFAIL upstream
+	}{
+		{servfail.Addr + " " + good.Addr, "failover SERVFAIL", dns.RcodeSuccess, 1},
+		{servfail.Addr + " " + good.Addr, "hedge 1s\nfailover SERVFAIL", dns.RcodeSuccess, 1},
+		{servfail.Addr + " " + good.Addr, "", dns.RcodeServerFailure, 1},
+		{servfail.Addr + " " + refuse.Addr, "failover SERVFAIL REFUSED", dns.RcodeRefused, 1},           // the last response is returned
+		{servfail.Addr + " " + refuse.Addr, "hedge 1s\nfailover SERVFAIL REFUSED", dns.RcodeRefused, 1}, // the last response is returned
+	}
+	for i, tc := range tests {
+		atomic.StoreInt32(&broken, 0)
+		c := caddy.NewTestController("dns", "forward . "+tc.to+" {\npolicy sequential\n"+tc.options+"\n}")
+		f, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create forwarder: %s", i, err)
+		}
+		f.OnStartup()
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Errorf("Test %d: expected a reply, got %s", i, err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if x := atomic.LoadInt32(&broken); x != tc.expected {
+			t.Errorf("Test %d: expected %d queries to the SERVFAIL upstream, got %d", i, tc.expected, x)
+		}
+		f.OnShutdown()
+	}
+}
+
+func TestFailoverCountFails(t *testing.T) {
+	servfail := answer(dns.RcodeServerFailure, "", 0, nil)
+	defer servfail.Close()
+	good := answer(dns.RcodeSuccess, "127.0.0.1", 0, nil)
+	defer good.Close()
+
+	c := caddy.NewTestController("dns", "forward . "+servfail.Addr+" "+good.Addr+" {\npolicy sequential\nmax_fails 1\nfailover SERVFAIL count_fails\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	f.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+
+	// The health check gets a SERVFAIL as well, so the upstream is considered down.
+	for i := 0; i < 100; i++ {
+		if f.proxies[0].Down(f.maxfails) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !f.proxies[0].Down(f.maxfails) {
+		t.Errorf("Expected the SERVFAIL upstream to be down")
+	}
+	if f.proxies[1].Down(f.maxfails) {
+		t.Errorf("Expected the good upstream to be up")
+	}
+}
+
+func TestFailoverCountFailsOnce(t *testing.T) {
+	tests := []struct {
+		probe    int // rcode of the health check
+		expected uint32
+	}{
+		{dns.RcodeSuccess, 0},       // only the health check counts, and it succeeds
+		{dns.RcodeServerFailure, 1}, // the SERVFAIL is counted once, by the health check
+	}
+	for i, tc := range tests {
+		s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+			ret := new(dns.Msg)
+			ret.SetReply(r)
+			ret.Rcode = dns.RcodeServerFailure
+			if r.Question[0].Name == "." {
+				ret.Rcode = tc.probe
+			}
+			w.WriteMsg(ret)
+		})
+
+		// The interval is long enough for a single health check.
+		c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\nmax_fails 1\nhealth_check 5s\nfailover SERVFAIL count_fails\n}")
+		f, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create forwarder: %s", i, err)
+		}
+		f.OnStartup()
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		f.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m)
+
+		time.Sleep(100 * time.Millisecond)
+		if fails := atomic.LoadUint32(&f.proxies[0].fails); fails != tc.expected {
+			t.Errorf("Test %d: expected %d fails, got %d", i, tc.expected, fails)
+		}
+		f.OnShutdown()
+		s.Close()
+	}
+}
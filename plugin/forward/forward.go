@@ -8,6 +8,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"net/http"
 	"sync/atomic"
 	"time"
 
@@ -15,7 +16,9 @@ import (
 	"github.com/coredns/coredns/plugin/debug"
 	"github.com/coredns/coredns/plugin/dnstap"
 	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/singleflight"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -38,10 +41,27 @@ type Forward struct {
 
 	tlsConfig     *tls.Config
 	tlsServerName string
+	pins          map[string]pins // SPKI fingerprints per upstream address
+	httpsMethod   string
 	maxfails      uint32
 	expire        time.Duration
 	maxConcurrent int64
 
+	// Hedging: query up to hedgeMax upstreams in parallel, starting the next one after hedgeDelay.
+	hedgeDelay time.Duration
+	hedgeMax   int
+
+	router *router // routes domains to groups of upstreams, if configured
+
+	ecs *ecs // EDNS Client Subnet settings, if configured
+
+	// Failover: responses with one of these rcodes make us try the next upstream, and count as a failure
+	// of the upstream when failoverFails is set.
+	failover      []int
+	failoverFails bool
+
+	inflight *singleflight.Group // coalesces identical queries in flight, if configured
+
 	opts options // also here for testing
 
 	// ErrLimitExceeded indicates that a query was rejected because the number of concurrent queries has exceeded
@@ -55,7 +75,7 @@ type Forward struct {
 
 // New returns a new Forward.
 func New() *Forward {
-	f := &Forward{maxfails: 2, tlsConfig: new(tls.Config), expire: defaultExpire, p: new(random), from: ".", hcInterval: hcInterval, opts: options{forceTCP: false, preferUDP: false, hcRecursionDesired: true}}
+	f := &Forward{maxfails: 2, tlsConfig: new(tls.Config), httpsMethod: http.MethodPost, expire: defaultExpire, p: new(random), from: ".", hcInterval: hcInterval, opts: options{forceTCP: false, preferUDP: false, hcRecursionDesired: true}}
 	return f
 }
 
@@ -88,14 +108,38 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 		}
 	}
 
+	if f.ecs != nil {
+		state, w = f.ecs.request(state, w)
+	}
+
+	if f.inflight != nil {
+		return f.serveCoalesced(ctx, w, state)
+	}
+	return f.serve(ctx, w, state)
+}
+
+// serve sends the query in state to the upstreams, and writes the reply to w.
+func (f *Forward) serve(ctx context.Context, w dns.ResponseWriter, state request.Request) (int, error) {
 	fails := 0
-	var span, child ot.Span
+	failovers := 0
+	var span ot.Span
 	var upstreamErr error
+	var failoverRet *dns.Msg
+	allDown := false
 	span = ot.SpanFromContext(ctx)
 	i := 0
-	list := f.List()
+	proxies := f.proxies
+	if f.router != nil {
+		if p, ok := f.router.route(state.Name()); ok && p != nil {
+			proxies = p
+		}
+	}
+	list := f.p.List(proxies)
 	deadline := time.Now().Add(defaultTimeout)
 	start := time.Now()
+	if f.hedgeMax > 1 {
+		return f.serveHedged(ctx, w, state, proxies, list, span, start)
+	}
 	for time.Now().Before(deadline) {
 		if i >= len(list) {
 			// reached the end of list, reset to begin
@@ -105,54 +149,26 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 
 		proxy := list[i]
 		i++
+		allDown = false
 		if proxy.Down(f.maxfails) {
 			fails++
-			if fails < len(f.proxies) {
+			if fails < len(proxies) {
 				continue
 			}
 			// All upstream proxies are dead, assume healthcheck is completely broken and randomly
 			// select an upstream to connect to.
 			r := new(random)
-			proxy = r.List(f.proxies)[0]
+			proxy = r.List(proxies)[0]
+			allDown = true
 
 			HealthcheckBrokenCount.Add(1)
 		}
 
-		if span != nil {
-			child = span.Tracer().StartSpan("connect", ot.ChildOf(span.Context()))
-			ctx = ot.ContextWithSpan(ctx, child)
-		}
-
 		metadata.SetValueFunc(ctx, "forward/upstream", func() string {
 			return proxy.addr
 		})
 
-		var (
-			ret *dns.Msg
-			err error
-		)
-		opts := f.opts
-		for {
-			ret, err = proxy.Connect(ctx, state, opts)
-			if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
-				continue
-			}
-			// Retry with TCP if truncated and prefer_udp configured.
-			if ret != nil && ret.Truncated && !opts.forceTCP && opts.preferUDP {
-				opts.forceTCP = true
-				continue
-			}
-			break
-		}
-
-		if child != nil {
-			child.Finish()
-		}
-
-		if f.tapPlugin != nil {
-			toDnstap(f, proxy.addr, state, opts, ret, start)
-		}
-
+		ret, err := f.connect(ctx, span, proxy, state, start)
 		upstreamErr = err
 
 		if err != nil {
@@ -161,7 +177,7 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 				proxy.Healthcheck()
 			}
 
-			if fails < len(f.proxies) {
+			if fails < len(proxies) {
 				continue
 			}
 			break
@@ -177,15 +193,76 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return 0, nil
 		}
 
+		// Try the next upstream, but give each upstream only one chance to answer.
+		if f.isFailover(ret.Rcode) {
+			f.failedOver(proxy, ret.Rcode)
+			if failovers < len(list)-1 {
+				failovers++
+				failoverRet = ret
+				continue
+			}
+		}
+
 		w.WriteMsg(ret)
 		return 0, nil
 	}
 
-	if upstreamErr != nil {
-		return dns.RcodeServerFailure, upstreamErr
+	// Better an answer from an upstream than a SERVFAIL of our own.
+	if failoverRet != nil {
+		w.WriteMsg(failoverRet)
+		return 0, nil
+	}
+	return f.servfail(allDown, upstreamErr)
+}
+
+// connect sends the request to proxy. It retries when a cached connection was closed, and over TCP when
+// the response is truncated and prefer_udp is set.
+func (f *Forward) connect(ctx context.Context, span ot.Span, proxy *Proxy, state request.Request, start time.Time) (*dns.Msg, error) {
+	var child ot.Span
+	if span != nil {
+		child = span.Tracer().StartSpan("connect", ot.ChildOf(span.Context()))
+		ctx = ot.ContextWithSpan(ctx, child)
+	}
+
+	var (
+		ret *dns.Msg
+		err error
+	)
+	opts := f.opts
+	for {
+		ret, err = proxy.Connect(ctx, state, opts)
+		if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
+			continue
+		}
+		// Retry with TCP if truncated and prefer_udp configured.
+		if ret != nil && ret.Truncated && !opts.forceTCP && opts.preferUDP {
+			opts.forceTCP = true
+			continue
+		}
+		break
+	}
+
+	if child != nil {
+		child.Finish()
 	}
 
-	return dns.RcodeServerFailure, ErrNoHealthy
+	if f.tapPlugin != nil {
+		toDnstap(f, proxy.addr, state, opts, ret, start)
+	}
+	return ret, err
+}
+
+// servfail returns SERVFAIL with an error that tells the client why we failed: either all upstreams are
+// down, or the last one we tried failed. The server writes the reply, so nothing caches it.
+func (f *Forward) servfail(allDown bool, upstreamErr error) (int, error) {
+	err := &edns.Error{Err: upstreamErr, Code: dns.ExtendedErrorCodeNetworkError}
+	if allDown || upstreamErr == nil {
+		err.Code = dns.ExtendedErrorCodeNoReachableAuthority
+	}
+	if upstreamErr == nil {
+		err.Err = ErrNoHealthy
+	}
+	return dns.RcodeServerFailure, err
 }
 
 func (f *Forward) match(state request.Request) bool {
@@ -225,6 +302,10 @@ var (
 	ErrNoForward = errors.New("no forwarder defined")
 	// ErrCachedClosed means cached connection was closed by peer.
 	ErrCachedClosed = errors.New("cached connection was closed by peer")
+	// ErrBadCookie means the upstream's response carried a client cookie that isn't ours.
+	ErrBadCookie = errors.New("client cookie mismatch in response")
+	// ErrCaseMismatch means the upstream's response has the query name in another case than we sent.
+	ErrCaseMismatch = errors.New("query name case mismatch in response")
 )
 
 // options holds various options that can be set.
@@ -232,6 +313,8 @@ type options struct {
 	forceTCP           bool
 	preferUDP          bool
 	hcRecursionDesired bool
+	cookie             bool // send DNS Cookies to the upstreams
+	randomizeCase      bool // randomize the case of query names to the upstreams
 }
 
 var defaultTimeout = 5 * time.Second
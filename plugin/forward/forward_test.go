@@ -1,9 +1,33 @@
 package forward
 
 import (
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
+// answer returns a test upstream that answers with rcode after delay, with an A record for address when
+// rcode is NOERROR. It counts the queries it gets in queries, if not nil.
+func answer(rcode int, address string, delay time.Duration, queries *int32) *dnstest.Server {
+	return dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		if queries != nil {
+			atomic.AddInt32(queries, 1)
+		}
+		time.Sleep(delay)
+		ret := new(dns.Msg)
+		ret.SetRcode(r, rcode)
+		if rcode == dns.RcodeSuccess {
+			ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A "+address))
+		}
+		w.WriteMsg(ret)
+	})
+}
+
 func TestList(t *testing.T) {
 	f := Forward{
 		proxies: []*Proxy{{addr: "1.1.1.1:53"}, {addr: "2.2.2.2:53"}, {addr: "3.3.3.3:53"}},
@@ -1,7 +1,9 @@
 package forward
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
 	"sync/atomic"
 	"time"
 
@@ -39,6 +41,9 @@ func NewHealthChecker(trans string, recursionDesired bool) HealthChecker {
 		c.WriteTimeout = hcWriteTimeout
 
 		return &dnsHc{c: c, recursionDesired: recursionDesired}
+
+	case transport.QUIC, transport.HTTPS:
+		return &exchangeHc{recursionDesired: recursionDesired}
 	}
 
 	log.Warningf("No healthchecker for transport %q", trans)
@@ -62,7 +67,7 @@ func (h *dnsHc) GetRecursionDesired() bool {
 
 // Check is used as the up.Func in the up.Probe.
 func (h *dnsHc) Check(p *Proxy) error {
-	err := h.send(p.addr)
+	err := h.send(p.addr, p.failRcodes)
 	if err != nil {
 		HealthcheckFailureCount.WithLabelValues(p.addr).Add(1)
 		atomic.AddUint32(&p.fails, 1)
@@ -73,7 +78,7 @@ func (h *dnsHc) Check(p *Proxy) error {
 	return nil
 }
 
-func (h *dnsHc) send(addr string) error {
+func (h *dnsHc) send(addr string, failRcodes []int) error {
 	ping := new(dns.Msg)
 	ping.SetQuestion(".", dns.TypeNS)
 	ping.MsgHdr.RecursionDesired = h.recursionDesired
@@ -86,6 +91,62 @@ func (h *dnsHc) send(addr string) error {
 			err = nil
 		}
 	}
+	if err == nil {
+		err = rcodeErr(m, failRcodes)
+	}
 
 	return err
 }
+
+// rcodeErr returns an error when the rcode of m is one of rcodes.
+func rcodeErr(m *dns.Msg, rcodes []int) error {
+	for _, rc := range rcodes {
+		if m.Rcode == rc {
+			return fmt.Errorf("%s response", dns.RcodeToString[rc])
+		}
+	}
+	return nil
+}
+
+// exchangeHc is a health checker for DNS-over-QUIC and DNS-over-HTTPS endpoints. It sends the
+// health check query over the proxy's own connection to the upstream.
+type exchangeHc struct {
+	recursionDesired bool
+}
+
+// SetTLSConfig is a noop, the TLS config of the proxy's transport is used.
+func (h *exchangeHc) SetTLSConfig(cfg *tls.Config) {}
+
+func (h *exchangeHc) SetRecursionDesired(recursionDesired bool) {
+	h.recursionDesired = recursionDesired
+}
+func (h *exchangeHc) GetRecursionDesired() bool {
+	return h.recursionDesired
+}
+
+// Check is used as the up.Func in the up.Probe.
+func (h *exchangeHc) Check(p *Proxy) error {
+	err := h.send(p)
+	if err != nil {
+		HealthcheckFailureCount.WithLabelValues(p.addr).Add(1)
+		atomic.AddUint32(&p.fails, 1)
+		return err
+	}
+
+	atomic.StoreUint32(&p.fails, 0)
+	return nil
+}
+
+func (h *exchangeHc) send(p *Proxy) error {
+	ping := new(dns.Msg)
+	ping.SetQuestion(".", dns.TypeNS)
+	ping.MsgHdr.RecursionDesired = h.recursionDesired
+
+	ctx, cancel := context.WithTimeout(context.Background(), hcReadTimeout+hcWriteTimeout)
+	defer cancel()
+	m, err := p.exchanger.Exchange(ctx, ping)
+	if err != nil {
+		return err
+	}
+	return rcodeErr(m, p.failRcodes)
+}
@@ -0,0 +1,123 @@
+package forward
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	ot "github.com/opentracing/opentracing-go"
+)
+
+// hedgeResult is the outcome of a hedged query to proxy.
+type hedgeResult struct {
+	proxy *Proxy
+	ret   *dns.Msg
+	err   error
+}
+
+// serveHedged sends the request to the first healthy upstream of list, the ordered proxies, and to the next one each time
+// f.hedgeDelay passes without a reply or when an upstream fails, with at most f.hedgeMax queries in
+// flight. The first acceptable reply is written to the client and the other queries are cancelled.
+func (f *Forward) serveHedged(ctx context.Context, w dns.ResponseWriter, state request.Request, proxies, list []*Proxy, span ot.Span, start time.Time) (int, error) {
+	healthy := make([]*Proxy, 0, len(list))
+	for _, p := range list {
+		if !p.Down(f.maxfails) {
+			healthy = append(healthy, p)
+		}
+	}
+	allDown := len(healthy) == 0
+	if allDown {
+		// All upstream proxies are dead, assume healthcheck is completely broken and randomly
+		// select an upstream to connect to.
+		healthy = []*Proxy{new(random).List(proxies)[0]}
+		HealthcheckBrokenCount.Add(1)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	results := make(chan hedgeResult, len(healthy))
+	next, inflight := 0, 0
+	launch := func() {
+		proxy := healthy[next]
+		if next > 0 {
+			HedgeCount.WithLabelValues(proxy.addr).Add(1)
+		}
+		next++
+		inflight++
+		// Each query gets its own copy of the request, the exchanges may modify it.
+		state := request.Request{W: state.W, Req: state.Req.Copy()}
+		go func() {
+			sent := time.Now()
+			ret, err := f.connect(ctx, span, proxy, state, start)
+			if err != nil {
+				// A query we cancelled only failed if it was outstanding for longer than the hedge delay,
+				// otherwise an upstream that never answers keeps its place in front of the others.
+				failed := ctx.Err() == nil
+				if !failed && time.Since(sent) > f.hedgeDelay {
+					proxy.observe(rttPenalty)
+					failed = true
+				}
+				// Kick off health check to see if *our* upstream is broken.
+				if failed && f.maxfails != 0 {
+					proxy.Healthcheck()
+				}
+			}
+			results <- hedgeResult{proxy: proxy, ret: ret, err: err}
+		}()
+	}
+
+	launch()
+	for f.hedgeDelay == 0 && next < len(healthy) && inflight < f.hedgeMax {
+		launch()
+	}
+	timer := time.NewTimer(f.hedgeDelay)
+	defer timer.Stop()
+
+	var upstreamErr error
+	var failoverRet *dns.Msg
+	for inflight > 0 {
+		select {
+		case res := <-results:
+			inflight--
+			if res.err == nil && state.Match(res.ret) && f.isFailover(res.ret.Rcode) {
+				f.failedOver(res.proxy, res.ret.Rcode)
+				failoverRet = res.ret
+				if next < len(healthy) {
+					launch()
+				}
+				continue
+			}
+			if res.err == nil && state.Match(res.ret) {
+				HedgeWinCount.WithLabelValues(res.proxy.addr).Add(1)
+				metadata.SetValueFunc(ctx, "forward/upstream", func() string {
+					return res.proxy.addr
+				})
+				w.WriteMsg(res.ret)
+				return 0, nil
+			}
+			upstreamErr = res.err
+			if next < len(healthy) {
+				launch()
+			}
+		case <-timer.C:
+			if next < len(healthy) && inflight < f.hedgeMax {
+				launch()
+				timer.Reset(f.hedgeDelay)
+			}
+		case <-ctx.Done():
+			inflight = 0
+		}
+	}
+	// Better an answer from an upstream than a SERVFAIL of our own.
+	if failoverRet != nil {
+		w.WriteMsg(failoverRet)
+		return 0, nil
+	}
+	return f.servfail(allDown, upstreamErr)
+}
+
+const defaultHedgeMax = 2
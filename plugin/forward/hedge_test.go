@@ -0,0 +1,133 @@
+package forward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// hedgeTimeouts restores the default timeouts for the duration of t: other tests lower them, and the
+// slow upstreams of the hedge tests must not time out. The upstreams are started with answer, which
+// gives each one its own handler.
+func hedgeTimeouts(t *testing.T) {
+	r, d := readTimeout, defaultTimeout
+	readTimeout, defaultTimeout = 2*time.Second, 5*time.Second
+	t.Cleanup(func() { readTimeout, defaultTimeout = r, d })
+}
+
+func TestHedge(t *testing.T) {
+	hedgeTimeouts(t)
+
+	slow := answer(dns.RcodeSuccess, "127.0.0.1", 500*time.Millisecond, nil)
+	defer slow.Close()
+	fast := answer(dns.RcodeSuccess, "127.0.0.2", 0, nil)
+	defer fast.Close()
+
+	tests := []struct {
+		hedge   string
+		maxTime time.Duration
+	}{
+		{"hedge 50ms", 400 * time.Millisecond},
+		{"hedge 0", 100 * time.Millisecond},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", "forward . "+slow.Addr+" "+fast.Addr+" {\npolicy sequential\n"+tc.hedge+"\n}")
+		f, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create forwarder: %s", i, err)
+		}
+		f.OnStartup()
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		start := time.Now()
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Errorf("Test %d: expected a reply, got %s", i, err)
+		}
+		if d := time.Since(start); d > tc.maxTime {
+			t.Errorf("Test %d: expected a reply within %s, got one after %s", i, tc.maxTime, d)
+		}
+		if x := rec.Msg.Answer[0].(*dns.A).A.String(); x != "127.0.0.2" {
+			t.Errorf("Test %d: expected the reply of the fast upstream, got %s", i, x)
+		}
+		f.OnShutdown()
+	}
+}
+
+func TestHedgeFailure(t *testing.T) {
+	fast := answer(dns.RcodeSuccess, "127.0.0.2", 0, nil)
+	defer fast.Close()
+
+	// Nothing listens on the first upstream, its failure makes us try the next one without waiting.
+	c := caddy.NewTestController("dns", "forward . 127.0.0.1:1 "+fast.Addr+" {\npolicy sequential\nhedge 1s\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{TCP: true})
+	start := time.Now()
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Errorf("Expected a reply, got %s", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Expected a reply before the hedge delay, got one after %s", d)
+	}
+}
+
+func TestHedgeFastest(t *testing.T) {
+	hedgeTimeouts(t)
+
+	slow := answer(dns.RcodeSuccess, "127.0.0.1", 500*time.Millisecond, nil)
+	defer slow.Close()
+	silent := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {})
+	defer silent.Close()
+	fast := answer(dns.RcodeSuccess, "127.0.0.2", 0, nil)
+	defer fast.Close()
+
+	tests := []struct {
+		loser string
+		hedge string
+	}{
+		{slow.Addr, "hedge 0"},
+		{silent.Addr, "hedge 50ms"},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", "forward . "+tc.loser+" "+fast.Addr+" {\npolicy fastest\n"+tc.hedge+"\n}")
+		f, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create forwarder: %s", i, err)
+		}
+		f.p = &fastest{} // no probes, the loser must be asked first
+		f.OnStartup()
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		if _, err := f.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+			t.Errorf("Test %d: expected a reply, got %s", i, err)
+		}
+
+		// The loser was outstanding for longer than the hedge delay when it was cancelled, which counts
+		// as a failed exchange: it must not stay in front of the upstream that answered.
+		time.Sleep(100 * time.Millisecond)
+		loser, winner := f.proxies[0].rtt.value(), f.proxies[1].rtt.value()
+		if winner == 0 || winner > 100*time.Millisecond {
+			t.Errorf("Test %d: expected a short round trip time for the fast upstream, got %s", i, winner)
+		}
+		if loser <= winner {
+			t.Errorf("Test %d: expected a longer round trip time for the cancelled upstream, got %s", i, loser)
+		}
+		f.OnShutdown()
+	}
+}
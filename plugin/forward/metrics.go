@@ -52,6 +52,12 @@ var (
 		Name:      "max_concurrent_rejects_total",
 		Help:      "Counter of the number of queries rejected because the concurrent queries were at maximum.",
 	})
+	CoalescedCount = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "coalesced_queries_total",
+		Help:      "Counter of queries answered with the reply to an identical query in flight.",
+	})
 	ConnCacheHitsCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: plugin.Namespace,
 		Subsystem: "forward",
@@ -64,4 +70,52 @@ var (
 		Name:      "conn_cache_misses_total",
 		Help:      "Counter of connection cache misses per upstream and protocol.",
 	}, []string{"to", "proto"})
+	HedgeCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "hedged_requests_total",
+		Help:      "Counter of hedged requests made per upstream, i.e. sent while another upstream was still being queried.",
+	}, []string{"to"})
+	HedgeWinCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "hedge_wins_total",
+		Help:      "Counter of replies used per upstream, when hedging.",
+	}, []string{"to"})
+	FailoverCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "failover_total",
+		Help:      "Counter of responses per upstream and rcode that made us try the next upstream.",
+	}, []string{"to", "rcode"})
+	CaseMismatchCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "case_mismatches_total",
+		Help:      "Counter of responses per upstream with the query name in another case than sent.",
+	}, []string{"to"})
+	TLSHandshakeCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "tls_handshakes_total",
+		Help:      "Counter of TLS handshakes per upstream, and whether they were full or resumed.",
+	}, []string{"to", "type"})
+	PinFailureCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "tls_pin_failures_total",
+		Help:      "Counter of TLS handshakes per upstream that failed because no certificate matched the SPKI fingerprints.",
+	}, []string{"to"})
+	RouteCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "routes",
+		Help:      "Gauge of the number of domains read from the route files.",
+	}, []string{"from"})
+	RTTGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "upstream_rtt_seconds",
+		Help:      "Gauge of the smoothed round trip time per upstream, as used by the fastest policy.",
+	}, []string{"to"})
 )
@@ -0,0 +1,64 @@
+package forward
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// pins is the set of SPKI fingerprints of an upstream, as in the out-of-band key-pinned privacy profile
+// of RFC 7858: the base64 of the SHA-256 hash of the SubjectPublicKeyInfo of a certificate.
+type pins map[[sha256.Size]byte]bool
+
+// parsePin parses the fingerprint s, which may be in the pin-sha256="..." form of RFC 7469.
+func parsePin(s string) ([sha256.Size]byte, error) {
+	var pin [sha256.Size]byte
+	s = strings.Trim(strings.TrimPrefix(s, "pin-sha256="), `"`)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return pin, fmt.Errorf("invalid SPKI fingerprint: %q", s)
+	}
+	copy(pin[:], b)
+	return pin, nil
+}
+
+// verify returns an error when none of the certificates presented in cs has a key in p.
+func (p pins) verify(cs tls.ConnectionState) error {
+	for _, cert := range cs.PeerCertificates {
+		if p[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+			return nil
+		}
+	}
+	return fmt.Errorf("no certificate of %s matches the SPKI fingerprints", cs.ServerName)
+}
+
+// tlsConfigFor returns the TLS config for the upstream with address addr: a copy of f.tlsConfig that checks
+// the pins of the upstream, if it has any, and counts its handshakes. As the copy shares the session
+// cache, connections to the upstream resume earlier sessions.
+func (f *Forward) tlsConfigFor(addr string) *tls.Config {
+	cfg := f.tlsConfig.Clone()
+	verify := cfg.VerifyConnection
+	p := f.pins[addr]
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		if p != nil {
+			if err := p.verify(cs); err != nil {
+				PinFailureCount.WithLabelValues(addr).Add(1)
+				return err
+			}
+		}
+		handshake := "full"
+		if cs.DidResume {
+			handshake = "resumed"
+		}
+		TLSHandshakeCount.WithLabelValues(addr, handshake).Add(1)
+		return nil
+	}
+	return cfg
+}
@@ -0,0 +1,158 @@
+package forward
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// newDoTServer starts a DNS-over-TLS server on localhost with a self-signed certificate, written to the
+// returned file, and the base64 of the SHA-256 hash of its key.
+func newDoTServer(t *testing.T) (addr, ca, pin string, stop func()) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	ca = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dns.Server{Listener: l, Net: "tcp-tls", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+		w.WriteMsg(ret)
+	})}
+	go s.ActivateAndServe()
+	return l.Addr().String(), ca, base64.StdEncoding.EncodeToString(sum[:]), func() { s.Shutdown() }
+}
+
+func TestParsePin(t *testing.T) {
+	sum := sha256.Sum256([]byte("key"))
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	for _, s := range []string{pin, `pin-sha256="` + pin + `"`} {
+		if p, err := parsePin(s); err != nil || p != sum {
+			t.Errorf("Expected %q to parse, got %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "not-base64", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := parsePin(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestTLSPin(t *testing.T) {
+	addr, ca, pin, stop := newDoTServer(t)
+	defer stop()
+	other := sha256.Sum256([]byte("other key"))
+
+	tests := []struct {
+		pins      string
+		shouldErr bool
+	}{
+		{"", false},
+		{"tls_pin tls://" + addr + " " + pin, false},
+		{"tls_pin tls://" + addr + " " + base64.StdEncoding.EncodeToString(other[:]) + " " + pin, false},
+		{"tls_pin tls://" + addr + " " + base64.StdEncoding.EncodeToString(other[:]), true},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", "forward . tls://"+addr+" {\ntls "+ca+"\n"+tc.pins+"\n}")
+		f, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create forwarder: %s", i, err)
+		}
+		f.OnStartup()
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		_, err = f.ServeDNS(context.TODO(), rec, m)
+		if tc.shouldErr && (err == nil || !strings.Contains(err.Error(), "SPKI")) {
+			t.Errorf("Test %d: expected an SPKI error, got %v", i, err)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected a reply, got %s", i, err)
+		}
+		f.OnShutdown()
+	}
+}
+
+func TestTLSResumption(t *testing.T) {
+	addr, ca, _, stop := newDoTServer(t)
+	defer stop()
+
+	c := caddy.NewTestController("dns", "forward . tls://"+addr+" {\ntls "+ca+"\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	// The first query does a full handshake, and reads the session ticket with the reply.
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	if _, err := f.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+		t.Fatalf("Expected a reply, got %s", err)
+	}
+
+	// Take the cached connection, so the next one is a new one.
+	tr := f.proxies[0].transport
+	pc, cached, err := tr.Dial("tcp-tls")
+	if err != nil || !cached {
+		t.Fatalf("Expected a cached connection, got %v", err)
+	}
+	defer pc.c.Close()
+	if pc.c.Conn.(*tls.Conn).ConnectionState().DidResume {
+		t.Errorf("Expected a full handshake on the first connection")
+	}
+
+	pc2, cached, err := tr.Dial("tcp-tls")
+	if err != nil || cached {
+		t.Fatalf("Expected a new connection, got %v", err)
+	}
+	defer pc2.c.Close()
+	if !pc2.c.Conn.(*tls.Conn).ConnectionState().DidResume {
+		t.Errorf("Expected the session to be resumed on the second connection")
+	}
+}
@@ -2,6 +2,7 @@ package forward
 
 import (
 	"math/rand"
+	"sort"
 	"sync/atomic"
 )
 
@@ -62,3 +63,29 @@ func (r *sequential) String() string { return "sequential" }
 func (r *sequential) List(p []*Proxy) []*Proxy {
 	return p
 }
+
+// fastest is a policy that orders hosts by their smoothed round trip time. Sometimes another host
+// is put first, so we notice when a slow host becomes fast again.
+type fastest struct {
+	probe float64 // fraction of the queries that probe another host
+}
+
+func (r *fastest) String() string { return "fastest" }
+
+func (r *fastest) List(p []*Proxy) []*Proxy {
+	fast := make([]*Proxy, len(p))
+	copy(fast, p)
+	// Hosts without a round trip time yet sort first, so they get one.
+	sort.SliceStable(fast, func(i, j int) bool { return fast[i].rtt.value() < fast[j].rtt.value() })
+
+	if len(fast) > 1 && rand.Float64() < r.probe {
+		i := 1 + rand.Intn(len(fast)-1)
+		probe := fast[i]
+		copy(fast[1:i+1], fast[:i])
+		fast[0] = probe
+	}
+	return fast
+}
+
+// defaultProbe is the fraction of the queries the fastest policy sends to another host than the fastest.
+const defaultProbe = 0.05
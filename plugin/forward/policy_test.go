@@ -0,0 +1,52 @@
+package forward
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFastest(t *testing.T) {
+	p1, p2, p3 := NewProxy("10.0.0.1:53", "dns"), NewProxy("10.0.0.2:53", "dns"), NewProxy("10.0.0.3:53", "dns")
+	p1.rtt.observe(30 * time.Millisecond)
+	p2.rtt.observe(10 * time.Millisecond)
+
+	f := &fastest{}
+	list := f.List([]*Proxy{p1, p2, p3})
+	// p3 has no round trip time yet, so it is tried first.
+	if list[0] != p3 || list[1] != p2 || list[2] != p1 {
+		t.Errorf("Expected p3, p2, p1, got %s, %s, %s", list[0].addr, list[1].addr, list[2].addr)
+	}
+
+	p3.rtt.observe(20 * time.Millisecond)
+	list = f.List([]*Proxy{p1, p2, p3})
+	if list[0] != p2 || list[1] != p3 || list[2] != p1 {
+		t.Errorf("Expected p2, p3, p1, got %s, %s, %s", list[0].addr, list[1].addr, list[2].addr)
+	}
+
+	// Always probe: another host is put first, the others stay in order.
+	f.probe = 1
+	for i := 0; i < 10; i++ {
+		list = f.List([]*Proxy{p1, p2, p3})
+		if list[0] == p2 {
+			t.Fatalf("Expected another host than p2 first")
+		}
+		if list[0] == p3 && (list[1] != p2 || list[2] != p1) || list[0] == p1 && (list[1] != p2 || list[2] != p3) {
+			t.Fatalf("Expected the other hosts in order, got %s, %s, %s", list[0].addr, list[1].addr, list[2].addr)
+		}
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	e := &ewma{}
+	if e.value() != 0 {
+		t.Errorf("Expected no round trip time, got %s", e.value())
+	}
+	e.observe(100 * time.Millisecond)
+	if e.value() != 100*time.Millisecond {
+		t.Errorf("Expected the first sample as the average, got %s", e.value())
+	}
+	e.observe(200 * time.Millisecond)
+	if e.value() != 130*time.Millisecond {
+		t.Errorf("Expected 130ms, got %s", e.value())
+	}
+}
@@ -1,12 +1,18 @@
 package forward
 
 import (
+	"context"
 	"crypto/tls"
 	"runtime"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/coredns/coredns/plugin/pkg/doh"
+	"github.com/coredns/coredns/plugin/pkg/transport"
 	"github.com/coredns/coredns/plugin/pkg/up"
+
+	"github.com/miekg/dns"
 )
 
 // Proxy defines an upstream host.
@@ -15,10 +21,24 @@ type Proxy struct {
 	addr  string
 
 	transport *Transport
+	exchanger exchanger // only set for DNS-over-QUIC and DNS-over-HTTPS upstreams
+	cookie    *clientCookie
+	qcase     *qnameCase
+	rtt       *ewma // smoothed round trip time, for the fastest policy
 
 	// health checking
-	probe  *up.Probe
-	health HealthChecker
+	probe      *up.Probe
+	health     HealthChecker
+	failRcodes []int // rcodes that fail a health check
+}
+
+// exchanger is implemented by the transports that manage their own connections instead of using the
+// connection cache in Transport: DNS-over-QUIC and DNS-over-HTTPS.
+type exchanger interface {
+	Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+	SetTLSConfig(*tls.Config)
+	SetExpire(time.Duration)
+	Stop()
 }
 
 // NewProxy returns a new proxy.
@@ -28,6 +48,21 @@ func NewProxy(addr, trans string) *Proxy {
 		fails:     0,
 		probe:     up.New(),
 		transport: newTransport(addr),
+		cookie:    newClientCookie(),
+		qcase:     &qnameCase{},
+		rtt:       &ewma{},
+	}
+	switch trans {
+	case transport.QUIC:
+		p.exchanger = newQUICTransport(addr)
+	case transport.HTTPS:
+		// For DoH the address may include the path of the endpoint.
+		host, path := addr, doh.Path
+		if i := strings.Index(addr, "/"); i > 0 {
+			host, path = addr[:i], addr[i:]
+		}
+		p.addr = host
+		p.exchanger = newDoHTransport(host, path)
 	}
 	p.health = NewHealthChecker(trans, true)
 	runtime.SetFinalizer(p, (*Proxy).finalizer)
@@ -36,12 +71,27 @@ func NewProxy(addr, trans string) *Proxy {
 
 // SetTLSConfig sets the TLS config in the lower p.transport and in the healthchecking client.
 func (p *Proxy) SetTLSConfig(cfg *tls.Config) {
+	if p.exchanger != nil {
+		p.exchanger.SetTLSConfig(cfg)
+		return
+	}
 	p.transport.SetTLSConfig(cfg)
 	p.health.SetTLSConfig(cfg)
 }
 
 // SetExpire sets the expire duration in the lower p.transport.
-func (p *Proxy) SetExpire(expire time.Duration) { p.transport.SetExpire(expire) }
+func (p *Proxy) SetExpire(expire time.Duration) {
+	p.transport.SetExpire(expire)
+	if p.exchanger != nil {
+		p.exchanger.SetExpire(expire)
+	}
+}
+
+// observe records the round trip time d of an exchange with p.
+func (p *Proxy) observe(d time.Duration) {
+	rtt := p.rtt.observe(d)
+	RTTGauge.WithLabelValues(p.addr).Set(rtt.Seconds())
+}
 
 // Healthcheck kicks of a round of health checks for this proxy.
 func (p *Proxy) Healthcheck() {
@@ -66,8 +116,17 @@ func (p *Proxy) Down(maxfails uint32) bool {
 }
 
 // close stops the health checking goroutine.
-func (p *Proxy) stop()      { p.probe.Stop() }
-func (p *Proxy) finalizer() { p.transport.Stop() }
+func (p *Proxy) stop() { p.probe.Stop() }
+
+// finalizer stops the connection manager and closes any QUIC or HTTPS connections. When called
+// directly, it clears the finalizer set by NewProxy, so the transport isn't stopped twice.
+func (p *Proxy) finalizer() {
+	runtime.SetFinalizer(p, nil)
+	p.transport.Stop()
+	if p.exchanger != nil {
+		p.exchanger.Stop()
+	}
+}
 
 // start starts the proxy's healthchecking.
 func (p *Proxy) start(duration time.Duration) {
@@ -2,10 +2,13 @@ package forward
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/transport"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/request"
@@ -69,6 +72,39 @@ func TestProxyTLSFail(t *testing.T) {
 	}
 }
 
+func TestProxyExtendedError(t *testing.T) {
+	// This is an udp/tcp test server, so we shouldn't reach it with TLS.
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	c := caddy.NewTestController("dns", "forward . tls://"+s.Addr)
+	f, err := parseForward(c)
+	if err != nil {
+		t.Errorf("Failed to create forwarder: %s", err)
+	}
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+	// The SERVFAIL is left to the server, so plugins in front don't cache it.
+	rcode, err := f.ServeDNS(context.TODO(), rec, m)
+	if rcode != dns.RcodeServerFailure || rec.Msg != nil {
+		t.Fatalf("Expected SERVFAIL to be returned and nothing written, got %d and %v", rcode, rec.Msg)
+	}
+	var ede *edns.Error
+	if !errors.As(err, &ede) || ede.Code != dns.ExtendedErrorCodeNetworkError {
+		t.Errorf("Expected a network error extended error, got %v", err)
+	}
+}
+
 func TestProtocolSelection(t *testing.T) {
 	p := NewProxy("bad_address", transport.DNS)
 
@@ -95,3 +131,41 @@ func TestProtocolSelection(t *testing.T) {
 		}
 	}
 }
+
+func TestProxyCancel(t *testing.T) {
+	defer func(r time.Duration) { readTimeout = r }(readTimeout)
+	readTimeout = 2 * time.Second
+
+	// The upstream never answers.
+	s := dnstest.NewMultipleServer(func(w dns.ResponseWriter, r *dns.Msg) {})
+	defer s.Close()
+
+	p := NewProxy(s.Addr, transport.DNS)
+	p.start(hcInterval)
+	defer p.stop()
+
+	for _, proto := range []string{"udp", "tcp"} {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		req := request.Request{Req: m, W: &test.ResponseWriter{TCP: proto == "tcp"}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		if _, err := p.Connect(ctx, req, options{}); err == nil {
+			t.Errorf("Expected an error for %s, got none", proto)
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Errorf("Expected the cancelled %s query to return right away, got %s", proto, d)
+		}
+		// The connection is closed, not given back to the cache.
+		pc, cached, err := p.transport.Dial(proto)
+		if err != nil {
+			t.Fatalf("Expected no error dialing %s, got %s", proto, err)
+		}
+		if cached {
+			t.Errorf("Expected no cached %s connection, got one", proto)
+		}
+		pc.c.Close()
+	}
+}
@@ -0,0 +1,163 @@
+package forward
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/doq"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// quicTransport keeps a single long-lived QUIC connection to a DNS-over-QUIC upstream. Each query is
+// sent on its own stream, so one connection carries all concurrent queries.
+type quicTransport struct {
+	avgDialTime int64 // kind of average time of dial time
+	addr        string
+	tlsConfig   *tls.Config
+	quicConfig  *quic.Config
+
+	mu   sync.Mutex // protects conn
+	conn quic.Connection
+}
+
+func newQUICTransport(addr string) *quicTransport {
+	return &quicTransport{
+		avgDialTime: int64(maxDialTimeout / 2),
+		addr:        addr,
+		tlsConfig:   &tls.Config{NextProtos: []string{doq.NextProto}},
+		quicConfig:  &quic.Config{MaxIdleTimeout: defaultExpire},
+	}
+}
+
+// SetTLSConfig sets the TLS config used for the QUIC handshake. The ALPN token is always set to "doq".
+func (q *quicTransport) SetTLSConfig(cfg *tls.Config) {
+	cfg = cfg.Clone()
+	cfg.NextProtos = []string{doq.NextProto}
+	q.tlsConfig = cfg
+}
+
+// SetExpire sets the idle timeout of the QUIC connection, after which it is closed.
+func (q *quicTransport) SetExpire(expire time.Duration) {
+	if expire > 0 {
+		q.quicConfig.MaxIdleTimeout = expire
+	}
+}
+
+// Dial returns the QUIC connection to the upstream, potentially reusing the existing one. The boolean
+// is true when the connection was reused.
+func (q *quicTransport) Dial(ctx context.Context) (quic.Connection, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.conn != nil {
+		select {
+		case <-q.conn.Context().Done():
+			// Closed by the upstream or idle timeout expired, dial a new one.
+			q.conn = nil
+		default:
+			ConnCacheHitsCount.WithLabelValues(q.addr, "quic").Add(1)
+			return q.conn, true, nil
+		}
+	}
+	ConnCacheMissesCount.WithLabelValues(q.addr, "quic").Add(1)
+
+	reqTime := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, limitTimeout(&q.avgDialTime, minDialTimeout, maxDialTimeout))
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, q.addr, q.tlsConfig, q.quicConfig)
+	averageTimeout(&q.avgDialTime, time.Since(reqTime), cumulativeAvgWeight)
+	if err != nil {
+		return nil, false, err
+	}
+	q.conn = conn
+	return conn, false, nil
+}
+
+// Exchange sends m on a new stream and waits for the response.
+func (q *quicTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// The message ID must be 0 and the edns-tcp-keepalive option must not be sent, see section
+	// 4.2.1 and 5.5.2 of RFC 9250. Work on a copy so the client's message stays intact.
+	req := m.Copy()
+	req.Id = 0
+	if o := req.IsEdns0(); o != nil {
+		opts := o.Option[:0]
+		for _, e := range o.Option {
+			if e.Option() != dns.EDNS0TCPKEEPALIVE {
+				opts = append(opts, e)
+			}
+		}
+		o.Option = opts
+	}
+	buf, err := doq.Pack(req)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, cached, err := q.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := q.openStream(ctx, conn)
+	if err != nil {
+		q.closeConn(conn)
+		if !cached {
+			return nil, err
+		}
+		// The cached connection is gone, try once more with a fresh one.
+		if conn, _, err = q.Dial(ctx); err != nil {
+			return nil, err
+		}
+		if stream, err = q.openStream(ctx, conn); err != nil {
+			q.closeConn(conn)
+			return nil, err
+		}
+	}
+
+	stream.SetWriteDeadline(time.Now().Add(maxTimeout))
+	if _, err := stream.Write(buf); err != nil {
+		stream.CancelRead(quic.StreamErrorCode(doq.CodeInternalError))
+		return nil, err
+	}
+	// Only one query per stream, indicate we are done sending with a STREAM FIN.
+	stream.Close()
+
+	stream.SetReadDeadline(time.Now().Add(readTimeout))
+	ret, err := doq.ReadMsg(stream)
+	if err != nil {
+		stream.CancelRead(quic.StreamErrorCode(doq.CodeRequestCancelled))
+		return nil, err
+	}
+	ret.Id = m.Id
+	return ret, nil
+}
+
+func (q *quicTransport) openStream(ctx context.Context, conn quic.Connection) (quic.Stream, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxTimeout)
+	defer cancel()
+	return conn.OpenStreamSync(ctx)
+}
+
+// closeConn closes conn and forgets it, if it is still the current connection.
+func (q *quicTransport) closeConn(conn quic.Connection) {
+	q.mu.Lock()
+	if q.conn == conn {
+		q.conn = nil
+	}
+	q.mu.Unlock()
+	conn.CloseWithError(doq.CodeNoError, "")
+}
+
+// Stop closes the QUIC connection.
+func (q *quicTransport) Stop() {
+	q.mu.Lock()
+	conn := q.conn
+	q.conn = nil
+	q.mu.Unlock()
+	if conn != nil {
+		conn.CloseWithError(doq.CodeNoError, "")
+	}
+}
@@ -0,0 +1,152 @@
+package forward
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/doq"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// newDoQServer starts a DNS-over-QUIC server on localhost that answers with f. The returned
+// address should be prefixed with "quic://" when used in forward.
+func newDoQServer(t *testing.T, f func(*dns.Msg) *dns.Msg) (string, func()) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour), DNSNames: []string{"localhost"}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{doq.NextProto},
+	}
+
+	l, err := quic.ListenAddr("127.0.0.1:0", tlsConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					r, err := doq.ReadMsg(stream)
+					if err != nil {
+						stream.Close()
+						continue
+					}
+					buf, _ := doq.Pack(f(r))
+					stream.Write(buf)
+					stream.Close()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestProxyQUIC(t *testing.T) {
+	readTimeout = 1 * time.Second
+	defaultTimeout = 5 * time.Second
+
+	var ids uint32
+	addr, stop := newDoQServer(t, func(r *dns.Msg) *dns.Msg {
+		if r.Id != 0 {
+			atomic.AddUint32(&ids, 1)
+		}
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+		return ret
+	})
+	defer stop()
+
+	c := caddy.NewTestController("dns", "forward . quic://"+addr)
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f.proxies[0].exchanger.(*quicTransport).tlsConfig.InsecureSkipVerify = true
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	for i := 0; i < 3; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		m.Id = 1234
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Expected to receive reply, but didn't: %s", err)
+		}
+		if x := rec.Msg.Answer[0].Header().Name; x != "example.org." {
+			t.Errorf("Expected %s, got %s", "example.org.", x)
+		}
+		if rec.Msg.Id != 1234 {
+			t.Errorf("Expected reply to have ID %d, got %d", 1234, rec.Msg.Id)
+		}
+	}
+	if x := atomic.LoadUint32(&ids); x != 0 {
+		t.Errorf("Expected all DoQ queries to have ID 0, got %d with non-zero ID", x)
+	}
+}
+
+func TestHealthQUIC(t *testing.T) {
+	readTimeout = 1 * time.Second
+
+	var hc uint32
+	addr, stop := newDoQServer(t, func(r *dns.Msg) *dns.Msg {
+		if r.Question[0].Name == "." && r.Question[0].Qtype == dns.TypeNS {
+			atomic.AddUint32(&hc, 1)
+		}
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		return ret
+	})
+	defer stop()
+
+	p := NewProxy(addr, transport.QUIC)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	defer p.exchanger.Stop()
+
+	if err := p.health.Check(p); err != nil {
+		t.Fatalf("Expected healthy upstream, got: %s", err)
+	}
+	if x := atomic.LoadUint32(&hc); x != 1 {
+		t.Errorf("Expected %d health check, got %d", 1, x)
+	}
+
+	stop()
+	p.exchanger.Stop()
+	if err := p.health.Check(p); err == nil {
+		t.Error("Expected failed health check, got none")
+	}
+	if x := atomic.LoadUint32(&p.fails); x != 1 {
+		t.Errorf("Expected %d fails, got %d", 1, x)
+	}
+}
@@ -0,0 +1,291 @@
+package forward
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
+)
+
+// group is a named set of upstreams that domains can be routed to.
+type group struct {
+	name       string
+	proxies    []*Proxy
+	transports []string
+}
+
+// router routes queries to a group of upstreams, on the longest domain suffix listed in its files.
+// Groups are defined in the Corefile, or made up of the addresses in the files; these are shared by
+// all domains with the same addresses.
+type router struct {
+	files  []string
+	reload time.Duration
+	groups map[string]*group // groups from the Corefile, by name
+
+	sync.RWMutex
+	routes  map[string]*group // domain -> group, nil for the upstreams of the forward itself
+	dynamic map[string]*group // groups made from addresses in the files, by address list
+	mtimes  map[string]time.Time
+	sizes   map[string]int64
+
+	stop chan struct{}
+}
+
+// route returns the upstreams for name, or nil when no domain in the files matches.
+func (r *router) route(name string) ([]*Proxy, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if g, ok := r.routes[name[off:]]; ok {
+			if g == nil {
+				return nil, true
+			}
+			return g.proxies, true
+		}
+	}
+	return nil, false
+}
+
+// readRoutes parses the domain to upstream mapping in rd. Two formats are understood, the server
+// lines of dnsmasq:
+//
+//	server=/example.org/example.net/10.0.0.1#5353
+//
+// and a simple list, with one domain and its targets per line:
+//
+//	example.org 10.0.0.1 10.0.0.2:5353
+//	example.net corp
+//
+// A target is the name of a group, or an address. In the dnsmasq format an empty target, or "#",
+// routes the domains to the upstreams of the forward itself. Lines starting with a # are comments.
+// The targets are returned per domain.
+func readRoutes(rd io.Reader) (map[string][]string, error) {
+	routes := map[string][]string{}
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		for i, f := range fields {
+			if strings.HasPrefix(f, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(fields[0], "server=") {
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("line %d: invalid server line", n)
+			}
+			parts := strings.Split(strings.TrimPrefix(fields[0], "server="), "/")
+			if len(parts) < 3 || parts[0] != "" {
+				return nil, fmt.Errorf("line %d: server line without domain", n)
+			}
+			target := parts[len(parts)-1]
+			if target == "#" {
+				target = ""
+			}
+			for _, d := range parts[1 : len(parts)-1] {
+				if d == "" {
+					continue
+				}
+				d = plugin.Name(d).Normalize()
+				routes[d] = append(routes[d], target)
+			}
+			continue
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: domain without target", n)
+		}
+		d := plugin.Name(fields[0]).Normalize()
+		routes[d] = append(routes[d], fields[1:]...)
+	}
+	return routes, scanner.Err()
+}
+
+// load reads all files and replaces the routes. Groups made from addresses that are no longer used are
+// stopped, new ones are configured with f and started.
+func (r *router) load(f *Forward) error {
+	targets := map[string][]string{}
+	for _, file := range r.files {
+		fh, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		routes, err := readRoutes(fh)
+		fh.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		for d, t := range routes {
+			targets[d] = append(targets[d], t...)
+		}
+	}
+
+	routes := make(map[string]*group, len(targets))
+	r.RLock()
+	dynamic := make(map[string]*group, len(r.dynamic))
+	for d, ts := range targets {
+		g, err := r.lookup(f, ts, dynamic)
+		if err != nil {
+			r.RUnlock()
+			return fmt.Errorf("%s: %s", d, err)
+		}
+		routes[d] = g
+	}
+	started := []*group{}
+	for key, g := range dynamic {
+		if r.dynamic[key] != g {
+			started = append(started, g)
+		}
+	}
+	r.RUnlock()
+
+	for _, g := range started {
+		for _, p := range g.proxies {
+			p.start(f.hcInterval)
+		}
+	}
+
+	r.Lock()
+	old := r.dynamic
+	r.routes, r.dynamic = routes, dynamic
+	r.Unlock()
+
+	for key, g := range old {
+		if _, ok := dynamic[key]; !ok {
+			for _, p := range g.proxies {
+				p.stop()
+			}
+		}
+	}
+	RouteCount.WithLabelValues(f.from).Set(float64(len(routes)))
+	return nil
+}
+
+// lookup returns the group for the targets ts of a domain: a group from the Corefile, nil for the
+// upstreams of the forward itself, or a group of addresses. Groups of addresses are taken from r.dynamic
+// when they already exist, and added to dynamic. The caller must hold a read lock.
+func (r *router) lookup(f *Forward, ts []string, dynamic map[string]*group) (*group, error) {
+	if len(ts) == 1 {
+		if ts[0] == "" {
+			return nil, nil
+		}
+		if g, ok := r.groups[ts[0]]; ok {
+			return g, nil
+		}
+	}
+
+	addrs := make([]string, 0, len(ts))
+	for _, t := range ts {
+		if _, ok := r.groups[t]; ok || t == "" {
+			return nil, fmt.Errorf("a group can't be combined with other targets")
+		}
+		addr, err := parse.HostPort(strings.Replace(t, "#", ":", 1), transport.Port)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) > max {
+		return nil, fmt.Errorf("more than %d TOs configured: %d", max, len(addrs))
+	}
+	sort.Strings(addrs)
+	key := strings.Join(addrs, ",")
+
+	if g, ok := dynamic[key]; ok {
+		return g, nil
+	}
+	g, ok := r.dynamic[key]
+	if !ok {
+		g = &group{name: key}
+		for _, addr := range addrs {
+			p := NewProxy(addr, transport.DNS)
+			f.configure(p, transport.DNS)
+			g.proxies = append(g.proxies, p)
+			g.transports = append(g.transports, transport.DNS)
+		}
+	}
+	dynamic[key] = g
+	return g, nil
+}
+
+// changed returns true when any of the files changed since they were loaded.
+func (r *router) changed() bool {
+	changed := false
+	for _, file := range r.files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !r.mtimes[file].Equal(stat.ModTime()) || r.sizes[file] != stat.Size() {
+			r.mtimes[file], r.sizes[file] = stat.ModTime(), stat.Size()
+			changed = true
+		}
+	}
+	return changed
+}
+
+// start loads the files, and reloads them when they change, until stopped.
+func (r *router) start(f *Forward) error {
+	r.mtimes, r.sizes = map[string]time.Time{}, map[string]int64{}
+	r.changed()
+	if err := r.load(f); err != nil {
+		return err
+	}
+	r.stop = make(chan struct{})
+	if r.reload == 0 {
+		return nil
+	}
+	go func(stop chan struct{}) {
+		tick := time.NewTicker(r.reload)
+		defer tick.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tick.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.load(f); err != nil {
+					log.Warningf("Failed to reload routes, keeping the old ones: %s", err)
+					continue
+				}
+				log.Infof("Reloaded routes from %s", strings.Join(r.files, ", "))
+			}
+		}
+	}(r.stop)
+	return nil
+}
+
+// shutdown stops reloading and stops the groups of addresses.
+func (r *router) shutdown() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	for _, g := range r.dynamic {
+		for _, p := range g.proxies {
+			p.stop()
+		}
+	}
+	r.dynamic = nil
+}
+
+// defaultRouteReload is how often the route files are checked for changes.
+const defaultRouteReload = 5 * time.Second
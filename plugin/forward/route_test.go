@@ -0,0 +1,118 @@
+package forward
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestReadRoutes(t *testing.T) {
+	const routes = `# dnsmasq
+server=/corp.example.org/lab.example.org/10.0.0.1
+server=/corp.example.org/10.0.0.2#5353
+server=/public.corp.example.org/#
+server=/Other.Example.org/
+
+# simple list
+example.net 10.0.0.3 # comment
+example.com corp
+`
+	got, err := readRoutes(strings.NewReader(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"corp.example.org.":        {"10.0.0.1", "10.0.0.2#5353"},
+		"lab.example.org.":         {"10.0.0.1"},
+		"public.corp.example.org.": {""},
+		"other.example.org.":       {""},
+		"example.net.":             {"10.0.0.3"},
+		"example.com.":             {"corp"},
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d domains, got %d: %v", len(expected), len(got), got)
+	}
+	for d, ts := range expected {
+		if strings.Join(got[d], " ") != strings.Join(ts, " ") {
+			t.Errorf("Expected %v for %s, got %v", ts, d, got[d])
+		}
+	}
+
+	for _, bad := range []string{"server=10.0.0.1", "server=/example.org/10.0.0.1 extra", "example.org"} {
+		if _, err := readRoutes(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	def := answer(dns.RcodeSuccess, "127.0.0.1", 0, nil)
+	corp := answer(dns.RcodeSuccess, "127.0.0.2", 0, nil)
+	lab := answer(dns.RcodeSuccess, "127.0.0.3", 0, nil)
+	defer def.Close()
+	defer corp.Close()
+	defer lab.Close()
+
+	file := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(file, []byte("corp.example.org corp\nserver=/lab.corp.example.org/"+strings.Replace(lab.Addr, ":", "#", 1)+"\nserver=/public.corp.example.org/#\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("dns", "forward . "+def.Addr+" {\ngroup corp "+corp.Addr+"\nroutes "+file+"\nroutes_reload 10ms\n}")
+	f, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	if err := f.OnStartup(); err != nil {
+		t.Fatalf("Failed to start forwarder: %s", err)
+	}
+	defer f.OnShutdown()
+
+	query := func(name string) string {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Expected a reply for %s, got %s", name, err)
+		}
+		return rec.Msg.Answer[0].(*dns.A).A.String()
+	}
+
+	tests := []struct {
+		name   string
+		answer string
+	}{
+		{"example.org.", "127.0.0.1"},
+		{"corp.example.org.", "127.0.0.2"},
+		{"www.corp.example.org.", "127.0.0.2"},
+		{"www.lab.corp.example.org.", "127.0.0.3"}, // longest suffix
+		{"www.public.corp.example.org.", "127.0.0.1"},
+		{"xcorp.example.org.", "127.0.0.1"},
+	}
+	for _, tc := range tests {
+		if x := query(tc.name); x != tc.answer {
+			t.Errorf("Expected %s for %s, got %s", tc.answer, tc.name, x)
+		}
+	}
+
+	// Route everything in the file to lab now.
+	if err := os.WriteFile(file, []byte("server=/corp.example.org/"+strings.Replace(lab.Addr, ":", "#", 1)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if query("www.corp.example.org.") == "127.0.0.3" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected the routes to be reloaded")
+}
@@ -0,0 +1,38 @@
+package forward
+
+import (
+	"sync"
+	"time"
+)
+
+// ewma is an exponentially weighted moving average of the round trip time of an upstream.
+type ewma struct {
+	sync.RWMutex
+	rtt float64 // nanoseconds, zero until the first sample
+}
+
+// observe adds the round trip time d to the average, and returns the new average.
+func (e *ewma) observe(d time.Duration) time.Duration {
+	e.Lock()
+	defer e.Unlock()
+	if e.rtt == 0 {
+		e.rtt = float64(d)
+	} else {
+		e.rtt = ewmaWeight*float64(d) + (1-ewmaWeight)*e.rtt
+	}
+	return time.Duration(e.rtt)
+}
+
+// value returns the average, zero when there are no samples yet.
+func (e *ewma) value() time.Duration {
+	e.RLock()
+	defer e.RUnlock()
+	return time.Duration(e.rtt)
+}
+
+const (
+	// ewmaWeight is the weight of a new sample.
+	ewmaWeight = 0.3
+	// rttPenalty is the round trip time a failed exchange counts as.
+	rttPenalty = maxTimeout
+)
@@ -4,7 +4,11 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -12,8 +16,11 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/dnstap"
 	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/singleflight"
 	pkgtls "github.com/coredns/coredns/plugin/pkg/tls"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
 )
 
 func init() { plugin.Register("forward", setup) }
@@ -56,6 +63,14 @@ func (f *Forward) OnStartup() (err error) {
 	for _, p := range f.proxies {
 		p.start(f.hcInterval)
 	}
+	if f.router != nil {
+		for _, g := range f.router.groups {
+			for _, p := range g.proxies {
+				p.start(f.hcInterval)
+			}
+		}
+		return f.router.start(f)
+	}
 	return nil
 }
 
@@ -64,9 +79,33 @@ func (f *Forward) OnShutdown() error {
 	for _, p := range f.proxies {
 		p.stop()
 	}
+	if f.router != nil {
+		for _, g := range f.router.groups {
+			for _, p := range g.proxies {
+				p.stop()
+			}
+		}
+		f.router.shutdown()
+	}
 	return nil
 }
 
+// newECS returns the EDNS Client Subnet settings of f, creating them if needed.
+func (f *Forward) newECS() *ecs {
+	if f.ecs == nil {
+		f.ecs = &ecs{prefix4: defaultECSPrefix4, prefix6: defaultECSPrefix6}
+	}
+	return f.ecs
+}
+
+// newRouter returns the router of f, creating it if needed.
+func (f *Forward) newRouter() *router {
+	if f.router == nil {
+		f.router = &router{reload: defaultRouteReload, groups: map[string]*group{}}
+	}
+	return f.router
+}
+
 func parseForward(c *caddy.Controller) (*Forward, error) {
 	var (
 		f   *Forward
@@ -86,8 +125,31 @@ func parseForward(c *caddy.Controller) (*Forward, error) {
 	return f, nil
 }
 
+// newProxies returns the proxies for the upstreams in to, and their transports.
+func newProxies(to []string) ([]*Proxy, []string, error) {
+	toHosts, err := parse.HostPortOrFile(to...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proxies := make([]*Proxy, len(toHosts))
+	transports := make([]string, len(toHosts))
+	allowedTrans := map[string]bool{"dns": true, "tls": true, "quic": true, "https": true}
+	for i, host := range toHosts {
+		trans, h := parse.Transport(host)
+
+		if !allowedTrans[trans] {
+			return nil, nil, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
+		}
+		proxies[i] = NewProxy(h, trans)
+		transports[i] = trans
+	}
+	return proxies, transports, nil
+}
+
 func parseStanza(c *caddy.Controller) (*Forward, error) {
 	f := New()
+	var err error
 
 	if !c.Args(&f.from) {
 		return f, c.ArgErr()
@@ -104,24 +166,12 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 		return f, c.ArgErr()
 	}
 
-	toHosts, err := parse.HostPortOrFile(to...)
+	var transports []string
+	f.proxies, transports, err = newProxies(to)
 	if err != nil {
 		return f, err
 	}
 
-	transports := make([]string, len(toHosts))
-	allowedTrans := map[string]bool{"dns": true, "tls": true}
-	for i, host := range toHosts {
-		trans, h := parse.Transport(host)
-
-		if !allowedTrans[trans] {
-			return f, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
-		}
-		p := NewProxy(h, trans)
-		f.proxies = append(f.proxies, p)
-		transports[i] = trans
-	}
-
 	for c.NextBlock() {
 		if err := parseBlock(c, f); err != nil {
 			return f, err
@@ -134,20 +184,63 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 
 	// Initialize ClientSessionCache in tls.Config. This may speed up a TLS handshake
 	// in upcoming connections to the same TLS server.
-	f.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(len(f.proxies))
+	n := len(f.proxies)
+	if f.router != nil {
+		for _, g := range f.router.groups {
+			n += len(g.proxies)
+		}
+	}
+	f.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(n)
 
+	tlsAddrs := map[string]bool{}
 	for i := range f.proxies {
-		// Only set this for proxies that need it.
-		if transports[i] == transport.TLS {
-			f.proxies[i].SetTLSConfig(f.tlsConfig)
+		f.configure(f.proxies[i], transports[i])
+		tlsAddrs[f.proxies[i].addr] = tlsAddrs[f.proxies[i].addr] || isTLS(transports[i])
+	}
+	if f.router != nil {
+		if len(f.router.files) == 0 && len(f.router.groups) > 0 {
+			return f, errors.New("group without routes")
+		}
+		if len(f.router.files) == 0 {
+			return f, errors.New("routes_reload without routes")
+		}
+		for _, g := range f.router.groups {
+			for i := range g.proxies {
+				f.configure(g.proxies[i], g.transports[i])
+				tlsAddrs[g.proxies[i].addr] = tlsAddrs[g.proxies[i].addr] || isTLS(g.transports[i])
+			}
+		}
+	}
+	for addr := range f.pins {
+		if !tlsAddrs[addr] {
+			return f, fmt.Errorf("tls_pin for %s, which is not a TLS upstream", addr)
 		}
-		f.proxies[i].SetExpire(f.expire)
-		f.proxies[i].health.SetRecursionDesired(f.opts.hcRecursionDesired)
 	}
 
 	return f, nil
 }
 
+// isTLS returns true when the transport trans uses TLS.
+func isTLS(trans string) bool {
+	return trans == transport.TLS || trans == transport.QUIC || trans == transport.HTTPS
+}
+
+// configure applies the settings of f to the proxy p, which uses transport trans.
+func (f *Forward) configure(p *Proxy, trans string) {
+	// Only set this for proxies that need it.
+	if isTLS(trans) {
+		p.SetTLSConfig(f.tlsConfigFor(p.addr))
+	}
+	if d, ok := p.exchanger.(*dohTransport); ok {
+		d.SetMethod(f.httpsMethod)
+	}
+	p.SetExpire(f.expire)
+	p.health.SetRecursionDesired(f.opts.hcRecursionDesired)
+	if f.failoverFails {
+		p.failRcodes = f.failover
+	}
+}
+
 func parseBlock(c *caddy.Controller, f *Forward) error {
 	switch c.Val() {
 	case "except":
@@ -202,6 +295,21 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			return c.ArgErr()
 		}
 		f.opts.preferUDP = true
+	case "cookie":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		f.opts.cookie = true
+	case "randomize_case":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		f.opts.randomizeCase = true
+	case "coalesce":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		f.inflight = new(singleflight.Group)
 	case "tls":
 		args := c.RemainingArgs()
 		if len(args) > 3 {
@@ -213,11 +321,47 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			return err
 		}
 		f.tlsConfig = tlsConfig
+	case "tls_pin":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		proxies, _, err := newProxies(args[:1])
+		if err != nil {
+			return err
+		}
+		if len(proxies) != 1 {
+			return fmt.Errorf("tls_pin needs a single upstream: %s", args[0])
+		}
+		addr := proxies[0].addr
+		if f.pins == nil {
+			f.pins = map[string]pins{}
+		}
+		if f.pins[addr] == nil {
+			f.pins[addr] = pins{}
+		}
+		for _, arg := range args[1:] {
+			pin, err := parsePin(arg)
+			if err != nil {
+				return err
+			}
+			f.pins[addr][pin] = true
+		}
 	case "tls_servername":
 		if !c.NextArg() {
 			return c.ArgErr()
 		}
 		f.tlsServerName = c.Val()
+	case "https_method":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch x := strings.ToUpper(c.Val()); x {
+		case http.MethodGet, http.MethodPost:
+			f.httpsMethod = x
+		default:
+			return c.Errf("unknown https_method '%s'", c.Val())
+		}
 	case "expire":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -241,9 +385,138 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			f.p = &roundRobin{}
 		case "sequential":
 			f.p = &sequential{}
+		case "fastest":
+			f.p = &fastest{probe: defaultProbe}
 		default:
 			return c.Errf("unknown policy '%s'", x)
 		}
+	case "hedge":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		if dur < 0 {
+			return fmt.Errorf("hedge delay can't be negative: %s", dur)
+		}
+		f.hedgeDelay, f.hedgeMax = dur, defaultHedgeMax
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return err
+			}
+			if n < 2 {
+				return fmt.Errorf("hedge max should be at least 2: %d", n)
+			}
+			f.hedgeMax = n
+		}
+	case "group":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		r := f.newRouter()
+		if _, ok := r.groups[args[0]]; ok {
+			return fmt.Errorf("group %s defined twice", args[0])
+		}
+		proxies, transports, err := newProxies(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(proxies) > max {
+			return fmt.Errorf("more than %d TOs configured in group %s: %d", max, args[0], len(proxies))
+		}
+		r.groups[args[0]] = &group{name: args[0], proxies: proxies, transports: transports}
+	case "routes":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		r := f.newRouter()
+		config := dnsserver.GetConfig(c)
+		for _, file := range args {
+			if !filepath.IsAbs(file) && config.Root != "" {
+				file = filepath.Join(config.Root, file)
+			}
+			r.files = append(r.files, file)
+		}
+	case "routes_reload":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur < 0 {
+			return fmt.Errorf("routes_reload can't be negative: %s", dur)
+		}
+		f.newRouter().reload = dur
+	case "failover":
+		args := c.RemainingArgs()
+		if len(args) > 0 && args[len(args)-1] == "count_fails" {
+			f.failoverFails = true
+			args = args[:len(args)-1]
+		}
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		for _, rcode := range args {
+			rc, ok := dns.StringToRcode[strings.ToUpper(rcode)]
+			if !ok {
+				return fmt.Errorf("%s is not a valid rcode", rcode)
+			}
+			if rc == dns.RcodeSuccess {
+				return fmt.Errorf("NOERROR can't be used in failover")
+			}
+			f.failover = append(f.failover, rc)
+		}
+	case "ecs":
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return c.ArgErr()
+		}
+		e := f.newECS()
+		e.add = true
+		for i, arg := range args {
+			bits := []int{net.IPv4len * 8, net.IPv6len * 8}[i]
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return err
+			}
+			if n < 0 || n > bits {
+				return fmt.Errorf("ecs prefix length must be between 0 and %d: %d", bits, n)
+			}
+			if i == 0 {
+				e.prefix4 = uint8(n)
+			} else {
+				e.prefix6 = uint8(n)
+			}
+		}
+	case "ecs_client":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch c.Val() {
+		case "preserve":
+			f.newECS().strip = false
+		case "strip":
+			f.newECS().strip = true
+		default:
+			return c.Errf("unknown ecs_client '%s'", c.Val())
+		}
+	case "ecs_zones":
+		zones := c.RemainingArgs()
+		if len(zones) == 0 {
+			return c.ArgErr()
+		}
+		e := f.newECS()
+		for _, z := range zones {
+			e.zones = append(e.zones, plugin.Host(z).NormalizeExact()...)
+		}
 	case "max_concurrent":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -6,8 +6,11 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
+
+	"github.com/miekg/dns"
 )
 
 func TestSetup(t *testing.T) {
@@ -27,18 +30,26 @@ func TestSetup(t *testing.T) {
 		{"forward . 127.0.0.1 {\nforce_tcp\n}\n", false, ".", nil, 2, options{forceTCP: true, hcRecursionDesired: true}, ""},
 		{"forward . 127.0.0.1 {\nprefer_udp\n}\n", false, ".", nil, 2, options{preferUDP: true, hcRecursionDesired: true}, ""},
 		{"forward . 127.0.0.1 {\nforce_tcp\nprefer_udp\n}\n", false, ".", nil, 2, options{preferUDP: true, forceTCP: true, hcRecursionDesired: true}, ""},
+		{"forward . 127.0.0.1 {\ncookie\n}\n", false, ".", nil, 2, options{cookie: true, hcRecursionDesired: true}, ""},
+		{"forward . 127.0.0.1 {\nrandomize_case\n}\n", false, ".", nil, 2, options{randomizeCase: true, hcRecursionDesired: true}, ""},
+		{"forward . 127.0.0.1 {\ncoalesce\n}\n", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward . 127.0.0.1:53", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward . 127.0.0.1:8080", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward . [::1]:53", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward . [2003::1]:53", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward . 127.0.0.1 \n", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		{"forward 10.9.3.0/18 127.0.0.1", false, "0.9.10.in-addr.arpa.", nil, 2, options{hcRecursionDesired: true}, ""},
+		{"forward . quic://127.0.0.1", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
+		{"forward . https://127.0.0.1", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
+		{"forward . https://127.0.0.1/dns-query {\nhttps_method get\n}\n", false, ".", nil, 2, options{hcRecursionDesired: true}, ""},
 		// negative
 		{"forward . a27.0.0.1", true, "", nil, 0, options{hcRecursionDesired: true}, "not an IP"},
 		{"forward . 127.0.0.1 {\nblaatl\n}\n", true, "", nil, 0, options{hcRecursionDesired: true}, "unknown property"},
 		{`forward . ::1
 		forward com ::2`, true, "", nil, 0, options{hcRecursionDesired: true}, "plugin"},
-		{"forward . https://127.0.0.1 \n", true, ".", nil, 2, options{hcRecursionDesired: true}, "'https' is not supported as a destination protocol in forward: https://127.0.0.1"},
+		{"forward . grpc://127.0.0.1 \n", true, ".", nil, 2, options{hcRecursionDesired: true}, "'grpc' is not supported as a destination protocol in forward: grpc://127.0.0.1"},
+		{"forward . https://127.0.0.1 {\nhttps_method put\n}\n", true, ".", nil, 2, options{hcRecursionDesired: true}, "unknown https_method"},
+		{"forward . 127.0.0.1 {\ncoalesce all\n}\n", true, ".", nil, 2, options{hcRecursionDesired: true}, "Wrong argument count"},
 	}
 
 	for i, test := range tests {
@@ -94,6 +105,27 @@ func TestSetupTLS(t *testing.T) {
 				tls
 			}`, false, "", ""},
 		{`forward . tls://127.0.0.1`, false, "", ""},
+		{`forward . tls://127.0.0.1 {
+				tls_pin tls://127.0.0.1 pin-sha256="47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+			}`, false, "", ""},
+		{`forward . tls://127.0.0.1 {
+				group corp tls://10.0.0.1
+				routes routes
+				tls_pin tls://10.0.0.1 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+			}`, false, "", ""},
+		// negative
+		{`forward . tls://127.0.0.1 {
+				tls_pin tls://127.0.0.1
+			}`, true, "", "Wrong argument count"},
+		{`forward . tls://127.0.0.1 {
+				tls_pin tls://127.0.0.1 broken
+			}`, true, "", "invalid SPKI fingerprint"},
+		{`forward . 127.0.0.1 {
+				tls_pin 127.0.0.1 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+			}`, true, "", "not a TLS upstream"},
+		{`forward . tls://127.0.0.1 {
+				tls_pin tls://127.0.0.2 47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+			}`, true, "", "not a TLS upstream"},
 	}
 
 	for i, test := range tests {
@@ -219,6 +251,191 @@ func TestSetupMaxConcurrent(t *testing.T) {
 	}
 }
 
+func TestSetupHedge(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expectedDelay time.Duration
+		expectedMax   int
+		expectedErr   string
+	}{
+		// positive
+		{"forward . 127.0.0.1 {\nhedge 100ms\n}\n", false, 100 * time.Millisecond, defaultHedgeMax, ""},
+		{"forward . 127.0.0.1 {\nhedge 0 3\n}\n", false, 0, 3, ""},
+		// negative
+		{"forward . 127.0.0.1 {\nhedge\n}\n", true, 0, 0, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nhedge -1s\n}\n", true, 0, 0, "negative"},
+		{"forward . 127.0.0.1 {\nhedge 1s 1\n}\n", true, 0, 0, "at least 2"},
+		{"forward . 127.0.0.1 {\nhedge 1s many\n}\n", true, 0, 0, "invalid"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		f, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if !test.shouldErr && (f.hedgeDelay != test.expectedDelay || f.hedgeMax != test.expectedMax) {
+			t.Errorf("Test %d: expected: %s %d, got: %s %d", i, test.expectedDelay, test.expectedMax, f.hedgeDelay, f.hedgeMax)
+		}
+	}
+}
+
+func TestSetupFailover(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expectedCodes []int
+		expectedFails bool
+		expectedErr   string
+	}{
+		// positive
+		{"forward . 127.0.0.1 {\nfailover SERVFAIL\n}\n", false, []int{dns.RcodeServerFailure}, false, ""},
+		{"forward . 127.0.0.1 {\nfailover servfail REFUSED count_fails\n}\n", false, []int{dns.RcodeServerFailure, dns.RcodeRefused}, true, ""},
+		// negative
+		{"forward . 127.0.0.1 {\nfailover\n}\n", true, nil, false, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nfailover count_fails\n}\n", true, nil, false, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nfailover NOERROR\n}\n", true, nil, false, "NOERROR"},
+		{"forward . 127.0.0.1 {\nfailover BROKEN\n}\n", true, nil, false, "not a valid rcode"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		f, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if !test.shouldErr {
+			if !reflect.DeepEqual(f.failover, test.expectedCodes) || f.failoverFails != test.expectedFails {
+				t.Errorf("Test %d: expected: %v %t, got: %v %t", i, test.expectedCodes, test.expectedFails, f.failover, f.failoverFails)
+			}
+			if x := f.proxies[0].failRcodes; test.expectedFails != (x != nil) {
+				t.Errorf("Test %d: expected the health check rcodes to be set: %t, got %v", i, test.expectedFails, x)
+			}
+		}
+	}
+}
+
+func TestSetupECS(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		expected    *ecs
+		expectedErr string
+	}{
+		// positive
+		{"forward . 127.0.0.1\n", false, nil, ""},
+		{"forward . 127.0.0.1 {\necs\n}\n", false, &ecs{add: true, prefix4: defaultECSPrefix4, prefix6: defaultECSPrefix6}, ""},
+		{"forward . 127.0.0.1 {\necs 16 48\necs_client strip\n}\n", false, &ecs{add: true, prefix4: 16, prefix6: 48, strip: true}, ""},
+		{"forward . 127.0.0.1 {\necs_client strip\n}\n", false, &ecs{prefix4: defaultECSPrefix4, prefix6: defaultECSPrefix6, strip: true}, ""},
+		{"forward . 127.0.0.1 {\necs 0\necs_zones example.org Example.NET\n}\n", false, &ecs{add: true, prefix6: defaultECSPrefix6, zones: []string{"example.org.", "example.net."}}, ""},
+		// negative
+		{"forward . 127.0.0.1 {\necs 24 56 0\n}\n", true, nil, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\necs 33\n}\n", true, nil, "between 0 and 32"},
+		{"forward . 127.0.0.1 {\necs 24 129\n}\n", true, nil, "between 0 and 128"},
+		{"forward . 127.0.0.1 {\necs many\n}\n", true, nil, "invalid"},
+		{"forward . 127.0.0.1 {\necs_client\n}\n", true, nil, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\necs_client replace\n}\n", true, nil, "unknown ecs_client"},
+		{"forward . 127.0.0.1 {\necs_zones\n}\n", true, nil, "Wrong argument count"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		f, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if !test.shouldErr && !reflect.DeepEqual(f.ecs, test.expected) {
+			t.Errorf("Test %d: expected: %+v, got: %+v", i, test.expected, f.ecs)
+		}
+	}
+}
+
+func TestSetupRoutes(t *testing.T) {
+	tests := []struct {
+		input          string
+		shouldErr      bool
+		expectedFiles  int
+		expectedGroups int
+		expectedReload time.Duration
+		expectedErr    string
+	}{
+		// positive
+		{"forward . 127.0.0.1 {\nroutes /etc/routes\n}\n", false, 1, 0, defaultRouteReload, ""},
+		{"forward . 127.0.0.1 {\nroutes a b\ngroup corp 10.0.0.1 10.0.0.2\ngroup lab tls://10.0.0.3\nroutes_reload 0\n}\n", false, 2, 2, 0, ""},
+		// negative
+		{"forward . 127.0.0.1 {\nroutes\n}\n", true, 0, 0, 0, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nroutes a\ngroup corp\n}\n", true, 0, 0, 0, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nroutes a\ngroup corp 10.0.0.1\ngroup corp 10.0.0.2\n}\n", true, 0, 0, 0, "defined twice"},
+		{"forward . 127.0.0.1 {\nroutes a\ngroup corp foo://10.0.0.1\n}\n", true, 0, 0, 0, "not an IP address"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\n}\n", true, 0, 0, 0, "group without routes"},
+		{"forward . 127.0.0.1 {\nroutes_reload 1s\n}\n", true, 0, 0, 0, "without routes"},
+		{"forward . 127.0.0.1 {\nroutes a\nroutes_reload -1s\n}\n", true, 0, 0, 0, "negative"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		f, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if !test.shouldErr {
+			r := f.router
+			if len(r.files) != test.expectedFiles || len(r.groups) != test.expectedGroups || r.reload != test.expectedReload {
+				t.Errorf("Test %d: expected: %d %d %s, got: %d %d %s", i, test.expectedFiles, test.expectedGroups, test.expectedReload, len(r.files), len(r.groups), r.reload)
+			}
+		}
+	}
+}
+
 func TestSetupHealthCheck(t *testing.T) {
 	tests := []struct {
 		input       string
@@ -8,17 +8,26 @@ import (
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/debug"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
 	ot "github.com/opentracing/opentracing-go"
 )
 
+var log = clog.NewWithPlugin("grpc")
+
 // GRPC represents a plugin instance that can proxy requests to another (DNS) server via gRPC protocol.
 // It has a list of proxies each representing one upstream proxy.
 type GRPC struct {
-	proxies []*Proxy
-	p       Policy
+	proxies    []*Proxy
+	p          Policy
+	hcInterval time.Duration
+	maxfails   uint32
+
+	// health checking: with the gRPC health checking protocol for hcService, or a DNS query
+	hcKind    string
+	hcService string
 
 	from    string
 	ignored []string
@@ -40,7 +49,7 @@ func (g *GRPC) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 		span, child      ot.Span
 		ret              *dns.Msg
 		upstreamErr, err error
-		i                int
+		i, fails         int
 	)
 	span = ot.SpanFromContext(ctx)
 	list := g.list()
@@ -58,6 +67,16 @@ func (g *GRPC) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 
 		proxy := list[i]
 		i++
+		if proxy.down(g.maxfails) {
+			fails++
+			if fails < len(g.proxies) {
+				continue
+			}
+			// All upstream proxies are dead, assume healthcheck is completely broken and randomly
+			// select an upstream to connect to.
+			proxy = new(random).List(g.proxies)[0]
+			HealthcheckBrokenCount.Add(1)
+		}
 
 		if span != nil {
 			child = span.Tracer().StartSpan("query", ot.ChildOf(span.Context()))
@@ -66,6 +85,11 @@ func (g *GRPC) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 
 		ret, err = proxy.query(ctx, r)
 		if err != nil {
+			upstreamErr = err
+			// Kick off health check to see if *our* upstream is broken.
+			if g.maxfails != 0 {
+				proxy.healthcheck()
+			}
 			// Continue with the next proxy
 			continue
 		}
@@ -74,8 +98,6 @@ func (g *GRPC) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 			child.Finish()
 		}
 
-		upstreamErr = err
-
 		// Check if the reply is correct; if not return FormErr.
 		if !state.Match(ret) {
 			debug.Hexdumpf(ret, "Wrong reply for id: %d, %s %d", ret.Id, state.QName(), state.QType())
@@ -100,7 +122,10 @@ func (g *GRPC) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 // NewGRPC returns a new GRPC.
 func newGRPC() *GRPC {
 	g := &GRPC{
-		p: new(random),
+		p:          new(random),
+		hcInterval: hcInterval,
+		maxfails:   2,
+		hcKind:     "dns",
 	}
 	return g
 }
@@ -108,6 +133,22 @@ func newGRPC() *GRPC {
 // Name implements the Handler interface.
 func (g *GRPC) Name() string { return "grpc" }
 
+// OnStartup starts the health checking of all proxies.
+func (g *GRPC) OnStartup() error {
+	for _, p := range g.proxies {
+		p.start(g.hcInterval)
+	}
+	return nil
+}
+
+// OnShutdown stops the health checking of all proxies.
+func (g *GRPC) OnShutdown() error {
+	for _, p := range g.proxies {
+		p.stop()
+	}
+	return nil
+}
+
 // Len returns the number of configured proxies.
 func (g *GRPC) len() int { return len(g.proxies) }
 
@@ -137,6 +178,8 @@ func (g *GRPC) list() []*Proxy { return g.p.List(g.proxies) }
 
 const defaultTimeout = 5 * time.Second
 
+var hcInterval = 500 * time.Millisecond
+
 var (
 	// ErrNoHealthy means no healthy proxies left.
 	ErrNoHealthy = errors.New("no healthy gRPC proxies")
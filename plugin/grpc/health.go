@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/pb"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthChecker checks the upstream health.
+type healthChecker interface {
+	Check(*Proxy) error
+}
+
+// dnsHc is a health checker that sends a DNS query over gRPC: . IN NS. Any reply, or a NotFound error,
+// constitutes a healthy upstream.
+type dnsHc struct{}
+
+// grpcHc is a health checker that uses the standard gRPC health checking protocol. The upstream is
+// healthy when service is SERVING.
+type grpcHc struct {
+	client  grpc_health_v1.HealthClient
+	service string
+}
+
+var hcTimeout = 1 * time.Second
+
+// newHealthChecker returns the health checker of kind "dns" or "grpc" for the upstream with connection conn.
+func newHealthChecker(kind, service string, conn *grpc.ClientConn) healthChecker {
+	if kind == "grpc" {
+		return &grpcHc{client: grpc_health_v1.NewHealthClient(conn), service: service}
+	}
+	return &dnsHc{}
+}
+
+// Check is used as the up.Func in the up.Probe.
+func (h *dnsHc) Check(p *Proxy) error {
+	ping := new(dns.Msg)
+	ping.SetQuestion(".", dns.TypeNS)
+	msg, err := ping.Pack()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hcTimeout)
+	defer cancel()
+	_, err = p.client.Query(ctx, &pb.DnsPacket{Msg: msg})
+	if status.Code(err) == codes.NotFound {
+		err = nil
+	}
+	return p.checked(err)
+}
+
+// Check is used as the up.Func in the up.Probe.
+func (h *grpcHc) Check(p *Proxy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hcTimeout)
+	defer cancel()
+	resp, err := h.client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: h.service})
+	if err == nil && resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		err = fmt.Errorf("service %q is %s", h.service, resp.Status)
+	}
+	return p.checked(err)
+}
+
+// checked records the outcome err of a health check of p.
+func (p *Proxy) checked(err error) error {
+	if err != nil {
+		HealthcheckFailureCount.WithLabelValues(p.addr).Add(1)
+		atomic.AddUint32(&p.fails, 1)
+		return err
+	}
+	atomic.StoreUint32(&p.fails, 0)
+	return nil
+}
@@ -0,0 +1,171 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/pb"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/up"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// dnsService answers every query, or fails with err when it is set.
+type dnsService struct {
+	err error
+}
+
+func (s *dnsService) Query(ctx context.Context, in *pb.DnsPacket) (*pb.DnsPacket, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	m := new(dns.Msg)
+	if err := m.Unpack(in.Msg); err != nil {
+		return nil, err
+	}
+	m.Response = true
+	msg, err := m.Pack()
+	return &pb.DnsPacket{Msg: msg}, err
+}
+
+// newServer starts a gRPC server with the DNS service s and the health service h.
+func newServer(t *testing.T, s pb.DnsServiceServer, h *health.Server) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterDnsServiceServer(srv, s)
+	grpc_health_v1.RegisterHealthServer(srv, h)
+	go srv.Serve(l)
+	return l.Addr().String(), srv.Stop
+}
+
+func TestHealthDNS(t *testing.T) {
+	tests := []struct {
+		err       error
+		shouldErr bool
+	}{
+		{nil, false},
+		{status.Error(codes.NotFound, "not found"), false},
+		{status.Error(codes.Unavailable, "broken"), true},
+	}
+	for i, tc := range tests {
+		addr, stop := newServer(t, &dnsService{err: tc.err}, health.NewServer())
+		p, err := newProxy(addr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.fails = 1
+
+		err = newHealthChecker("dns", "", p.conn).Check(p)
+		if tc.shouldErr != (err != nil) {
+			t.Errorf("Test %d: expected error %t, got %v", i, tc.shouldErr, err)
+		}
+		if expected := map[bool]uint32{false: 0, true: 2}[tc.shouldErr]; p.fails != expected {
+			t.Errorf("Test %d: expected %d fails, got %d", i, expected, p.fails)
+		}
+		stop()
+	}
+}
+
+func TestHealthGRPC(t *testing.T) {
+	h := health.NewServer()
+	addr, stop := newServer(t, &dnsService{}, h)
+	defer stop()
+	p, err := newProxy(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		service   string
+		status    grpc_health_v1.HealthCheckResponse_ServingStatus
+		shouldErr bool
+	}{
+		{"", grpc_health_v1.HealthCheckResponse_SERVING, false},
+		{"dns", grpc_health_v1.HealthCheckResponse_SERVING, false},
+		{"dns", grpc_health_v1.HealthCheckResponse_NOT_SERVING, true},
+		{"unknown", grpc_health_v1.HealthCheckResponse_SERVING, true},
+	}
+	for i, tc := range tests {
+		if tc.service != "unknown" {
+			h.SetServingStatus(tc.service, tc.status)
+		}
+		err := newHealthChecker("grpc", tc.service, p.conn).Check(p)
+		if tc.shouldErr != (err != nil) {
+			t.Errorf("Test %d: expected error %t, got %v", i, tc.shouldErr, err)
+		}
+	}
+}
+
+// countingClient counts the queries, and fails them when err is set.
+type countingClient struct {
+	queries uint32
+	err     error
+}
+
+func (c *countingClient) Query(ctx context.Context, in *pb.DnsPacket, opts ...grpc.CallOption) (*pb.DnsPacket, error) {
+	atomic.AddUint32(&c.queries, 1)
+	if c.err != nil {
+		return nil, c.err
+	}
+	m := new(dns.Msg)
+	m.Unpack(in.Msg)
+	m.Response = true
+	msg, err := m.Pack()
+	return &pb.DnsPacket{Msg: msg}, err
+}
+
+func TestHealthMaxFails(t *testing.T) {
+	broken := &countingClient{err: status.Error(codes.Unavailable, "broken")}
+	good := &countingClient{}
+
+	g := newGRPC()
+	g.from = "."
+	g.p = &sequential{}
+	g.maxfails = 1
+	g.hcInterval = 10 * time.Millisecond
+	g.proxies = []*Proxy{
+		{addr: "broken", client: broken, probe: up.New(), health: &dnsHc{}},
+		{addr: "good", client: good, probe: up.New(), health: &dnsHc{}},
+	}
+	g.OnStartup()
+	defer g.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	if _, err := g.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+		t.Fatalf("Expected a reply, got %s", err)
+	}
+
+	// The health checks fail as well, until the broken upstream is down.
+	for i := 0; i < 100 && !g.proxies[0].down(g.maxfails); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !g.proxies[0].down(g.maxfails) {
+		t.Fatalf("Expected the broken upstream to be down")
+	}
+
+	queries := atomic.LoadUint32(&broken.queries)
+	if _, err := g.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+		t.Fatalf("Expected a reply, got %s", err)
+	}
+	// Only health checks may have been sent to the broken upstream, and those are spaced by the interval.
+	if x := atomic.LoadUint32(&broken.queries); x > queries+1 {
+		t.Errorf("Expected the broken upstream to be skipped, got %d queries", x-queries)
+	}
+	if x := atomic.LoadUint32(&good.queries); x != 2 {
+		t.Errorf("Expected 2 queries to the good upstream, got %d", x)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"crypto/tls"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/coredns/coredns/pb"
+	"github.com/coredns/coredns/plugin/pkg/up"
 
 	"github.com/miekg/dns"
 	"google.golang.org/grpc"
@@ -17,17 +19,25 @@ import (
 
 // Proxy defines an upstream host.
 type Proxy struct {
-	addr string
+	fails uint32
+	addr  string
 
 	// connection
 	client   pb.DnsServiceClient
+	conn     *grpc.ClientConn
 	dialOpts []grpc.DialOption
+
+	// health checking
+	probe  *up.Probe
+	health healthChecker
 }
 
 // newProxy returns a new proxy.
 func newProxy(addr string, tlsConfig *tls.Config) (*Proxy, error) {
 	p := &Proxy{
-		addr: addr,
+		addr:   addr,
+		probe:  up.New(),
+		health: &dnsHc{},
 	}
 
 	if tlsConfig != nil {
@@ -40,11 +50,40 @@ func newProxy(addr string, tlsConfig *tls.Config) (*Proxy, error) {
 	if err != nil {
 		return nil, err
 	}
+	p.conn = conn
 	p.client = pb.NewDnsServiceClient(conn)
 
 	return p, nil
 }
 
+// healthcheck kicks off a round of health checks for this proxy.
+func (p *Proxy) healthcheck() {
+	if p.health == nil {
+		log.Warning("No healthchecker")
+		return
+	}
+
+	p.probe.Do(func() error {
+		return p.health.Check(p)
+	})
+}
+
+// down returns true if this proxy is down, i.e. has *more* fails than maxfails.
+func (p *Proxy) down(maxfails uint32) bool {
+	if maxfails == 0 {
+		return false
+	}
+
+	fails := atomic.LoadUint32(&p.fails)
+	return fails > maxfails
+}
+
+// start starts the proxy's health checking.
+func (p *Proxy) start(duration time.Duration) { p.probe.Start(duration) }
+
+// stop stops the health checking goroutine.
+func (p *Proxy) stop() { p.probe.Stop() }
+
 // query sends the request and waits for a response.
 func (p *Proxy) query(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
 	start := time.Now()
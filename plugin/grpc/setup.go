@@ -3,6 +3,8 @@ package grpc
 import (
 	"crypto/tls"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
@@ -28,6 +30,9 @@ func setup(c *caddy.Controller) error {
 		return g
 	})
 
+	c.OnStartup(g.OnStartup)
+	c.OnShutdown(g.OnShutdown)
+
 	return nil
 }
 
@@ -85,6 +90,7 @@ func parseStanza(c *caddy.Controller) (*GRPC, error) {
 		if err != nil {
 			return nil, err
 		}
+		pr.health = newHealthChecker(g.hcKind, g.hcService, pr.conn)
 		g.proxies = append(g.proxies, pr)
 	}
 
@@ -118,6 +124,51 @@ func parseBlock(c *caddy.Controller, g *GRPC) error {
 			return c.ArgErr()
 		}
 		g.tlsServerName = c.Val()
+	case "max_fails":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return fmt.Errorf("max_fails can't be negative: %d", n)
+		}
+		g.maxfails = uint32(n)
+	case "health_check":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		dur, err := time.ParseDuration(c.Val())
+		if err != nil {
+			return err
+		}
+		if dur < 0 {
+			return fmt.Errorf("health_check can't be negative: %d", dur)
+		}
+		g.hcInterval = dur
+
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			break
+		}
+		switch args[0] {
+		case "dns":
+			if len(args) > 1 {
+				return c.ArgErr()
+			}
+		case "grpc":
+			if len(args) > 2 {
+				return c.ArgErr()
+			}
+			if len(args) == 2 {
+				g.hcService = args[1]
+			}
+		default:
+			return fmt.Errorf("health_check: unknown option %s", args[0])
+		}
+		g.hcKind = args[0]
 	case "policy":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
 )
@@ -151,3 +152,65 @@ nameserver 10.10.255.253`), 0666); err != nil {
 		}
 	}
 }
+
+func TestSetupHealthCheck(t *testing.T) {
+	tests := []struct {
+		input            string
+		shouldErr        bool
+		expectedInterval time.Duration
+		expectedMaxFails uint32
+		expectedKind     string
+		expectedService  string
+		expectedErr      string
+	}{
+		// positive
+		{"grpc . 127.0.0.1\n", false, hcInterval, 2, "dns", "", ""},
+		{"grpc . 127.0.0.1 {\nhealth_check 1s\nmax_fails 3\n}\n", false, time.Second, 3, "dns", "", ""},
+		{"grpc . 127.0.0.1 {\nhealth_check 1s dns\nmax_fails 0\n}\n", false, time.Second, 0, "dns", "", ""},
+		{"grpc . 127.0.0.1 {\nhealth_check 1s grpc\n}\n", false, time.Second, 2, "grpc", "", ""},
+		{"grpc . 127.0.0.1 {\nhealth_check 1s grpc coredns.dns.DnsService\n}\n", false, time.Second, 2, "grpc", "coredns.dns.DnsService", ""},
+		// negative
+		{"grpc . 127.0.0.1 {\nhealth_check\n}\n", true, 0, 0, "", "", "Wrong argument count"},
+		{"grpc . 127.0.0.1 {\nhealth_check -1s\n}\n", true, 0, 0, "", "", "negative"},
+		{"grpc . 127.0.0.1 {\nhealth_check 1s http\n}\n", true, 0, 0, "", "", "unknown option"},
+		{"grpc . 127.0.0.1 {\nhealth_check 1s dns service\n}\n", true, 0, 0, "", "", "Wrong argument count"},
+		{"grpc . 127.0.0.1 {\nmax_fails\n}\n", true, 0, 0, "", "", "Wrong argument count"},
+		{"grpc . 127.0.0.1 {\nmax_fails -1\n}\n", true, 0, 0, "", "", "negative"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("grpc", test.input)
+		g, err := parseGRPC(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if test.shouldErr {
+			continue
+		}
+		if g.hcInterval != test.expectedInterval || g.maxfails != test.expectedMaxFails {
+			t.Errorf("Test %d: expected: %s %d, got: %s %d", i, test.expectedInterval, test.expectedMaxFails, g.hcInterval, g.maxfails)
+		}
+		switch hc := g.proxies[0].health.(type) {
+		case *dnsHc:
+			if test.expectedKind != "dns" {
+				t.Errorf("Test %d: expected a %s health checker, got dns", i, test.expectedKind)
+			}
+		case *grpcHc:
+			if test.expectedKind != "grpc" || hc.service != test.expectedService {
+				t.Errorf("Test %d: expected a %s health checker for %q, got grpc for %q", i, test.expectedKind, test.expectedService, hc.service)
+			}
+		}
+	}
+}
@@ -1,10 +1,16 @@
 // Package cache implements a cache. The cache hold 256 shards, each shard
-// holds a cache: a map with a mutex. There is no fancy expunge algorithm, it
-// just randomly evicts elements when it gets full.
+// holds a cache: a map with a mutex. By default there is no fancy expunge
+// algorithm, it just randomly evicts elements when it gets full. With the
+// TinyLFU policy the least frequently used of a sample of elements is evicted,
+// and new elements that are used less often than that are not admitted at all.
+//
+// A cache is bounded by the number of elements, and optionally by the total
+// cost of its elements, usually their size in bytes.
 package cache
 
 import (
 	"hash/fnv"
+	"math"
 	"sync"
 )
 
@@ -18,13 +24,72 @@ func Hash(what []byte) uint64 {
 // Cache is cache.
 type Cache struct {
 	shards [shardSize]*shard
+	cost   func(interface{}) int
 }
 
-// shard is a cache with random eviction.
+// Policy is the eviction policy of a cache.
+type Policy int
+
+const (
+	// Random evicts a random element.
+	Random Policy = iota
+	// TinyLFU evicts the least frequently used element of a sample, and doesn't admit new elements that
+	// are used less frequently than it.
+	TinyLFU
+)
+
+// Options are the options for NewWithOptions.
+type Options struct {
+	// MaxCost is the maximum total cost of the elements in the cache, zero means no limit.
+	MaxCost int64
+	// Cost returns the cost of an element, usually its size in bytes. It is required when MaxCost is set.
+	Cost func(interface{}) int
+	// Policy is the eviction policy.
+	Policy Policy
+}
+
+// Reason is the reason an element was evicted.
+type Reason int
+
+const (
+	// Capacity means the maximum number of elements was reached.
+	Capacity Reason = iota
+	// Memory means the maximum cost was reached.
+	Memory
+	// Rejected means the new element wasn't admitted.
+	Rejected
+)
+
+// String returns the reason as a lowercase string, for use in metrics.
+func (r Reason) String() string {
+	switch r {
+	case Capacity:
+		return "capacity"
+	case Memory:
+		return "memory"
+	case Rejected:
+		return "rejected"
+	}
+	return ""
+}
+
+// Evictions holds the number of elements evicted by an Add, per reason.
+type Evictions [Rejected + 1]int
+
+// Evicted returns true if any element was evicted.
+func (e Evictions) Evicted() bool { return e[Capacity]+e[Memory]+e[Rejected] > 0 }
+
+// shard is a cache with random or TinyLFU eviction.
 type shard struct {
 	items map[uint64]interface{}
 	size  int
 
+	costs   map[uint64]int
+	cost    int64
+	maxCost int64
+
+	sketch *sketch // only set for TinyLFU
+
 	sync.RWMutex
 }
 
@@ -44,11 +109,55 @@ func New(size int) *Cache {
 	return c
 }
 
+// NewWithOptions returns a new cache with opts. A size of zero means the number of elements isn't
+// limited, only their cost.
+func NewWithOptions(size int, opts Options) *Cache {
+	ssize := math.MaxInt32
+	if size > 0 {
+		ssize = size / shardSize
+		if ssize < 4 {
+			ssize = 4
+		}
+	}
+	var scost int64
+	if opts.MaxCost > 0 && opts.Cost != nil {
+		scost = opts.MaxCost / shardSize
+		if scost < 1 {
+			scost = 1
+		}
+	}
+
+	c := &Cache{cost: opts.Cost}
+	for i := 0; i < shardSize; i++ {
+		c.shards[i] = newShard(ssize)
+		c.shards[i].maxCost = scost
+		if opts.Policy == TinyLFU {
+			// Without a limit on the number of elements, size the sketch for elements of 512 bytes.
+			n := ssize
+			if size <= 0 {
+				n = int(scost / 512)
+			}
+			c.shards[i].sketch = newSketch(n)
+		}
+	}
+	return c
+}
+
 // Add adds a new element to the cache. If the element already exists it is overwritten.
-// Returns true if an existing element was evicted to make room for this element.
+// Returns true if an existing element was evicted to make room for this element, or if this
+// element wasn't admitted to the cache.
 func (c *Cache) Add(key uint64, el interface{}) bool {
+	return c.Put(key, el).Evicted()
+}
+
+// Put is like Add, but returns the number of evicted elements per reason.
+func (c *Cache) Put(key uint64, el interface{}) Evictions {
+	cost := 0
+	if c.cost != nil {
+		cost = c.cost(el)
+	}
 	shard := key & (shardSize - 1)
-	return c.shards[shard].Add(key, el)
+	return c.shards[shard].Put(key, el, cost)
 }
 
 // Get looks up element index under key.
@@ -72,7 +181,17 @@ func (c *Cache) Len() int {
 	return l
 }
 
-// Walk walks each shard in the cache.
+// Cost returns the total cost of the elements in the cache.
+func (c *Cache) Cost() int64 {
+	var n int64
+	for _, s := range c.shards {
+		n += s.Cost()
+	}
+	return n
+}
+
+// Walk walks each shard in the cache. The function f may delete elements from the map, but should not
+// add any.
 func (c *Cache) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	for _, s := range c.shards {
 		s.Walk(f)
@@ -80,31 +199,87 @@ func (c *Cache) Walk(f func(map[uint64]interface{}, uint64) bool) {
 }
 
 // newShard returns a new shard with size.
-func newShard(size int) *shard { return &shard{items: make(map[uint64]interface{}), size: size} }
+func newShard(size int) *shard {
+	return &shard{items: make(map[uint64]interface{}), costs: make(map[uint64]int), size: size}
+}
 
 // Add adds element indexed by key into the cache. Any existing element is overwritten
 // Returns true if an existing element was evicted to make room for this element.
-func (s *shard) Add(key uint64, el interface{}) bool {
-	eviction := false
+func (s *shard) Add(key uint64, el interface{}) bool { return s.Put(key, el, 0).Evicted() }
+
+// Put adds element indexed by key with cost into the cache. Any existing element is overwritten.
+// Elements are evicted until the new element fits, unless the policy doesn't admit it.
+func (s *shard) Put(key uint64, el interface{}, cost int) Evictions {
+	e := Evictions{}
 	s.Lock()
-	if len(s.items) >= s.size {
-		if _, ok := s.items[key]; !ok {
-			for k := range s.items {
-				delete(s.items, k)
-				eviction = true
-				break
-			}
+	defer s.Unlock()
+
+	if s.sketch != nil {
+		s.sketch.increment(key)
+	}
+
+	_, exists := s.items[key]
+	if exists {
+		s.remove(key)
+	}
+	if s.maxCost > 0 && int64(cost) > s.maxCost {
+		e[Rejected]++
+		return e
+	}
+
+	for len(s.items) > 0 && (len(s.items) >= s.size || (s.maxCost > 0 && s.cost+int64(cost) > s.maxCost)) {
+		victim := s.victim()
+		// Replacing an element always succeeds, new elements must be used as often as the one they evict.
+		if !exists && s.sketch != nil && s.sketch.estimate(key) < s.sketch.estimate(victim) {
+			e[Rejected]++
+			return e
 		}
+		if len(s.items) >= s.size {
+			e[Capacity]++
+		} else {
+			e[Memory]++
+		}
+		s.remove(victim)
 	}
+
 	s.items[key] = el
-	s.Unlock()
-	return eviction
+	s.costs[key] = cost
+	s.cost += int64(cost)
+	return e
+}
+
+// victim returns the key of the element to evict. For TinyLFU that is the least frequently used of a
+// sample, otherwise a random one. The shard must hold at least one element.
+func (s *shard) victim() uint64 {
+	var victim uint64
+	if s.sketch == nil {
+		for k := range s.items {
+			return k
+		}
+	}
+	freq, n := -1, 0
+	for k := range s.items {
+		if f := s.sketch.estimate(k); freq < 0 || f < freq {
+			victim, freq = k, f
+		}
+		if n++; n == sampleSize {
+			break
+		}
+	}
+	return victim
+}
+
+// remove removes the element indexed by key, the caller must hold the lock.
+func (s *shard) remove(key uint64) {
+	delete(s.items, key)
+	s.cost -= int64(s.costs[key])
+	delete(s.costs, key)
 }
 
 // Remove removes the element indexed by key from the cache.
 func (s *shard) Remove(key uint64) {
 	s.Lock()
-	delete(s.items, key)
+	s.remove(key)
 	s.Unlock()
 }
 
@@ -112,7 +287,7 @@ func (s *shard) Remove(key uint64) {
 func (s *shard) Evict() {
 	s.Lock()
 	for k := range s.items {
-		delete(s.items, k)
+		s.remove(k)
 		break
 	}
 	s.Unlock()
@@ -123,6 +298,9 @@ func (s *shard) Get(key uint64) (interface{}, bool) {
 	s.RLock()
 	el, found := s.items[key]
 	s.RUnlock()
+	if found && s.sketch != nil {
+		s.sketch.increment(key)
+	}
 	return el, found
 }
 
@@ -134,6 +312,14 @@ func (s *shard) Len() int {
 	return l
 }
 
+// Cost returns the total cost of the elements in the shard.
+func (s *shard) Cost() int64 {
+	s.RLock()
+	n := s.cost
+	s.RUnlock()
+	return n
+}
+
 // Walk walks the shard for each element the function f is executed while holding a write lock.
 func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	items := make([]uint64, len(s.items))
@@ -147,6 +333,10 @@ func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	for _, k := range items {
 		s.Lock()
 		ok := f(s.items, k)
+		if _, found := s.items[k]; !found {
+			// Deleted by f.
+			s.remove(k)
+		}
 		s.Unlock()
 		if !ok {
 			return
@@ -154,4 +344,8 @@ func (s *shard) Walk(f func(map[uint64]interface{}, uint64) bool) {
 	}
 }
 
-const shardSize = 256
+const (
+	shardSize = 256
+	// sampleSize is the number of elements TinyLFU picks the victim from.
+	sampleSize = 5
+)
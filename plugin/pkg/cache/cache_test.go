@@ -83,3 +83,65 @@ func BenchmarkCache(b *testing.B) {
 		c.Get(1)
 	}
 }
+
+func TestCacheMaxCost(t *testing.T) {
+	c := NewWithOptions(0, Options{MaxCost: shardSize * 100, Cost: func(el interface{}) int { return el.(int) }})
+
+	// All keys go to shard 0, which can hold 100.
+	evictions := Evictions{}
+	for i := uint64(0); i < 10; i++ {
+		e := c.Put(i*shardSize, 30)
+		for r := range e {
+			evictions[r] += e[r]
+		}
+	}
+	if x := c.Cost(); x > 100 {
+		t.Errorf("Expected a cost of at most 100, got %d", x)
+	}
+	if x := c.Len(); x != 3 {
+		t.Errorf("Expected 3 elements, got %d", x)
+	}
+	if evictions[Memory] != 7 || evictions[Capacity] != 0 {
+		t.Errorf("Expected 7 evictions for memory, got %v", evictions)
+	}
+
+	// Too large to ever fit.
+	if e := c.Put(shardSize*100, 101); e[Rejected] != 1 {
+		t.Errorf("Expected the element to be rejected, got %v", e)
+	}
+
+	c.Walk(func(items map[uint64]interface{}, key uint64) bool {
+		delete(items, key)
+		return true
+	})
+	if x := c.Cost(); x != 0 {
+		t.Errorf("Expected a cost of 0 after deleting everything, got %d", x)
+	}
+}
+
+func TestCacheTinyLFU(t *testing.T) {
+	c := NewWithOptions(shardSize*4, Options{Policy: TinyLFU})
+
+	// Make the keys of shard 0 popular.
+	for i := uint64(0); i < 4; i++ {
+		c.Add(i*shardSize, 1)
+		for j := 0; j < 5; j++ {
+			c.Get(i * shardSize)
+		}
+	}
+	// One-hit wonders are not admitted.
+	for i := uint64(4); i < 100; i++ {
+		if e := c.Put(i*shardSize, 1); e[Rejected] != 1 {
+			t.Errorf("Expected key %d to be rejected, got %v", i*shardSize, e)
+		}
+	}
+	for i := uint64(0); i < 4; i++ {
+		if _, ok := c.Get(i * shardSize); !ok {
+			t.Errorf("Expected popular key %d to be cached", i*shardSize)
+		}
+	}
+	// Replacing an element always works.
+	if c.Add(0, 2) {
+		t.Errorf("Expected no eviction when replacing an element")
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import "sync"
+
+// sketch is a count-min sketch with 4-bit counters that estimates how often keys are used, as used by
+// TinyLFU. The counters are halved after a number of increments, so old popularity fades away.
+type sketch struct {
+	sync.Mutex
+	rows  [depth][]byte // two counters per byte
+	mask  uint64
+	adds  int
+	reset int
+}
+
+// newSketch returns a sketch sized for n elements.
+func newSketch(n int) *sketch {
+	w := 16
+	for w < n {
+		w <<= 1
+	}
+	s := &sketch{mask: uint64(w - 1), reset: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]byte, w/2)
+	}
+	return s
+}
+
+// index returns the counter for key in row i.
+func (s *sketch) index(key uint64, i int) uint64 {
+	h := (key ^ seeds[i]) * 0x9E3779B97F4A7C15
+	h ^= h >> 31
+	return h & s.mask
+}
+
+func (s *sketch) increment(key uint64) {
+	s.Lock()
+	defer s.Unlock()
+	for i := range s.rows {
+		j := s.index(key, i)
+		b, shift := &s.rows[i][j/2], (j%2)*4
+		if (*b>>shift)&0x0f < 15 {
+			*b += 1 << shift
+		}
+	}
+	s.adds++
+	if s.adds >= s.reset {
+		s.halve()
+	}
+}
+
+// estimate returns the estimated number of times key has been used.
+func (s *sketch) estimate(key uint64) int {
+	s.Lock()
+	defer s.Unlock()
+	min := 15
+	for i := range s.rows {
+		j := s.index(key, i)
+		if c := int(s.rows[i][j/2]>>((j%2)*4)) & 0x0f; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// halve divides all counters by two.
+func (s *sketch) halve() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = (s.rows[i][j] >> 1) & 0x77
+		}
+	}
+	s.adds /= 2
+}
+
+const depth = 4
+
+var seeds = [depth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
@@ -0,0 +1,33 @@
+package cache
+
+import "testing"
+
+func TestSketch(t *testing.T) {
+	s := newSketch(64)
+	for i := 0; i < 5; i++ {
+		s.increment(1)
+	}
+	s.increment(2)
+
+	if x := s.estimate(1); x != 5 {
+		t.Errorf("Expected estimate 5, got %d", x)
+	}
+	if x := s.estimate(2); x != 1 {
+		t.Errorf("Expected estimate 1, got %d", x)
+	}
+	if x := s.estimate(3); x != 0 {
+		t.Errorf("Expected estimate 0, got %d", x)
+	}
+
+	for i := 0; i < 20; i++ {
+		s.increment(1)
+	}
+	if x := s.estimate(1); x != 15 {
+		t.Errorf("Expected estimate to saturate at 15, got %d", x)
+	}
+
+	s.halve()
+	if x := s.estimate(1); x != 7 {
+		t.Errorf("Expected estimate 7 after halving, got %d", x)
+	}
+}
@@ -81,3 +81,17 @@ func Reverse(nets []string) []string {
 	}
 	return rev
 }
+
+// Parse parses s as a network in CIDR notation. A plain IP address is returned as
+// a network holding only that address, i.e. a /32 or a /128.
+func Parse(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		if strings.Contains(s, ":") {
+			s += "/128"
+		} else {
+			s += "/32"
+		}
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
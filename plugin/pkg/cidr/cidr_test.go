@@ -45,3 +45,35 @@ func TestReverse(t *testing.T) {
 		}
 	}
 }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+		err      bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"10.1.2.3/8", "10.0.0.0/8", false},
+		{"10.1.2.3", "10.1.2.3/32", false},
+		{"2001:db8::1", "2001:db8::1/128", false},
+		{"2001:db8::/32", "2001:db8::/32", false},
+		{"example.org", "", true},
+		{"10.0.0.0/33", "", true},
+	}
+	for i, tc := range tests {
+		n, err := Parse(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Test %d, expected error for %s", i, tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d, expected no error, got %s", i, err)
+			continue
+		}
+		if n.String() != tc.expected {
+			t.Errorf("Test %d, expected %s, got %s", i, tc.expected, n)
+		}
+	}
+}
@@ -21,12 +21,22 @@ type Server struct {
 // finished, to shut it down.
 func NewServer(f dns.HandlerFunc) *Server {
 	dns.HandleFunc(".", f)
+	return newServer(nil)
+}
+
+// NewMultipleServer starts and returns a new Server that answers with f. Unlike NewServer it does not
+// register f in the default handler, so multiple servers can run side by side with different handlers.
+// The caller should call Close when finished, to shut it down.
+func NewMultipleServer(f dns.HandlerFunc) *Server {
+	return newServer(f)
+}
 
+func newServer(h dns.Handler) *Server {
 	ch1 := make(chan bool)
 	ch2 := make(chan bool)
 
-	s1 := &dns.Server{} // udp
-	s2 := &dns.Server{} // tcp
+	s1 := &dns.Server{Handler: h} // udp
+	s2 := &dns.Server{Handler: h} // tcp
 
 	for i := 0; i < 5; i++ { // 5 attempts
 		s2.Listener, _ = reuseport.Listen("tcp", ":0")
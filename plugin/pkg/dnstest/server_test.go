@@ -35,3 +35,33 @@ func TestNewServer(t *testing.T) {
 		t.Fatalf("Msg ID's should match, expected %d, got %d", m.Id, ret.Id)
 	}
 }
+
+func TestNewMultipleServer(t *testing.T) {
+	answer := func(rcode int) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, r *dns.Msg) {
+			ret := new(dns.Msg)
+			ret.SetRcode(r, rcode)
+			w.WriteMsg(ret)
+		}
+	}
+	s1 := NewMultipleServer(answer(dns.RcodeSuccess))
+	defer s1.Close()
+	s2 := NewMultipleServer(answer(dns.RcodeRefused))
+	defer s2.Close()
+
+	c := new(dns.Client)
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+	for _, tc := range []struct {
+		addr  string
+		rcode int
+	}{{s1.Addr, dns.RcodeSuccess}, {s2.Addr, dns.RcodeRefused}} {
+		ret, _, err := c.Exchange(m, tc.addr)
+		if err != nil {
+			t.Fatalf("Could not send message to dnstest.Server: %s", err)
+		}
+		if ret.Rcode != tc.rcode {
+			t.Errorf("Expected rcode %d from %s, got %d", tc.rcode, tc.addr, ret.Rcode)
+		}
+	}
+}
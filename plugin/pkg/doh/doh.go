@@ -19,37 +19,38 @@ const Path = "/dns-query"
 
 // NewRequest returns a new DoH request given a method, URL (without any paths, so exclude /dns-query) and dns.Msg.
 func NewRequest(method, url string, m *dns.Msg) (*http.Request, error) {
+	return NewRequestURL(method, "https://"+url+Path, m)
+}
+
+// NewRequestURL returns a new DoH request given a method, the full URL of the DoH endpoint, i.e.
+// https://1.1.1.1/dns-query, and dns.Msg.
+func NewRequestURL(method, url string, m *dns.Msg) (*http.Request, error) {
 	buf, err := m.Pack()
 	if err != nil {
 		return nil, err
 	}
 
+	var req *http.Request
 	switch method {
 	case http.MethodGet:
 		b64 := base64.RawURLEncoding.EncodeToString(buf)
-
-		req, err := http.NewRequest(http.MethodGet, "https://"+url+Path+"?dns="+b64, nil)
-		if err != nil {
-			return req, err
-		}
-
-		req.Header.Set("content-type", MimeType)
-		req.Header.Set("accept", MimeType)
-		return req, nil
+		req, err = http.NewRequest(http.MethodGet, url+"?dns="+b64, nil)
 
 	case http.MethodPost:
-		req, err := http.NewRequest(http.MethodPost, "https://"+url+Path+"?bla=foo:443", bytes.NewReader(buf))
-		if err != nil {
-			return req, err
+		req, err = http.NewRequest(http.MethodPost, url, bytes.NewReader(buf))
+		if err == nil {
+			req.Header.Set("content-type", MimeType)
 		}
 
-		req.Header.Set("content-type", MimeType)
-		req.Header.Set("accept", MimeType)
-		return req, nil
-
 	default:
 		return nil, fmt.Errorf("method not allowed: %s", method)
 	}
+	if err != nil {
+		return req, err
+	}
+
+	req.Header.Set("accept", MimeType)
+	return req, nil
 }
 
 // ResponseToMsg converts a http.Response to a dns message.
@@ -61,26 +62,32 @@ func ResponseToMsg(resp *http.Response) (*dns.Msg, error) {
 
 // RequestToMsg converts a http.Request to a dns message.
 func RequestToMsg(req *http.Request) (*dns.Msg, error) {
+	buf, err := RequestToBuf(req)
+	if err != nil {
+		return nil, err
+	}
+	m := new(dns.Msg)
+	err = m.Unpack(buf)
+	return m, err
+}
+
+// RequestToBuf returns the dns message in a http.Request in wire format.
+func RequestToBuf(req *http.Request) ([]byte, error) {
 	switch req.Method {
 	case http.MethodGet:
-		return requestToMsgGet(req)
+		return requestToBufGet(req)
 
 	case http.MethodPost:
-		return requestToMsgPost(req)
+		defer req.Body.Close()
+		return ioutil.ReadAll(req.Body)
 
 	default:
 		return nil, fmt.Errorf("method not allowed: %s", req.Method)
 	}
 }
 
-// requestToMsgPost extracts the dns message from the request body.
-func requestToMsgPost(req *http.Request) (*dns.Msg, error) {
-	defer req.Body.Close()
-	return toMsg(req.Body)
-}
-
-// requestToMsgGet extract the dns message from the GET request.
-func requestToMsgGet(req *http.Request) (*dns.Msg, error) {
+// requestToBufGet extracts the dns message from the GET request.
+func requestToBufGet(req *http.Request) ([]byte, error) {
 	values := req.URL.Query()
 	b64, ok := values["dns"]
 	if !ok {
@@ -89,7 +96,7 @@ func requestToMsgGet(req *http.Request) (*dns.Msg, error) {
 	if len(b64) != 1 {
 		return nil, fmt.Errorf("multiple 'dns' query values found")
 	}
-	return base64ToMsg(b64[0])
+	return b64Enc.DecodeString(b64[0])
 }
 
 func toMsg(r io.ReadCloser) (*dns.Msg, error) {
@@ -102,16 +109,4 @@ func toMsg(r io.ReadCloser) (*dns.Msg, error) {
 	return m, err
 }
 
-func base64ToMsg(b64 string) (*dns.Msg, error) {
-	buf, err := b64Enc.DecodeString(b64)
-	if err != nil {
-		return nil, err
-	}
-
-	m := new(dns.Msg)
-	err = m.Unpack(buf)
-
-	return m, err
-}
-
 var b64Enc = base64.RawURLEncoding
@@ -50,3 +50,30 @@ func TestGetRequest(t *testing.T) {
 		t.Errorf("Qname expected %d, got %d", x, dns.TypeDNSKEY)
 	}
 }
+
+func TestRequestURL(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeDNSKEY)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		req, err := NewRequestURL(method, "https://example.org:443/resolve", m)
+		if err != nil {
+			t.Fatalf("Failure to make %s request: %s", method, err)
+		}
+		if x := req.URL.Path; x != "/resolve" {
+			t.Errorf("Path expected %s, got %s", "/resolve", x)
+		}
+
+		m1, err := RequestToMsg(req)
+		if err != nil {
+			t.Fatalf("Failure to get message from %s request: %s", method, err)
+		}
+		if x := m1.Question[0].Name; x != "example.org." {
+			t.Errorf("Qname expected %s, got %s", "example.org.", x)
+		}
+	}
+
+	if _, err := NewRequestURL(http.MethodPut, "https://example.org:443/resolve", m); err == nil {
+		t.Error("Expected error for PUT request, got none")
+	}
+}
@@ -0,0 +1,76 @@
+// Package doq contains functions that help in implementing DNS-over-QUIC as defined in RFC 9250.
+package doq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// NextProto is the ALPN token that must be used for DoQ, see section 4.1.1 of RFC 9250.
+const NextProto = "doq"
+
+// Application error codes used when closing a QUIC connection or stream, see section 4.3 of RFC 9250.
+const (
+	// CodeNoError is used when the connection or stream needs to be closed, but there is no error to signal.
+	CodeNoError quic.ApplicationErrorCode = 0x0
+	// CodeInternalError signals that the DoQ implementation encountered an internal error.
+	CodeInternalError quic.ApplicationErrorCode = 0x1
+	// CodeProtocolError signals that the DoQ implementation encountered a protocol error.
+	CodeProtocolError quic.ApplicationErrorCode = 0x2
+	// CodeRequestCancelled is used by the client to signal that it is no longer interested in a response.
+	CodeRequestCancelled quic.ApplicationErrorCode = 0x3
+	// CodeExcessiveLoad signals that the connection is closed because the peer generates too much load.
+	CodeExcessiveLoad quic.ApplicationErrorCode = 0x4
+)
+
+// Pack packs m and prepends the 2-octet length field that DoQ uses on every stream.
+func Pack(m *dns.Msg) ([]byte, error) {
+	buf, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	return AddPrefix(buf), nil
+}
+
+// AddPrefix adds the 2-octet length prefix to b.
+func AddPrefix(b []byte) []byte {
+	m := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(m, uint16(len(b)))
+	copy(m[2:], b)
+	return m
+}
+
+// ReadMsg reads a single length prefixed DNS message from r.
+func ReadMsg(r io.Reader) (*dns.Msg, error) {
+	buf, err := ReadBuf(r)
+	if err != nil {
+		return nil, err
+	}
+	m := new(dns.Msg)
+	if err := m.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ReadBuf reads a single length prefixed DNS message from r, and returns it in wire format.
+func ReadBuf(r io.Reader) ([]byte, error) {
+	l := make([]byte, 2)
+	if _, err := io.ReadFull(r, l); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(l)
+	if length < 12 {
+		return nil, fmt.Errorf("message too short: %d", length)
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,42 @@
+package doq
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestPackReadMsg(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeDNSKEY)
+	m.Id = 0
+
+	buf, err := Pack(m)
+	if err != nil {
+		t.Fatalf("Failure to pack: %s", err)
+	}
+	if l := int(buf[0])<<8 | int(buf[1]); l != len(buf)-2 {
+		t.Errorf("Expected length prefix %d, got %d", len(buf)-2, l)
+	}
+
+	m1, err := ReadMsg(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatalf("Failure to read message: %s", err)
+	}
+	if x := m1.Question[0].Name; x != "example.org." {
+		t.Errorf("Expected qname %s, got %s", "example.org.", x)
+	}
+	if x := m1.Question[0].Qtype; x != dns.TypeDNSKEY {
+		t.Errorf("Expected qtype %d, got %d", dns.TypeDNSKEY, x)
+	}
+}
+
+func TestReadMsgShort(t *testing.T) {
+	if _, err := ReadMsg(bytes.NewReader([]byte{0, 4, 1, 2, 3, 4})); err == nil {
+		t.Error("Expected error for too short message, got none")
+	}
+	if _, err := ReadMsg(bytes.NewReader([]byte{0, 40, 1, 2, 3, 4})); err == nil {
+		t.Error("Expected error for truncated message, got none")
+	}
+}
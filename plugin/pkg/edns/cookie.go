@@ -0,0 +1,51 @@
+package edns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// Cookie returns the hex encoded DNS Cookie (RFC 7873) in m, or an empty string if m doesn't have one.
+func Cookie(m *dns.Msg) string {
+	o := m.IsEdns0()
+	if o == nil {
+		return ""
+	}
+	for _, e := range o.Option {
+		if c, ok := e.(*dns.EDNS0_COOKIE); ok {
+			return c.Cookie
+		}
+	}
+	return ""
+}
+
+// SetCookie sets the DNS Cookie in m to the hex encoded cookie, replacing any existing one. If m
+// does not have an OPT record one is added.
+func SetCookie(m *dns.Msg, cookie string) {
+	o := m.IsEdns0()
+	if o == nil {
+		o = new(dns.OPT)
+		o.Hdr.Name = "."
+		o.Hdr.Rrtype = dns.TypeOPT
+		o.SetUDPSize(dns.MinMsgSize)
+		m.Extra = append(m.Extra, o)
+	}
+	RemoveCookie(m)
+	o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: cookie})
+}
+
+// RemoveCookie removes the DNS Cookie from m.
+func RemoveCookie(m *dns.Msg) {
+	o := m.IsEdns0()
+	if o == nil {
+		return
+	}
+	j := 0
+	for _, e := range o.Option {
+		if _, ok := e.(*dns.EDNS0_COOKIE); ok {
+			continue
+		}
+		o.Option[j] = e
+		j++
+	}
+	o.Option = o.Option[:j]
+}
@@ -0,0 +1,38 @@
+package edns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCookie(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	if c := Cookie(m); c != "" {
+		t.Errorf("Expected no cookie, got %s", c)
+	}
+
+	SetCookie(m, "0102030405060708")
+	if c := Cookie(m); c != "0102030405060708" {
+		t.Errorf("Expected cookie %s, got %s", "0102030405060708", c)
+	}
+
+	// Replace the cookie, there should still be only one.
+	m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	SetCookie(m, "0102030405060708090a0b0c0d0e0f1011121314151617")
+	if c := Cookie(m); c != "0102030405060708090a0b0c0d0e0f1011121314151617" {
+		t.Errorf("Expected the replaced cookie, got %s", c)
+	}
+	if len(m.Extra) != 1 || len(m.IsEdns0().Option) != 2 {
+		t.Errorf("Expected a single OPT record with 2 options, got %v", m.Extra)
+	}
+
+	RemoveCookie(m)
+	if c := Cookie(m); c != "" {
+		t.Errorf("Expected no cookie after removal, got %s", c)
+	}
+	if len(m.IsEdns0().Option) != 1 {
+		t.Errorf("Expected the other option to be kept, got %v", m.IsEdns0().Option)
+	}
+}
@@ -72,3 +72,50 @@ func Size(proto string, size uint16) uint16 {
 	}
 	return size
 }
+
+// SetExtendedError adds an Extended DNS Error (RFC 8914) with info code and text to m, which is the
+// reply to req. If m does not have an OPT record one is added. Nothing is done when req isn't an
+// EDNS0 request, as the client won't understand the error then.
+func SetExtendedError(req, m *dns.Msg, code uint16, text string) {
+	if req.IsEdns0() == nil {
+		return
+	}
+	o := m.IsEdns0()
+	if o == nil {
+		o = new(dns.OPT)
+		o.Hdr.Name = "."
+		o.Hdr.Rrtype = dns.TypeOPT
+		o.SetUDPSize(req.IsEdns0().UDPSize())
+		m.Extra = append(m.Extra, o)
+	}
+	o.Option = append(o.Option, &dns.EDNS0_EDE{InfoCode: code, ExtraText: text})
+}
+
+// ExtendedError returns the first Extended DNS Error in m, or nil if there isn't one.
+func ExtendedError(m *dns.Msg) *dns.EDNS0_EDE {
+	o := m.IsEdns0()
+	if o == nil {
+		return nil
+	}
+	for _, e := range o.Option {
+		if ede, ok := e.(*dns.EDNS0_EDE); ok {
+			return ede
+		}
+	}
+	return nil
+}
+
+// Error is an error that carries an Extended DNS Error. A plugin returns it together with an rcode for
+// which it didn't write a reply, and the server adds the Extended DNS Error to the reply it writes.
+// Since no reply was written, plugins in front, like cache, don't see (or store) it.
+type Error struct {
+	Err  error
+	Code uint16
+	Text string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.Err }
@@ -26,6 +26,42 @@ func TestVersionNoEdns(t *testing.T) {
 	}
 }
 
+func TestSetExtendedError(t *testing.T) {
+	req := ednsMsg()
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+
+	SetExtendedError(req, m, dns.ExtendedErrorCodeNetworkError, "timeout")
+	ede := ExtendedError(m)
+	if ede == nil {
+		t.Fatal("Expected an extended error, got none")
+	}
+	if ede.InfoCode != dns.ExtendedErrorCodeNetworkError || ede.ExtraText != "timeout" {
+		t.Errorf("Expected extended error %d with text %q, got %d and %q", dns.ExtendedErrorCodeNetworkError, "timeout", ede.InfoCode, ede.ExtraText)
+	}
+
+	// A second error is added to the same OPT record.
+	SetExtendedError(req, m, dns.ExtendedErrorCodeOther, "")
+	if len(m.Extra) != 1 || len(m.IsEdns0().Option) != 2 {
+		t.Errorf("Expected a single OPT record with 2 options, got %v", m.Extra)
+	}
+}
+
+func TestSetExtendedErrorNoEdns(t *testing.T) {
+	req := ednsMsg()
+	req.Extra = nil
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+
+	SetExtendedError(req, m, dns.ExtendedErrorCodeNetworkError, "")
+	if len(m.Extra) != 0 {
+		t.Errorf("Expected no OPT record for a non EDNS0 request, got %v", m.Extra)
+	}
+	if ExtendedError(m) != nil {
+		t.Errorf("Expected no extended error")
+	}
+}
+
 func ednsMsg() *dns.Msg {
 	m := new(dns.Msg)
 	m.SetQuestion("example.com.", dns.TypeA)
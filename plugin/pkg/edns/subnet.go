@@ -0,0 +1,51 @@
+package edns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// Subnet returns the EDNS Client Subnet option (RFC 7871) in m, or nil if m doesn't have one.
+func Subnet(m *dns.Msg) *dns.EDNS0_SUBNET {
+	o := m.IsEdns0()
+	if o == nil {
+		return nil
+	}
+	for _, e := range o.Option {
+		if s, ok := e.(*dns.EDNS0_SUBNET); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// SetSubnet sets the EDNS Client Subnet option in m to s, replacing any existing one. If m does not
+// have an OPT record one is added.
+func SetSubnet(m *dns.Msg, s *dns.EDNS0_SUBNET) {
+	o := m.IsEdns0()
+	if o == nil {
+		o = new(dns.OPT)
+		o.Hdr.Name = "."
+		o.Hdr.Rrtype = dns.TypeOPT
+		o.SetUDPSize(dns.MinMsgSize)
+		m.Extra = append(m.Extra, o)
+	}
+	RemoveSubnet(m)
+	o.Option = append(o.Option, s)
+}
+
+// RemoveSubnet removes the EDNS Client Subnet option from m, if it has one.
+func RemoveSubnet(m *dns.Msg) {
+	o := m.IsEdns0()
+	if o == nil {
+		return
+	}
+	j := 0
+	for _, e := range o.Option {
+		if _, ok := e.(*dns.EDNS0_SUBNET); ok {
+			continue
+		}
+		o.Option[j] = e
+		j++
+	}
+	o.Option = o.Option[:j]
+}
@@ -0,0 +1,44 @@
+package edns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSubnet(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	if s := Subnet(m); s != nil {
+		t.Errorf("Expected no subnet, got %v", s)
+	}
+
+	SetSubnet(m, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.0.2.0")})
+	SetSubnet(m, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 16, Address: net.ParseIP("192.0.0.0")})
+	s := Subnet(m)
+	if s == nil || s.SourceNetmask != 16 {
+		t.Errorf("Expected the replaced subnet, got %v", s)
+	}
+	if len(m.IsEdns0().Option) != 1 {
+		t.Errorf("Expected a single option, got %v", m.IsEdns0().Option)
+	}
+}
+
+func TestRemoveSubnet(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	RemoveSubnet(m)
+
+	m.SetEdns0(4096, false)
+	o := m.IsEdns0()
+	o.Option = append(o.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	SetSubnet(m, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.0.2.0")})
+	RemoveSubnet(m)
+	if s := Subnet(m); s != nil {
+		t.Errorf("Expected no subnet, got %v", s)
+	}
+	if len(o.Option) != 1 {
+		t.Errorf("Expected the other option to be kept, got %v", o.Option)
+	}
+}
@@ -31,6 +31,14 @@ func HostPortOrFile(s ...string) ([]string, error) {
 
 		trans, host := Transport(h)
 
+		// A DNS-over-HTTPS endpoint may have a path, i.e. https://1.1.1.1/dns-query, keep it around.
+		path := ""
+		if trans == transport.HTTPS {
+			if i := strings.Index(host, "/"); i > 0 {
+				host, path = host[:i], host[i:]
+			}
+		}
+
 		addr, _, err := net.SplitHostPort(host)
 
 		if err != nil {
@@ -53,7 +61,9 @@ func HostPortOrFile(s ...string) ([]string, error) {
 			case transport.GRPC:
 				ss = transport.GRPC + "://" + net.JoinHostPort(host, transport.GRPCPort)
 			case transport.HTTPS:
-				ss = transport.HTTPS + "://" + net.JoinHostPort(host, transport.HTTPSPort)
+				ss = transport.HTTPS + "://" + net.JoinHostPort(host, transport.HTTPSPort) + path
+			case transport.QUIC:
+				ss = transport.QUIC + "://" + net.JoinHostPort(host, transport.QUICPort)
 			}
 			servers = append(servers, ss)
 			continue
@@ -59,6 +59,21 @@ func TestHostPortOrFile(t *testing.T) {
 			"",
 			true,
 		},
+		{
+			"https://1.1.1.1/dns-query",
+			"https://1.1.1.1:443/dns-query",
+			false,
+		},
+		{
+			"https://[2606:4700::1111]:8443/resolve",
+			"https://[2606:4700::1111]:8443/resolve",
+			false,
+		},
+		{
+			"https://dns.example.org/dns-query",
+			"",
+			true,
+		},
 	}
 
 	err := ioutil.WriteFile("resolv.conf", []byte("nameserver 127.0.0.1\n"), 0600)
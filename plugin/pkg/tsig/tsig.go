@@ -0,0 +1,111 @@
+// Package tsig implements TSIG (RFC 8945) keys used to sign and verify zone transfers and notifies.
+package tsig
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Fudge is the number of seconds a signature may differ from our clock.
+const Fudge = 300
+
+// DefaultAlgorithm is used when no algorithm is given for a key.
+const DefaultAlgorithm = "hmac-sha256"
+
+var algorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// ErrUnsigned is returned by Verify when a message does not carry a TSIG record.
+var ErrUnsigned = errors.New("message is not TSIG signed")
+
+// Key is a TSIG key.
+type Key struct {
+	Name      string // Name of the key, fully qualified and lowercased.
+	Algorithm string // Algorithm as used in the TSIG record, i.e. "hmac-sha256.".
+	Secret    string // Secret in base64.
+}
+
+// NewKey returns a new key. If algorithm is empty, DefaultAlgorithm is used.
+func NewKey(name, secret, algorithm string) (*Key, error) {
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
+	}
+	alg, ok := algorithms[strings.TrimSuffix(strings.ToLower(algorithm), ".")]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TSIG algorithm: %q", algorithm)
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+		return nil, fmt.Errorf("invalid TSIG secret for key %q: %s", name, err)
+	}
+	return &Key{Name: dns.CanonicalName(name), Algorithm: alg, Secret: secret}, nil
+}
+
+// Secrets returns the key in the form used by the dns package's clients and servers.
+func (k *Key) Secrets() map[string]string { return map[string]string{k.Name: k.Secret} }
+
+// Sign adds a TSIG record for k to m. The actual signature is calculated when m is written out.
+// As writing a message strips the TSIG record again, m must be signed before each write.
+func (k *Key) Sign(m *dns.Msg) { m.SetTsig(k.Name, k.Algorithm, Fudge, time.Now().Unix()) }
+
+// Verify checks that r is signed with k. The signature itself is validated by the server when reading
+// the message, the result of which is available through w.TsigStatus.
+func (k *Key) Verify(w dns.ResponseWriter, r *dns.Msg) error {
+	t := r.IsTsig()
+	if t == nil {
+		return ErrUnsigned
+	}
+	if !strings.EqualFold(t.Hdr.Name, k.Name) || !strings.EqualFold(t.Algorithm, k.Algorithm) {
+		return dns.ErrSecret
+	}
+	return w.TsigStatus()
+}
+
+// Refuse writes a reply for r, which failed verification with err, to w. Unsigned requests are
+// refused, for signed requests a NOTAUTH reply is written with the TSIG error set, see section 5.2
+// of RFC 8945.
+func Refuse(w dns.ResponseWriter, r *dns.Msg, err error) error {
+	m := new(dns.Msg)
+	t := r.IsTsig()
+	if t == nil {
+		m.SetRcode(r, dns.RcodeRefused)
+		return w.WriteMsg(m)
+	}
+
+	m.SetRcode(r, dns.RcodeNotAuth)
+	m.Extra = append(m.Extra, &dns.TSIG{
+		Hdr:        dns.RR_Header{Name: t.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm:  t.Algorithm,
+		TimeSigned: uint64(time.Now().Unix()),
+		Fudge:      t.Fudge,
+		OrigId:     r.Id,
+		Error:      errorCode(err),
+	})
+	// Pack the message ourselves, the error reply carries a TSIG record, but is not signed.
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// errorCode returns the TSIG error code for err.
+func errorCode(err error) uint16 {
+	switch err {
+	case dns.ErrSecret, dns.ErrKeyAlg:
+		return dns.RcodeBadKey
+	case dns.ErrTime:
+		return dns.RcodeBadTime
+	}
+	return dns.RcodeBadSig
+}
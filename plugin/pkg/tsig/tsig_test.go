@@ -0,0 +1,103 @@
+package tsig
+
+import (
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestNewKey(t *testing.T) {
+	tests := []struct {
+		name, secret, algorithm string
+		expAlgorithm            string
+		shouldErr               bool
+	}{
+		{"key.", "c2VjcmV0", "", dns.HmacSHA256, false},
+		{"Key", "c2VjcmV0", "HMAC-SHA1", dns.HmacSHA1, false},
+		{"key.", "c2VjcmV0", "hmac-sha512.", dns.HmacSHA512, false},
+		{"key.", "c2VjcmV0", "hmac-md5", "", true},
+		{"key.", "secret!", "", "", true},
+	}
+	for i, tc := range tests {
+		k, err := NewKey(tc.name, tc.secret, tc.algorithm)
+		if err != nil {
+			if !tc.shouldErr {
+				t.Errorf("Test %d: expected no error, got %s", i, err)
+			}
+			continue
+		}
+		if tc.shouldErr {
+			t.Errorf("Test %d: expected error, got none", i)
+			continue
+		}
+		if k.Name != "key." {
+			t.Errorf("Test %d: expected name %q, got %q", i, "key.", k.Name)
+		}
+		if k.Algorithm != tc.expAlgorithm {
+			t.Errorf("Test %d: expected algorithm %q, got %q", i, tc.expAlgorithm, k.Algorithm)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	k, _ := NewKey("key.", "c2VjcmV0", "")
+	w := &test.ResponseWriter{}
+
+	m := new(dns.Msg)
+	m.SetAxfr("example.org.")
+	if err := k.Verify(w, m); err != ErrUnsigned {
+		t.Errorf("Expected %s, got %v", ErrUnsigned, err)
+	}
+
+	k.Sign(m)
+	if err := k.Verify(w, m); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	m.SetTsig("other.", dns.HmacSHA256, Fudge, 0)
+	if err := k.Verify(w, m); err != dns.ErrSecret {
+		t.Errorf("Expected %s, got %v", dns.ErrSecret, err)
+	}
+}
+
+func TestRefuse(t *testing.T) {
+	w := &writer{ResponseWriter: &test.ResponseWriter{}}
+
+	m := new(dns.Msg)
+	m.SetAxfr("example.org.")
+	Refuse(w, m, ErrUnsigned)
+	if w.msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeRefused, w.msg.Rcode)
+	}
+
+	m.SetTsig("key.", dns.HmacSHA256, Fudge, 0)
+	Refuse(w, m, dns.ErrSig)
+	if w.msg.Rcode != dns.RcodeNotAuth {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeNotAuth, w.msg.Rcode)
+	}
+	ts := w.msg.IsTsig()
+	if ts == nil {
+		t.Fatal("Expected TSIG record in reply")
+	}
+	if ts.Error != dns.RcodeBadSig {
+		t.Errorf("Expected TSIG error %d, got %d", dns.RcodeBadSig, ts.Error)
+	}
+	if ts.MAC != "" {
+		t.Errorf("Expected empty MAC, got %s", ts.MAC)
+	}
+}
+
+// writer unpacks everything written with Write.
+type writer struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *writer) WriteMsg(m *dns.Msg) error { w.msg = m; return nil }
+
+func (w *writer) Write(b []byte) (int, error) {
+	w.msg = new(dns.Msg)
+	return len(b), w.msg.Unpack(b)
+}
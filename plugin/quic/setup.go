@@ -0,0 +1,68 @@
+package quic
+
+import (
+	"strconv"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+)
+
+func init() { plugin.Register("quic", setup) }
+
+func setup(c *caddy.Controller) error {
+	err := parseQUIC(c)
+	if err != nil {
+		return plugin.Error("quic", err)
+	}
+	return nil
+}
+
+func parseQUIC(c *caddy.Controller) error {
+	config := dnsserver.GetConfig(c)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return plugin.ErrOnce
+		}
+		i++
+
+		if len(c.RemainingArgs()) != 0 {
+			return c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "max_streams":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil {
+					return c.Errf("invalid max_streams value '%s'", args[0])
+				}
+				if n <= 0 {
+					return c.Errf("max_streams must be a positive integer: %d", n)
+				}
+				config.MaxQUICStreams = n
+			case "0rtt":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return c.ArgErr()
+				}
+				switch args[0] {
+				case "accept":
+					config.QUICReject0RTT = false
+				case "reject":
+					config.QUICReject0RTT = true
+				default:
+					return c.Errf("unknown 0rtt mode '%s'", args[0])
+				}
+			default:
+				return c.Errf("unknown option '%s'", c.Val())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package quic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+)
+
+func TestQUIC(t *testing.T) {
+	tests := []struct {
+		input              string
+		shouldErr          bool
+		expectedStreams    int
+		expectedReject0RTT bool
+		expectedErrContent string
+	}{
+		// positive
+		{`quic`, false, 0, false, ""},
+		{`quic {
+			max_streams 100
+		}`, false, 100, false, ""},
+		{`quic {
+			0rtt reject
+		}`, false, 0, true, ""},
+		{`quic {
+			max_streams 10
+			0rtt accept
+		}`, false, 10, false, ""},
+		// negative
+		{`quic foo`, true, 0, false, "Wrong argument count"},
+		{`quic {
+			max_streams 0
+		}`, true, 0, false, "positive integer"},
+		{`quic {
+			max_streams many
+		}`, true, 0, false, "invalid max_streams"},
+		{`quic {
+			0rtt maybe
+		}`, true, 0, false, "unknown 0rtt mode"},
+		{`quic {
+			blah
+		}`, true, 0, false, "unknown option"},
+		{`quic
+		quic`, true, 0, false, "only be used once"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		err := setup(c)
+		cfg := dnsserver.GetConfig(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error but found none for input %s", i, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: Expected no error but found one for input %s. Error was: %v", i, test.input, err)
+			}
+			if !strings.Contains(err.Error(), test.expectedErrContent) {
+				t.Errorf("Test %d: Expected error to contain: %v, found error: %v, input: %s", i, test.expectedErrContent, err, test.input)
+			}
+			continue
+		}
+
+		if cfg.MaxQUICStreams != test.expectedStreams {
+			t.Errorf("Test %d: Expected max streams %d, got %d", i, test.expectedStreams, cfg.MaxQUICStreams)
+		}
+		if cfg.QUICReject0RTT != test.expectedReject0RTT {
+			t.Errorf("Test %d: Expected reject 0rtt %t, got %t", i, test.expectedReject0RTT, cfg.QUICReject0RTT)
+		}
+	}
+}
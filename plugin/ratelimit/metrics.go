@@ -0,0 +1,18 @@
+package ratelimit
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// ThrottledCount is the number of DNS requests that were over their limit.
+	ThrottledCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "throttled_requests_total",
+		Help:      "Counter of DNS requests being throttled.",
+	}, []string{"server", "zone", "action"})
+)
@@ -0,0 +1,147 @@
+// Package ratelimit implements a plugin that limits the number of queries a client can send.
+package ratelimit
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/cookie"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit limits the queries per second a client can send, a client is identified by its
+// (masked) address. Each client has a token bucket per zone and query type.
+type RateLimit struct {
+	Next plugin.Handler
+
+	zones  []string
+	rate   rate.Limit
+	burst  int
+	v4Mask net.IPMask
+	v6Mask net.IPMask
+	action action
+	allow  []*net.IPNet
+
+	buckets *cache.Cache
+}
+
+// action is what we do with a query that is over its limit.
+type action int
+
+const (
+	// actionDrop does not reply to the query.
+	actionDrop action = iota
+	// actionRefuse replies with REFUSED.
+	actionRefuse
+	// actionTruncate replies with an empty, truncated response, so the client retries over TCP.
+	// Queries over TCP, or with a valid DNS Cookie, are never limited with this action.
+	actionTruncate
+)
+
+func (a action) String() string {
+	switch a {
+	case actionRefuse:
+		return "refuse"
+	case actionTruncate:
+		return "truncate"
+	}
+	return "drop"
+}
+
+// New returns a RateLimit with the defaults set.
+func New() *RateLimit {
+	return &RateLimit{
+		rate:    defaultRate,
+		burst:   defaultRate,
+		v4Mask:  net.CIDRMask(32, 32),
+		v6Mask:  net.CIDRMask(128, 128),
+		buckets: cache.New(defaultBuckets),
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RateLimit) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	zone := plugin.Zones(rl.zones).Matches(state.Name())
+	if zone == "" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+	if rl.action == actionTruncate && (state.Proto() == "tcp" || cookie.Valid(ctx)) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	ip := net.ParseIP(state.IP())
+	if rl.allowed(ip) || rl.limiter(ip, zone, state.QType()).Allow() {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	ThrottledCount.WithLabelValues(metrics.WithServer(ctx), zone, rl.action.String()).Inc()
+
+	switch rl.action {
+	case actionRefuse:
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+	case actionTruncate:
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Truncated = true
+		w.WriteMsg(m)
+	}
+	// For actionDrop we don't write anything, but still signal the server we did, so it
+	// doesn't do it for us.
+	return dns.RcodeSuccess, nil
+}
+
+// allowed returns true when ip is in one of the allowed networks, these are never limited.
+func (rl *RateLimit) allowed(ip net.IP) bool {
+	for _, n := range rl.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// limiter returns the token bucket for ip, zone and qtype, creating it when it doesn't exist.
+// Two concurrent queries from a new client may both create one, which only makes us a bit more
+// lenient for the very first queries of that client.
+func (rl *RateLimit) limiter(ip net.IP, zone string, qtype uint16) *rate.Limiter {
+	k := rl.key(ip, zone, qtype)
+	if l, ok := rl.buckets.Get(k); ok {
+		return l.(*rate.Limiter)
+	}
+	l := rate.NewLimiter(rl.rate, rl.burst)
+	rl.buckets.Add(k, l)
+	return l
+}
+
+// key returns the hash of the masked ip, zone and qtype.
+func (rl *RateLimit) key(ip net.IP, zone string, qtype uint16) uint64 {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4.Mask(rl.v4Mask)
+	} else {
+		ip = ip.Mask(rl.v6Mask)
+	}
+	b := make([]byte, 0, len(ip)+len(zone)+2)
+	b = append(b, ip...)
+	b = append(b, zone...)
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	return cache.Hash(b)
+}
+
+// Name implements the plugin.Handler interface.
+func (rl *RateLimit) Name() string { return "ratelimit" }
+
+const (
+	defaultRate    = 50
+	defaultBuckets = 10000
+)
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		config string
+		ip     string
+		tcp    bool
+		qtypes []uint16
+		rcodes []int // expected rcode per query, -1 means no reply
+		tc     bool  // expect the last reply to be truncated
+	}{
+		// burst of 2, third query is dropped
+		{`ratelimit {
+			rate 0.01
+			burst 2
+		}`, "10.0.0.1", false, []uint16{dns.TypeA, dns.TypeA, dns.TypeA}, []int{0, 0, -1}, false},
+		// buckets are per qtype
+		{`ratelimit {
+			rate 0.01
+			burst 1
+		}`, "10.0.0.1", false, []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeA}, []int{0, 0, -1}, false},
+		{`ratelimit {
+			rate 0.01
+			burst 1
+			action refuse
+		}`, "10.0.0.1", false, []uint16{dns.TypeA, dns.TypeA}, []int{0, dns.RcodeRefused}, false},
+		{`ratelimit {
+			rate 0.01
+			burst 1
+			action truncate
+		}`, "10.0.0.1", false, []uint16{dns.TypeA, dns.TypeA}, []int{0, 0}, true},
+		// TCP is not limited when truncating
+		{`ratelimit {
+			rate 0.01
+			burst 1
+			action truncate
+		}`, "10.0.0.1", true, []uint16{dns.TypeA, dns.TypeA}, []int{0, 0}, false},
+		{`ratelimit {
+			rate 0.01
+			burst 1
+			allow 10.0.0.0/8
+		}`, "10.0.0.1", false, []uint16{dns.TypeA, dns.TypeA}, []int{0, 0}, false},
+		// other zones are not limited
+		{`ratelimit example.net {
+			rate 0.01
+			burst 1
+		}`, "10.0.0.1", false, []uint16{dns.TypeA, dns.TypeA}, []int{0, 0}, false},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.config)
+		c.ServerBlockKeys = []string{"example.org."}
+		rl, err := parse(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to parse: %s", i, err)
+		}
+		rl.Next = test.NextHandler(dns.RcodeSuccess, nil)
+
+		var last *dns.Msg
+		for j, qtype := range tc.qtypes {
+			m := new(dns.Msg)
+			m.SetQuestion("example.org.", qtype)
+			w := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tc.ip, TCP: tc.tcp})
+			rl.ServeDNS(context.TODO(), w, m)
+
+			if tc.rcodes[j] == -1 {
+				if w.Msg != nil {
+					t.Errorf("Test %d, query %d: expected no reply, got %v", i, j, w.Msg)
+				}
+				continue
+			}
+			// The test.NextHandler doesn't write, so only a reply from the plugin is seen.
+			if w.Msg != nil && w.Msg.Rcode != tc.rcodes[j] {
+				t.Errorf("Test %d, query %d: expected rcode %s, got %s", i, j, dns.RcodeToString[tc.rcodes[j]], dns.RcodeToString[w.Msg.Rcode])
+			}
+			if tc.rcodes[j] != 0 && w.Msg == nil {
+				t.Errorf("Test %d, query %d: expected a reply", i, j)
+			}
+			last = w.Msg
+		}
+		if tc.tc && (last == nil || !last.Truncated) {
+			t.Errorf("Test %d: expected a truncated reply, got %v", i, last)
+		}
+		if !tc.tc && last != nil && last.Truncated {
+			t.Errorf("Test %d: expected no truncated reply", i)
+		}
+	}
+}
+
+func TestRateLimitPrefix(t *testing.T) {
+	rl, err := parse(caddy.NewTestController("dns", `ratelimit {
+		rate 0.01
+		burst 1
+		prefix 24 64
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.key(net.ParseIP("10.0.0.1"), ".", dns.TypeA) != rl.key(net.ParseIP("10.0.0.200"), ".", dns.TypeA) {
+		t.Error("Expected addresses in the same /24 to share a bucket")
+	}
+	if rl.key(net.ParseIP("10.0.0.1"), ".", dns.TypeA) == rl.key(net.ParseIP("10.0.1.1"), ".", dns.TypeA) {
+		t.Error("Expected addresses in different /24s to have their own bucket")
+	}
+	if rl.key(net.ParseIP("2001:db8::1"), ".", dns.TypeA) != rl.key(net.ParseIP("2001:db8::ffff:1"), ".", dns.TypeA) {
+		t.Error("Expected addresses in the same /64 to share a bucket")
+	}
+	if rl.key(net.ParseIP("10.0.0.1"), "example.org.", dns.TypeA) == rl.key(net.ParseIP("10.0.0.1"), "example.net.", dns.TypeA) {
+		t.Error("Expected zones to have their own bucket")
+	}
+}
@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/cidr"
+
+	"golang.org/x/time/rate"
+)
+
+const pluginName = "ratelimit"
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*RateLimit, error) {
+	rl := New()
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		burst := 0
+		for c.NextBlock() {
+			switch c.Val() {
+			case "rate":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				r, err := strconv.ParseFloat(args[0], 64)
+				if err != nil {
+					return nil, err
+				}
+				if r <= 0 {
+					return nil, c.Errf("rate must be positive: %s", args[0])
+				}
+				rl.rate = rate.Limit(r)
+			case "burst":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				b, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if b <= 0 {
+					return nil, c.Errf("burst must be positive: %d", b)
+				}
+				burst = b
+			case "prefix":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				v4, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if v4 < 0 || v4 > 32 {
+					return nil, c.Errf("invalid IPv4 prefix length: %d", v4)
+				}
+				rl.v4Mask = net.CIDRMask(v4, 32)
+				if len(args) == 2 {
+					v6, err := strconv.Atoi(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if v6 < 0 || v6 > 128 {
+						return nil, c.Errf("invalid IPv6 prefix length: %d", v6)
+					}
+					rl.v6Mask = net.CIDRMask(v6, 128)
+				}
+			case "action":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "drop":
+					rl.action = actionDrop
+				case "refuse":
+					rl.action = actionRefuse
+				case "truncate":
+					rl.action = actionTruncate
+				default:
+					return nil, c.Errf("unknown action: %s, expect 'drop', 'refuse' or 'truncate'", args[0])
+				}
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					n, err := cidr.Parse(a)
+					if err != nil {
+						return nil, c.Errf("illegal CIDR notation %q", a)
+					}
+					rl.allow = append(rl.allow, n)
+				}
+			case "buckets":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				b, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if b <= 0 {
+					return nil, c.Errf("buckets must be positive: %d", b)
+				}
+				rl.buckets = cache.New(b)
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+
+		// Without an explicit burst, allow a second worth of queries.
+		if burst == 0 {
+			burst = int(rl.rate)
+			if burst < 1 {
+				burst = 1
+			}
+		}
+		rl.burst = burst
+	}
+	return rl, nil
+}
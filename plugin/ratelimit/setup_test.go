@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+
+	"golang.org/x/time/rate"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("dns", `ratelimit`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", `ratelimit { rate }`)
+	if err := setup(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		zones     []string
+		rate      rate.Limit
+		burst     int
+		v4, v6    int
+		action    action
+		allowed   int
+	}{
+		{`ratelimit`, false, []string{"."}, defaultRate, defaultRate, 32, 128, actionDrop, 0},
+		{`ratelimit example.org {
+			rate 10
+		}`, false, []string{"example.org."}, 10, 10, 32, 128, actionDrop, 0},
+		{`ratelimit {
+			rate 0.5
+		}`, false, []string{"."}, 0.5, 1, 32, 128, actionDrop, 0},
+		{`ratelimit {
+			rate 10
+			burst 50
+			prefix 24 56
+			action truncate
+			allow 10.0.0.0/8 127.0.0.1
+		}`, false, []string{"."}, 10, 50, 24, 56, actionTruncate, 2},
+		{`ratelimit {
+			prefix 24
+			action refuse
+		}`, false, []string{"."}, defaultRate, defaultRate, 24, 128, actionRefuse, 0},
+		// fails
+		{`ratelimit {
+			rate -1
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			rate fast
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			burst 0
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			prefix 33
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			prefix 24 129
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			action servfail
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			allow example.org
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			buckets 0
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit {
+			blah
+		}`, true, nil, 0, 0, 0, 0, 0, 0},
+		{`ratelimit
+		ratelimit`, true, nil, 0, 0, 0, 0, 0, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		c.ServerBlockKeys = []string{"."}
+		rl, err := parse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			continue
+		}
+
+		if len(rl.zones) != len(test.zones) || rl.zones[0] != test.zones[0] {
+			t.Errorf("Test %d: expected zones %v, got %v", i, test.zones, rl.zones)
+		}
+		if rl.rate != test.rate {
+			t.Errorf("Test %d: expected rate %v, got %v", i, test.rate, rl.rate)
+		}
+		if rl.burst != test.burst {
+			t.Errorf("Test %d: expected burst %d, got %d", i, test.burst, rl.burst)
+		}
+		if ones, _ := rl.v4Mask.Size(); ones != test.v4 {
+			t.Errorf("Test %d: expected IPv4 prefix %d, got %d", i, test.v4, ones)
+		}
+		if ones, _ := rl.v6Mask.Size(); ones != test.v6 {
+			t.Errorf("Test %d: expected IPv6 prefix %d, got %d", i, test.v6, ones)
+		}
+		if rl.action != test.action {
+			t.Errorf("Test %d: expected action %s, got %s", i, test.action, rl.action)
+		}
+		if len(rl.allow) != test.allowed {
+			t.Errorf("Test %d: expected %d allowed networks, got %d", i, test.allowed, len(rl.allow))
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package rrl
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// DropCount is the number of responses dropped because they were over their limit.
+	DropCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "dropped_responses_total",
+		Help:      "Counter of responses dropped because they were over their limit.",
+	}, []string{"server", "kind"})
+	// SlipCount is the number of truncated responses sent instead of responses that were over their limit.
+	SlipCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "truncated_responses_total",
+		Help:      "Counter of truncated responses sent instead of responses that were over their limit.",
+	}, []string{"server", "kind"})
+)
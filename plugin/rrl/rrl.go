@@ -0,0 +1,245 @@
+// Package rrl implements Response Rate Limiting, as done by BIND.
+package rrl
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/cookie"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// RRL limits the rate of identical responses sent to a client network. Responses are accounted per
+// tuple of client prefix, name and kind of response. Only UDP responses are limited, as TCP clients
+// can't spoof their address.
+type RRL struct {
+	Next plugin.Handler
+
+	zones  []string
+	rates  map[response.Type]float64 // responses per second, per kind of response
+	window float64                   // in seconds
+	slip   int
+	v4Mask net.IPMask
+	v6Mask net.IPMask
+	exempt []*net.IPNet
+
+	accounts *cache.Cache
+	now      func() time.Time
+}
+
+// New returns a RRL with the defaults set.
+func New() *RRL {
+	return &RRL{
+		rates:    make(map[response.Type]float64),
+		window:   defaultWindow,
+		slip:     defaultSlip,
+		v4Mask:   net.CIDRMask(24, 32),
+		v6Mask:   net.CIDRMask(56, 128),
+		accounts: cache.New(defaultBuckets),
+		now:      time.Now,
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RRL) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	// Clients over TCP, or with a valid DNS Cookie, can't have a spoofed address.
+	zone := plugin.Zones(rl.zones).Matches(state.Name())
+	if zone == "" || state.Proto() == "tcp" || cookie.Valid(ctx) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+	ip := net.ParseIP(state.IP())
+	if rl.exempted(ip) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, rrl: rl, ctx: ctx, ip: ip}
+	rcode, err := plugin.NextOrFailure(rl.Name(), rl.Next, ctx, rw, r)
+	if plugin.ClientWrite(rcode) || rw.written {
+		return rcode, err
+	}
+
+	// The server writes the error response for us, these are accounted as well.
+	m := new(dns.Msg)
+	m.SetRcode(r, rcode)
+	switch rl.limit(ctx, ip, m) {
+	case drop:
+		return dns.RcodeSuccess, err
+	case slip:
+		w.WriteMsg(truncate(m))
+		return dns.RcodeSuccess, err
+	}
+	return rcode, err
+}
+
+// Name implements the plugin.Handler interface.
+func (rl *RRL) Name() string { return "rrl" }
+
+// exempted returns true when ip is in one of the exempted networks.
+func (rl *RRL) exempted(ip net.IP) bool {
+	for _, n := range rl.exempt {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// verdict is what should happen with a response.
+type verdict int
+
+const (
+	send verdict = iota
+	drop
+	slip
+)
+
+// account tracks the responses sent for a single tuple. The balance is credited with the rate every
+// second, up to the rate, and debited for every response. Responses are limited while it is negative,
+// which it can be for at most window seconds worth of responses.
+type account struct {
+	sync.Mutex
+	balance float64
+	last    time.Time
+	slipped int
+}
+
+// limit does the accounting for response m to ip and returns what to do with it.
+func (rl *RRL) limit(ctx context.Context, ip net.IP, m *dns.Msg) verdict {
+	now := rl.now()
+	kind, _ := response.Typify(m, now)
+	rate := rl.rates[kind]
+	if rate == 0 {
+		return send
+	}
+
+	k := rl.key(ip, kind, m)
+	var a *account
+	if el, ok := rl.accounts.Get(k); ok {
+		a = el.(*account)
+	} else {
+		// A concurrent response may create the same account, losing one response in the accounting.
+		a = &account{balance: rate, last: now}
+		rl.accounts.Add(k, a)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	a.balance += now.Sub(a.last).Seconds() * rate
+	if a.balance > rate {
+		a.balance = rate
+	}
+	a.last = now
+	a.balance--
+	if floor := -rl.window * rate; a.balance < floor {
+		a.balance = floor
+	}
+	if a.balance >= 0 {
+		return send
+	}
+
+	if rl.slip > 0 {
+		a.slipped++
+		if a.slipped >= rl.slip {
+			a.slipped = 0
+			SlipCount.WithLabelValues(metrics.WithServer(ctx), kind.String()).Inc()
+			return slip
+		}
+	}
+	DropCount.WithLabelValues(metrics.WithServer(ctx), kind.String()).Inc()
+	return drop
+}
+
+// key returns the hash of the response tuple: the client's network, the kind of response and the name
+// it is for. Positive answers and NODATA responses are accounted per name and type, for wildcard
+// answers in signed zones the wildcard is used as the name. NXDOMAIN responses and referrals are
+// accounted per zone or delegation, so random names don't escape the accounting. All errors to a client
+// network share a single account.
+func (rl *RRL) key(ip net.IP, kind response.Type, m *dns.Msg) uint64 {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4.Mask(rl.v4Mask)
+	} else {
+		ip = ip.Mask(rl.v6Mask)
+	}
+
+	name := ""
+	qtype := uint16(0)
+	switch kind {
+	case response.NoError, response.NoData:
+		if len(m.Question) > 0 {
+			name = m.Question[0].Name
+			qtype = m.Question[0].Qtype
+		}
+		if w := wildcard(m.Answer); w != "" {
+			name = w
+		}
+	case response.NameError:
+		name = authority(m.Ns, dns.TypeSOA)
+	case response.Delegation:
+		name = authority(m.Ns, dns.TypeNS)
+	}
+	name = strings.ToLower(name)
+
+	b := make([]byte, 0, len(ip)+len(name)+3)
+	b = append(b, ip...)
+	b = append(b, byte(kind))
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	b = append(b, name...)
+	return cache.Hash(b)
+}
+
+// wildcard returns the wildcard name the answer was synthesized from, this is only known when the
+// answer is signed. An empty string is returned otherwise.
+func wildcard(rrs []dns.RR) string {
+	for _, rr := range rrs {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		labels := dns.SplitDomainName(sig.Hdr.Name)
+		if int(sig.Labels) < len(labels) {
+			return "*." + dns.Fqdn(strings.Join(labels[len(labels)-int(sig.Labels):], "."))
+		}
+	}
+	return ""
+}
+
+// authority returns the owner name of the first record of type typ in rrs.
+func authority(rrs []dns.RR, typ uint16) string {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == typ {
+			return rr.Header().Name
+		}
+	}
+	return ""
+}
+
+// truncate returns an empty copy of m with the TC bit set, so the client retries over TCP.
+func truncate(m *dns.Msg) *dns.Msg {
+	t := new(dns.Msg)
+	t.MsgHdr = m.MsgHdr
+	t.Truncated = true
+	t.Question = m.Question
+	if opt := m.IsEdns0(); opt != nil {
+		t.Extra = []dns.RR{opt}
+	}
+	return t
+}
+
+const (
+	defaultWindow  = 15
+	defaultSlip    = 2
+	defaultBuckets = 100000
+)
@@ -0,0 +1,201 @@
+package rrl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/cookie"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// answer is a handler that answers every query for a name in example.org with an A record,
+// except nx.example.org and its children, which don't exist.
+var answer = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if dns.IsSubDomain("nx.example.org.", r.Question[0].Name) {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{test.SOA("example.org. 300 IN SOA ns.example.org. hostmaster.example.org. 1 7200 1800 86400 300")}
+	} else {
+		m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 127.0.0.1")}
+	}
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+})
+
+func newRRL(t *testing.T, config string) (*RRL, *time.Time) {
+	c := caddy.NewTestController("dns", config)
+	c.ServerBlockKeys = []string{"example.org."}
+	rl, err := parse(c)
+	if err != nil {
+		t.Fatalf("Failed to parse: %s", err)
+	}
+	rl.Next = answer
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+	return rl, &now
+}
+
+// query sends a query for qname from ip, it returns the response or nil if nothing was written.
+func query(rl *RRL, ip, qname string, tcp bool) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	w := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip, TCP: tcp})
+	rl.ServeDNS(context.TODO(), w, m)
+	return w.Msg
+}
+
+func TestRRL(t *testing.T) {
+	rl, _ := newRRL(t, `rrl {
+		responses_per_second 2
+		slip 0
+	}`)
+
+	for i := 0; i < 2; i++ {
+		if m := query(rl, "10.0.0.1", "a.example.org.", false); m == nil {
+			t.Fatalf("Expected response %d to be sent", i)
+		}
+	}
+	if m := query(rl, "10.0.0.1", "a.example.org.", false); m != nil {
+		t.Errorf("Expected response to be dropped, got %v", m)
+	}
+	// Same network, same account.
+	if m := query(rl, "10.0.0.2", "a.example.org.", false); m != nil {
+		t.Errorf("Expected response to be dropped, got %v", m)
+	}
+	// Other name, other account.
+	if m := query(rl, "10.0.0.1", "b.example.org.", false); m == nil {
+		t.Errorf("Expected response for other name to be sent")
+	}
+	// Other network, other account.
+	if m := query(rl, "10.0.1.1", "a.example.org.", false); m == nil {
+		t.Errorf("Expected response to other network to be sent")
+	}
+	// TCP is never limited.
+	if m := query(rl, "10.0.0.1", "a.example.org.", true); m == nil {
+		t.Errorf("Expected response over TCP to be sent")
+	}
+	// Other zones are not limited.
+	for i := 0; i < 3; i++ {
+		if m := query(rl, "10.0.0.1", "example.net.", false); m == nil {
+			t.Errorf("Expected response %d for other zone to be sent", i)
+		}
+	}
+}
+
+func TestRRLNameError(t *testing.T) {
+	rl, _ := newRRL(t, `rrl {
+		responses_per_second 10
+		nxdomains_per_second 1
+		slip 0
+	}`)
+
+	// Random names in the zone are accounted together.
+	if m := query(rl, "10.0.0.1", "a.nx.example.org.", false); m == nil {
+		t.Fatal("Expected first NXDOMAIN to be sent")
+	}
+	if m := query(rl, "10.0.0.1", "b.nx.example.org.", false); m != nil {
+		t.Errorf("Expected second NXDOMAIN to be dropped, got %v", m)
+	}
+}
+
+func TestRRLSlip(t *testing.T) {
+	rl, _ := newRRL(t, `rrl {
+		responses_per_second 1
+		slip 2
+	}`)
+
+	query(rl, "10.0.0.1", "a.example.org.", false)
+	if m := query(rl, "10.0.0.1", "a.example.org.", false); m != nil {
+		t.Errorf("Expected first limited response to be dropped, got %v", m)
+	}
+	m := query(rl, "10.0.0.1", "a.example.org.", false)
+	if m == nil || !m.Truncated || len(m.Answer) != 0 {
+		t.Errorf("Expected second limited response to be truncated, got %v", m)
+	}
+}
+
+func TestRRLWindow(t *testing.T) {
+	rl, now := newRRL(t, `rrl {
+		responses_per_second 1
+		window 2s
+		slip 0
+	}`)
+
+	// Run up the maximum debt.
+	for i := 0; i < 10; i++ {
+		query(rl, "10.0.0.1", "a.example.org.", false)
+	}
+	*now = now.Add(1 * time.Second)
+	if m := query(rl, "10.0.0.1", "a.example.org.", false); m != nil {
+		t.Errorf("Expected response to still be dropped, got %v", m)
+	}
+	*now = now.Add(3 * time.Second)
+	if m := query(rl, "10.0.0.1", "a.example.org.", false); m == nil {
+		t.Errorf("Expected response to be sent after the window")
+	}
+}
+
+func TestRRLExempt(t *testing.T) {
+	rl, _ := newRRL(t, `rrl {
+		responses_per_second 1
+		exempt 10.0.0.0/8
+	}`)
+
+	for i := 0; i < 3; i++ {
+		if m := query(rl, "10.0.0.1", "a.example.org.", false); m == nil {
+			t.Errorf("Expected response %d to exempted client to be sent", i)
+		}
+	}
+}
+
+func TestRRLCookie(t *testing.T) {
+	rl, _ := newRRL(t, `rrl {
+		responses_per_second 1
+		slip 0
+	}`)
+	c := cookie.New(0)
+	c.Next = rl
+
+	send := func(ck string) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("a.example.org.", dns.TypeA)
+		m.SetEdns0(4096, false)
+		edns.SetCookie(m, ck)
+		w := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "10.0.0.1"})
+		c.ServeDNS(context.TODO(), w, m)
+		return w.Msg
+	}
+
+	m := send("0102030405060708")
+	if m == nil {
+		t.Fatal("Expected first response to be sent")
+	}
+	// With a valid server cookie the client isn't limited.
+	ck := edns.Cookie(m)
+	for i := 0; i < 3; i++ {
+		if m := send(ck); m == nil {
+			t.Errorf("Expected response %d with a valid cookie to be sent", i)
+		}
+	}
+	if m := send("0102030405060708"); m != nil {
+		t.Errorf("Expected response without a valid cookie to be dropped, got %v", m)
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	sig := test.RRSIG("a.b.example.org. 300 IN RRSIG A 13 3 300 20300101000000 20200101000000 12345 example.org. c2ln")
+	if w := wildcard([]dns.RR{sig}); w != "*.b.example.org." {
+		t.Errorf("Expected wildcard *.b.example.org., got %q", w)
+	}
+	sig.Labels = 4
+	if w := wildcard([]dns.RR{sig}); w != "" {
+		t.Errorf("Expected no wildcard, got %q", w)
+	}
+}
@@ -0,0 +1,185 @@
+package rrl
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/cidr"
+	"github.com/coredns/coredns/plugin/pkg/response"
+)
+
+const pluginName = "rrl"
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*RRL, error) {
+	rl := New()
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		// Rates that are not set, default to responses_per_second.
+		responses := 0.0
+		rates := map[response.Type]float64{}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "responses_per_second":
+				r, err := parseRate(c)
+				if err != nil {
+					return nil, err
+				}
+				responses = r
+			case "nodata_per_second":
+				r, err := parseRate(c)
+				if err != nil {
+					return nil, err
+				}
+				rates[response.NoData] = r
+			case "nxdomains_per_second":
+				r, err := parseRate(c)
+				if err != nil {
+					return nil, err
+				}
+				rates[response.NameError] = r
+			case "referrals_per_second":
+				r, err := parseRate(c)
+				if err != nil {
+					return nil, err
+				}
+				rates[response.Delegation] = r
+			case "errors_per_second":
+				r, err := parseRate(c)
+				if err != nil {
+					return nil, err
+				}
+				rates[response.ServerError] = r
+				rates[response.OtherError] = r
+			case "window":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if d < time.Second || d > time.Hour {
+					return nil, c.Errf("window must be between 1s and 1h: %s", d)
+				}
+				rl.window = d.Seconds()
+			case "slip":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				s, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if s < 0 || s > 10 {
+					return nil, c.Errf("slip must be between 0 and 10: %d", s)
+				}
+				rl.slip = s
+			case "prefix":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				v4, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if v4 < 0 || v4 > 32 {
+					return nil, c.Errf("invalid IPv4 prefix length: %d", v4)
+				}
+				rl.v4Mask = net.CIDRMask(v4, 32)
+				if len(args) == 2 {
+					v6, err := strconv.Atoi(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if v6 < 0 || v6 > 128 {
+						return nil, c.Errf("invalid IPv6 prefix length: %d", v6)
+					}
+					rl.v6Mask = net.CIDRMask(v6, 128)
+				}
+			case "exempt":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, a := range args {
+					n, err := cidr.Parse(a)
+					if err != nil {
+						return nil, c.Errf("illegal CIDR notation %q", a)
+					}
+					rl.exempt = append(rl.exempt, n)
+				}
+			case "buckets":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				b, err := strconv.Atoi(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if b <= 0 {
+					return nil, c.Errf("buckets must be positive: %d", b)
+				}
+				rl.accounts = cache.New(b)
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+
+		rl.rates[response.NoError] = responses
+		for _, t := range []response.Type{response.NoData, response.NameError, response.Delegation, response.ServerError, response.OtherError} {
+			rl.rates[t] = responses
+			if r, ok := rates[t]; ok {
+				rl.rates[t] = r
+			}
+		}
+	}
+	return rl, nil
+}
+
+func parseRate(c *caddy.Controller) (float64, error) {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	r, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	if r < 0 {
+		return 0, c.Errf("rate can not be negative: %s", args[0])
+	}
+	return r, nil
+}
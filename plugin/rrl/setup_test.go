@@ -0,0 +1,120 @@
+package rrl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/response"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("dns", `rrl {
+		responses_per_second 10
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+
+	c = caddy.NewTestController("dns", `rrl {
+		responses_per_second
+	}`)
+	if err := setup(c); err == nil {
+		t.Fatalf("Expected errors, but got: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		rates     map[response.Type]float64
+		window    time.Duration
+		slip      int
+		v4, v6    int
+		exempt    int
+	}{
+		{`rrl`, false, map[response.Type]float64{response.NoError: 0, response.NameError: 0}, 15 * time.Second, 2, 24, 56, 0},
+		{`rrl {
+			responses_per_second 10
+		}`, false, map[response.Type]float64{response.NoError: 10, response.NoData: 10, response.NameError: 10, response.Delegation: 10, response.ServerError: 10}, 15 * time.Second, 2, 24, 56, 0},
+		{`rrl {
+			responses_per_second 10
+			nodata_per_second 5
+			nxdomains_per_second 1
+			referrals_per_second 0
+			errors_per_second 0.5
+			window 5s
+			slip 0
+			prefix 16 48
+			exempt 10.0.0.0/8 ::1
+		}`, false, map[response.Type]float64{response.NoError: 10, response.NoData: 5, response.NameError: 1, response.Delegation: 0, response.ServerError: 0.5, response.OtherError: 0.5}, 5 * time.Second, 0, 16, 48, 2},
+		// fails
+		{`rrl {
+			responses_per_second -1
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			errors_per_second many
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			window 0s
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			window 15
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			slip 11
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			prefix 33
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			exempt example.org
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			buckets -1
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl {
+			blah
+		}`, true, nil, 0, 0, 0, 0, 0},
+		{`rrl
+		rrl`, true, nil, 0, 0, 0, 0, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		rl, err := parse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			continue
+		}
+
+		for kind, rate := range test.rates {
+			if rl.rates[kind] != rate {
+				t.Errorf("Test %d: expected rate %v for %s, got %v", i, rate, kind, rl.rates[kind])
+			}
+		}
+		if rl.window != test.window.Seconds() {
+			t.Errorf("Test %d: expected window %v, got %vs", i, test.window, rl.window)
+		}
+		if rl.slip != test.slip {
+			t.Errorf("Test %d: expected slip %d, got %d", i, test.slip, rl.slip)
+		}
+		if ones, _ := rl.v4Mask.Size(); ones != test.v4 {
+			t.Errorf("Test %d: expected IPv4 prefix %d, got %d", i, test.v4, ones)
+		}
+		if ones, _ := rl.v6Mask.Size(); ones != test.v6 {
+			t.Errorf("Test %d: expected IPv6 prefix %d, got %d", i, test.v6, ones)
+		}
+		if len(rl.exempt) != test.exempt {
+			t.Errorf("Test %d: expected %d exempted networks, got %d", i, test.exempt, len(rl.exempt))
+		}
+	}
+}
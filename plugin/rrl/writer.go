@@ -0,0 +1,31 @@
+package rrl
+
+import (
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// ResponseWriter is a ResponseWriter that does the response rate limiting. Responses that are over
+// their limit are dropped or written as a truncated response.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	rrl *RRL
+	ctx context.Context
+	ip  net.IP
+
+	written bool
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	w.written = true
+	switch w.rrl.limit(w.ctx, w.ip, res) {
+	case drop:
+		return nil
+	case slip:
+		return w.ResponseWriter.WriteMsg(truncate(res))
+	}
+	return w.ResponseWriter.WriteMsg(res)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/file"
 	"github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 )
 
@@ -17,6 +18,15 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("secondary", err)
 	}
 
+	// Register the keys with the server, so it verifies signed notifies.
+	for _, n := range zones.Names {
+		if k := zones.Z[n].TsigKey; k != nil {
+			if err := dnsserver.GetConfig(c).AddTsigSecret(k.Name, k.Secret); err != nil {
+				return plugin.Error("secondary", err)
+			}
+		}
+	}
+
 	// Add startup functions to retrieve the zone and keep it up to date.
 	for _, n := range zones.Names {
 		z := zones.Z[n]
@@ -56,6 +66,7 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 			for c.NextBlock() {
 
 				f := []string{}
+				var key *tsig.Key
 
 				switch c.Val() {
 				case "transfer":
@@ -64,6 +75,17 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 					if err != nil {
 						return file.Zones{}, err
 					}
+				case "tsig":
+					args := c.RemainingArgs()
+					if len(args) != 2 && len(args) != 3 {
+						return file.Zones{}, c.ArgErr()
+					}
+					args = append(args, "")
+					var err error
+					key, err = tsig.NewKey(args[0], args[1], args[2])
+					if err != nil {
+						return file.Zones{}, c.Err(err.Error())
+					}
 				default:
 					return file.Zones{}, c.Errf("unknown property '%s'", c.Val())
 				}
@@ -72,6 +94,9 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 					if f != nil {
 						z[origin].TransferFrom = append(z[origin].TransferFrom, f...)
 					}
+					if key != nil {
+						z[origin].TsigKey = key
+					}
 					z[origin].Upstream = upstream.New()
 				}
 			}
@@ -35,6 +35,24 @@ func TestSecondaryParse(t *testing.T) {
 			"127.0.0.1:53",
 			[]string{"example.org."},
 		},
+		{
+			`secondary example.org {
+				transfer from 127.0.0.1
+				tsig transfer.key. c2VjcmV0
+			}`,
+			false,
+			"127.0.0.1:53",
+			[]string{"example.org."},
+		},
+		{
+			`secondary example.org {
+				transfer from 127.0.0.1
+				tsig transfer.key.
+			}`,
+			true,
+			"",
+			nil,
+		},
 	}
 
 	for i, test := range tests {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/coredns/coredns/plugin/pkg/rcode"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 
 	"github.com/miekg/dns"
 )
@@ -23,13 +24,16 @@ func (t *Transfer) Notify(zone string) error {
 	if x == nil {
 		return fmt.Errorf("no such zone registred in the transfer plugin: %s", zone)
 	}
+	if x.key != nil {
+		c.TsigSecret = x.key.Secrets()
+	}
 
 	var err1 error
 	for _, t := range x.to {
 		if t == "*" {
 			continue
 		}
-		if err := sendNotify(c, m, t); err != nil {
+		if err := sendNotify(c, m, t, x.key); err != nil {
 			err1 = err
 		}
 	}
@@ -37,12 +41,18 @@ func (t *Transfer) Notify(zone string) error {
 	return err1 // this only captures the last error
 }
 
-func sendNotify(c *dns.Client, m *dns.Msg, s string) error {
+func sendNotify(c *dns.Client, m *dns.Msg, s string, key *tsig.Key) error {
 	var err error
 
 	code := dns.RcodeServerFailure
 	for i := 0; i < 3; i++ {
-		ret, _, err := c.Exchange(m, s)
+		req := m
+		if key != nil {
+			// Sending strips the TSIG record, so sign a fresh copy every time.
+			req = m.Copy()
+			key.Sign(req)
+		}
+		ret, _, err := c.Exchange(req, s)
 		if err != nil {
 			continue
 		}
@@ -6,6 +6,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 )
 
 func init() {
@@ -22,6 +23,16 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("transfer", err)
 	}
 
+	// Register the keys with the server, so it verifies signed requests.
+	for _, x := range t.xfrs {
+		if x.key == nil {
+			continue
+		}
+		if err := dnsserver.GetConfig(c).AddTsigSecret(x.key.Name, x.key.Secret); err != nil {
+			return plugin.Error("transfer", err)
+		}
+	}
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		t.Next = next
 		return t
@@ -66,6 +77,17 @@ func parseTransfer(c *caddy.Controller) (*Transfer, error) {
 					}
 					x.to = append(x.to, normalized)
 				}
+			case "tsig":
+				args := c.RemainingArgs()
+				if len(args) != 2 && len(args) != 3 {
+					return nil, c.ArgErr()
+				}
+				args = append(args, "")
+				key, err := tsig.NewKey(args[0], args[1], args[2])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				x.key = key
 			default:
 				return nil, plugin.Error("transfer", c.Errf("unknown property %q", c.Val()))
 			}
@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
+
+	"github.com/miekg/dns"
 )
 
 func TestParse(t *testing.T) {
@@ -31,6 +34,20 @@ func TestParse(t *testing.T) {
 				}},
 			},
 		},
+		{`transfer example.org {
+			to 1.2.3.4
+			tsig Transfer.Key c2VjcmV0 HMAC-SHA512
+		 }`,
+			nil,
+			false,
+			&Transfer{
+				xfrs: []*xfr{{
+					Zones: []string{"example.org."},
+					to:    []string{"1.2.3.4:53"},
+					key:   &tsig.Key{Name: "transfer.key.", Algorithm: dns.HmacSHA512, Secret: "c2VjcmV0"},
+				}},
+			},
+		},
 		// errors
 		{`transfer example.net example.org {
 		 }`,
@@ -54,6 +71,22 @@ func TestParse(t *testing.T) {
 			true,
 			nil,
 		},
+		{`transfer example.org {
+			to 1.2.3.4
+			tsig transfer.key c2VjcmV0 hmac-md4
+		 }`,
+			nil,
+			true,
+			nil,
+		},
+		{`transfer example.org {
+			to 1.2.3.4
+			tsig transfer.key not-base64
+		 }`,
+			nil,
+			true,
+			nil,
+		},
 		{
 			`transfer {
 			to 1.2.3.4 5.6.7.8:1053 [1::2]:34
@@ -111,6 +144,12 @@ func TestParse(t *testing.T) {
 
 				}
 			}
+			// Check key
+			if k := tc.exp.xfrs[j].key; k != nil {
+				if x.key == nil || *x.key != *k {
+					t.Errorf("Test %d expected key %v, got %v", i, k, x.key)
+				}
+			}
 		}
 	}
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"net"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/tsig"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -24,6 +26,7 @@ type Transfer struct {
 type xfr struct {
 	Zones []string
 	to    []string
+	key   *tsig.Key // if not nil, requests must be signed with this key
 }
 
 // Transferer may be implemented by plugins to enable zone transfers
@@ -41,8 +44,11 @@ type Transferer interface {
 	//
 	// If serial is not 0, it will be handled as an IXFR request. If the serial is equal to or greater (newer) than
 	// the current serial for the zone, send a single SOA record to the channel and then close it.
-	// If the serial is less (older) than the current serial for the zone, perform an AXFR fallback
-	// by proceeding as if an AXFR was requested (as above).
+	// If the serial is less (older) than the current serial for the zone and the plugin knows the
+	// changes since that serial, it may send an incremental transfer as described in RFC 1995: the
+	// current SOA, then for each change the old SOA followed by the deleted records and the new SOA
+	// followed by the added records, and finally the current SOA again. Otherwise perform an AXFR
+	// fallback by proceeding as if an AXFR was requested (as above).
 	Transfer(zone string, serial uint32) (<-chan []dns.RR, error)
 }
 
@@ -75,6 +81,14 @@ func (t *Transfer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		return 0, nil
 	}
 
+	if x.key != nil {
+		if err := x.key.Verify(w, r); err != nil {
+			log.Warningf("Refusing transfer of zone %q to %s: %s", state.QName(), state.IP(), err)
+			tsig.Refuse(w, r, err)
+			return 0, nil
+		}
+	}
+
 	// Get serial from request if this is an IXFR.
 	var serial uint32
 	if state.QType() == dns.TypeIXFR {
@@ -121,9 +135,15 @@ func (t *Transfer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 	rrs := []dns.RR{}
 	l := 0
 	var soa *dns.SOA
+	incremental := false
 	for records := range pchan {
-		if x, ok := records[0].(*dns.SOA); ok && soa == nil {
-			soa = x
+		if x, ok := records[0].(*dns.SOA); ok {
+			if soa == nil {
+				soa = x
+			} else if l+len(rrs) == 1 {
+				// A second SOA directly after the first one starts an incremental transfer.
+				incremental = true
+			}
 		}
 		rrs = append(rrs, records...)
 		if len(rrs) > 500 {
@@ -150,6 +170,9 @@ func (t *Transfer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 		m := new(dns.Msg)
 		m.SetReply(r)
 		m.Answer = []dns.RR{soa}
+		if t := r.IsTsig(); t != nil && w.TsigStatus() == nil {
+			m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+		}
 		w.WriteMsg(m)
 
 		log.Infof("Outgoing noop, incremental transfer for up to date zone %q to %s for %d SOA serial", state.QName(), state.IP(), soa.Serial)
@@ -176,6 +199,10 @@ func (t *Transfer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 	if soa != nil {
 		logserial = soa.Serial
 	}
+	if incremental {
+		log.Infof("Outgoing incremental transfer of %d records of zone %q to %s from %d to %d SOA serial", l, state.QName(), state.IP(), serial, logserial)
+		return 0, nil
+	}
 	log.Infof("Outgoing transfer of %d records of zone %q to %s for %d SOA serial", l, state.QName(), state.IP(), logserial)
 	return 0, nil
 }
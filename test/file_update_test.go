@@ -0,0 +1,99 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneDynamicUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+	defer os.Remove(name) // persist replaces the file
+
+	const secret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+
+	corefile := `example.org:0 {
+		file ` + name + ` {
+			update *
+			tsig update.key. ` + secret + `
+			persist
+		}
+	}`
+
+	i, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	// Unsigned updates are refused.
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.A("host.example.org. 300 IN A 10.0.0.1")})
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[dns.RcodeRefused], dns.RcodeToString[r.Rcode])
+	}
+
+	// Only add the record when the name isn't in use yet.
+	c := &dns.Client{TsigSecret: map[string]string{"update.key.": secret}}
+	m = new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.NameNotUsed([]dns.RR{test.A("host.example.org. 300 IN A 10.0.0.1")})
+	m.Insert([]dns.RR{test.A("host.example.org. 300 IN A 10.0.0.1")})
+	m.SetTsig("update.key.", dns.HmacSHA256, 300, time.Now().Unix())
+	r, _, err = c.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected rcode %s, got %s", dns.RcodeToString[dns.RcodeSuccess], dns.RcodeToString[r.Rcode])
+	}
+
+	q := new(dns.Msg)
+	q.SetQuestion("host.example.org.", dns.TypeA)
+	r, err = dns.Exchange(q, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if len(r.Answer) != 1 {
+		t.Fatalf("Expected 1 RR in answer section, got %d", len(r.Answer))
+	}
+
+	q.SetQuestion("example.org.", dns.TypeSOA)
+	r, _ = dns.Exchange(q, udp)
+	if soa := r.Answer[0].(*dns.SOA); soa.Serial != 2015082542 {
+		t.Errorf("Expected serial to be increased to %d, got %d", 2015082542, soa.Serial)
+	}
+
+	// The same prerequisite now fails.
+	m.SetTsig("update.key.", dns.HmacSHA256, 300, time.Now().Unix())
+	r, _, err = c.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Expected to receive reply, but didn't: %s", err)
+	}
+	if r.Rcode != dns.RcodeYXDomain {
+		t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[dns.RcodeYXDomain], dns.RcodeToString[r.Rcode])
+	}
+
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Failed to read zone file: %s", err)
+	}
+	if !strings.Contains(string(buf), "host.example.org.\t300\tIN\tA\t10.0.0.1") {
+		t.Errorf("Expected updated zone to be written to disk, got:\n%s", buf)
+	}
+}
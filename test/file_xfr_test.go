@@ -2,6 +2,7 @@ package test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"testing"
 	"time"
@@ -100,3 +101,61 @@ func TestLargeAXFR(t *testing.T) {
 		t.Fatalf("Expected a AAAA answer, but it wasn't: type %d", resp.Answer[len(resp.Answer)-1].Header().Rrtype)
 	}
 }
+
+func TestIncrementalIXFR(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `example.org:0 {
+		file ` + name + ` {
+			reload 0.01s
+		}
+		transfer {
+			to *
+		}
+	}`
+
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	// Bump the serial and delete a single record.
+	updated := strings.Replace(exampleOrg, "2015082541", "2015082542", 1)
+	updated = strings.Replace(updated, "short   1    IN  A      127.0.0.3\n", "", 1)
+	ioutil.WriteFile(name, []byte(updated), 0644)
+	time.Sleep(50 * time.Millisecond) // reload time, with some race insurance
+
+	m := new(dns.Msg)
+	m.SetIxfr("example.org.", 2015082541, "sns.dns.icann.org.", "noc.dns.icann.org.")
+	tr := new(dns.Transfer)
+	ch, err := tr.In(m, tcp)
+	if err != nil {
+		t.Fatalf("Failed to transfer: %s", err)
+	}
+	rrs := []dns.RR{}
+	for env := range ch {
+		if env.Error != nil {
+			t.Fatalf("Failed to transfer: %s", env.Error)
+		}
+		rrs = append(rrs, env.RR...)
+	}
+
+	// new SOA, old SOA, deleted record, new SOA, new SOA
+	if len(rrs) != 5 {
+		t.Fatalf("Expected %d records, got %d: %v", 5, len(rrs), rrs)
+	}
+	if soa, ok := rrs[1].(*dns.SOA); !ok || soa.Serial != 2015082541 {
+		t.Errorf("Expected the old SOA as second record, got %s", rrs[1])
+	}
+	if rrs[2].Header().Name != "short.example.org." {
+		t.Errorf("Expected short.example.org. to be deleted, got %s", rrs[2])
+	}
+	if soa, ok := rrs[3].(*dns.SOA); !ok || soa.Serial != 2015082542 {
+		t.Errorf("Expected the new SOA after the deleted record, got %s", rrs[3])
+	}
+}
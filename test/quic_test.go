@@ -0,0 +1,160 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/doq"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+var quicCorefile = `quic://.:0 {
+		tls ../plugin/tls/test_cert.pem ../plugin/tls/test_key.pem
+		whoami
+	}`
+
+func TestQUIC(t *testing.T) {
+	q, udp, _, err := CoreDNSServerAndPorts(quicCorefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, udp, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{doq.NextProto}}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	defer conn.CloseWithError(doq.CodeNoError, "")
+
+	m := new(dns.Msg)
+	m.SetQuestion("whoami.example.org.", dns.TypeA)
+	m.Id = 0
+	buf, _ := doq.Pack(m)
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	if _, err := stream.Write(buf); err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	stream.Close()
+
+	d, err := doq.ReadMsg(stream)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	if d.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected success but got %d", d.Rcode)
+	}
+	if len(d.Extra) != 2 {
+		t.Errorf("Expected 2 RRs in additional section, but got %d", len(d.Extra))
+	}
+}
+
+func TestQUICProtocolError(t *testing.T) {
+	q, udp, _, err := CoreDNSServerAndPorts(quicCorefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, udp, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{doq.NextProto}}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("whoami.example.org.", dns.TypeA)
+	m.Id = 1 // DoQ requires the ID to be 0.
+	buf, _ := doq.Pack(m)
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	stream.Write(buf)
+	stream.Close()
+
+	if _, err := doq.ReadMsg(stream); err == nil {
+		t.Fatal("Expected error for non-zero message ID, got none")
+	}
+	select {
+	case <-conn.Context().Done():
+	case <-ctx.Done():
+		t.Fatal("Expected connection to be closed with a protocol error")
+	}
+}
+
+func TestQUICTsig(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `quic://example.org:0 {
+		tls ../plugin/tls/test_cert.pem ../plugin/tls/test_key.pem
+		file ` + name + `
+		transfer {
+			to *
+			tsig transfer.key. c2VjcmV0LXNlY3JldC1zZWNyZXQ=
+		}
+	}`
+
+	q, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, udp, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{doq.NextProto}}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	defer conn.CloseWithError(doq.CodeNoError, "")
+
+	// Sign the request with the right key name, but the wrong secret.
+	m := new(dns.Msg)
+	m.SetAxfr("example.org.")
+	m.Id = 0
+	m.SetTsig("transfer.key.", dns.HmacSHA256, 300, time.Now().Unix())
+	buf, _, err := dns.TsigGenerate(m, "b3RoZXItc2VjcmV0", "", false)
+	if err != nil {
+		t.Fatalf("Failed to sign the request: %s", err)
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	if _, err := stream.Write(doq.AddPrefix(buf)); err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	stream.Close()
+
+	d, err := doq.ReadMsg(stream)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	if d.Rcode != dns.RcodeNotAuth {
+		t.Errorf("Expected NOTAUTH but got %s", dns.RcodeToString[d.Rcode])
+	}
+	if len(d.Answer) != 0 {
+		t.Errorf("Expected no records, got %d", len(d.Answer))
+	}
+}
@@ -21,6 +21,7 @@ var contents = map[string]string{
 	"Kexample.org.+013+45330.key":     examplePub,
 	"Kexample.org.+013+45330.private": examplePriv,
 	"example.org.signed":              exampleOrg, // not signed, but does not matter for this test.
+	"routes.conf":                     "corp.example.org corp\n",
 }
 
 const (
@@ -132,3 +132,103 @@ func TestIxfrResponse(t *testing.T) {
 		t.Fatalf("Serial should be %d, got %d", 2015082541, soa.Serial)
 	}
 }
+
+func TestSecondaryZoneTransferTsig(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	const secret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+
+	corefile := `example.org:0 {
+		file ` + name + `
+		transfer {
+			to *
+			tsig transfer.key. ` + secret + `
+		}
+	}`
+
+	i, _, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	// Unsigned transfers are refused.
+	m := new(dns.Msg)
+	m.SetAxfr("example.org.")
+	tr := new(dns.Transfer)
+	if _, err := receiveTransfer(tr, m, tcp); err == nil {
+		t.Fatal("Expected unsigned transfer to fail")
+	}
+
+	// Transfers signed with an unknown key get a NOTAUTH with BADKEY. Write the packed message
+	// ourselves, as the dns package refuses to send messages for keys it doesn't know.
+	m = new(dns.Msg)
+	m.SetAxfr("example.org.")
+	m.SetTsig("other.key.", dns.HmacSHA256, 300, time.Now().Unix())
+	buf, _ := m.Pack()
+	co, err := dns.Dial("tcp", tcp)
+	if err != nil {
+		t.Fatalf("Failed to dial: %s", err)
+	}
+	defer co.Close()
+	if _, err := co.Write(buf); err != nil {
+		t.Fatalf("Failed to write: %s", err)
+	}
+	// ReadMsg complains about the unknown key, but still returns the reply.
+	r, _ := co.ReadMsg()
+	if r == nil {
+		t.Fatal("Expected reply, got none")
+	}
+	if r.Rcode != dns.RcodeNotAuth {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeNotAuth, r.Rcode)
+	}
+	if ts := r.IsTsig(); ts == nil || ts.Error != dns.RcodeBadKey {
+		t.Errorf("Expected TSIG error %d, got %v", dns.RcodeBadKey, ts)
+	}
+
+	corefile = `example.org:0 {
+		secondary {
+			transfer from ` + tcp + `
+			tsig transfer.key. ` + secret + `
+		}
+	}`
+
+	i1, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i1.Stop()
+
+	m = new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeSOA)
+	for i := 0; i < 10; i++ {
+		r, _ = dns.Exchange(m, udp)
+		if len(r.Answer) != 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(r.Answer) == 0 {
+		t.Fatalf("Expected answer section")
+	}
+}
+
+// receiveTransfer performs the transfer and returns the number of records received.
+func receiveTransfer(tr *dns.Transfer, m *dns.Msg, addr string) (int, error) {
+	env, err := tr.In(m, addr)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for e := range env {
+		if e.Error != nil {
+			return n, e.Error
+		}
+		n += len(e.RR)
+	}
+	return n, nil
+}